@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/snakes-and-ladders/go-backend/internal/game"
 	"github.com/snakes-and-ladders/go-backend/internal/handler"
 	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
 )
 
 func main() {
@@ -27,23 +30,70 @@ func main() {
 	cfg := config.Load()
 
 	// Initialize components
-	store := game.NewStore()
-	h := hub.NewHub()
-
-	// Start cleanup routine for old games
+	store, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open game store: %v", err)
+	}
 	stopCleanup := make(chan struct{})
-	go store.StartCleanupRoutine(30*time.Minute, 2*time.Hour, stopCleanup)
+
+	// Periodically snapshot the event log so it doesn't grow without bound
+	if eventLog, ok := store.(*game.EventLogStore); ok {
+		go eventLog.StartCompactionRoutine(cfg.CompactInterval, stopCleanup)
+	}
+
+	// Keep a permanent record of every finished game
+	archive, err := game.OpenFileArchive(cfg.ArchiveDir)
+	if err != nil {
+		log.Fatalf("Failed to open game archive: %v", err)
+	}
+	store = game.NewArchivingStore(store, archive)
+
+	restoreGames(store, cfg.ShutdownSnapshotPath)
+
+	backplane, err := openBackplane(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open hub backplane: %v", err)
+	}
+	h, err := hub.NewHubWithBackplane(backplane)
+	if err != nil {
+		log.Fatalf("Failed to subscribe to hub backplane: %v", err)
+	}
+	slowPolicy, err := hub.ParseSlowConsumerPolicy(cfg.SlowConsumerPolicy)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	h.SetSlowConsumerPolicy(slowPolicy)
 
 	// Create handlers
 	healthHandler := handler.NewHealthHandler(store)
 	httpHandler := handler.NewHTTPHandler(store)
-	adminHandler := handler.NewAdminHandler(store)
-	wsHandler := handler.NewWebSocketHandler(store, h, cfg)
-	pollHandler := handler.NewPollHandler(store, h)
+	commands := handler.NewDispatcher(store, h)
+	commands.SetDefaultFlushInterval(cfg.MoveFlushInterval)
+	commands.SetChatFilter(handler.NewWordListFilter(cfg.ChatBlockedWords))
+	commands.SetReactionWindow(cfg.ReactionWindow)
+	limiter := handler.NewRateLimiter(cfg.RateLimit)
+	commands.SetRateLimiter(limiter)
+	sessionPolicy, err := handler.ParseSessionPolicy(cfg.SessionPolicy)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	commands.SetSessionPolicy(sessionPolicy)
+	wsHandler := handler.NewWebSocketHandler(store, h, commands, cfg)
+	adminHandler := handler.NewAdminHandler(store, archive, h, wsHandler, commands)
+	pollHandler := handler.NewPollHandler(store, h, commands)
+	sseHandler := handler.NewSSEHandler(store, h, commands)
 
 	// Start cleanup routine for stale poll connections
 	go pollHandler.StartCleanup(1*time.Minute, 5*time.Minute, stopCleanup)
 
+	// Expire idle games, telling their clients first
+	expiry := game.ExpiryPolicy{
+		WaitingTTL:  cfg.WaitingTTL,
+		PlayingTTL:  cfg.PlayingTTL,
+		FinishedTTL: cfg.FinishedTTL,
+	}
+	go game.StartCleanupRoutine(store, 1*time.Minute, expiry, handler.NewExpiryNotifier(h, commands, pollHandler), stopCleanup)
+
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -51,10 +101,11 @@ func main() {
 	mux.Handle("/health", healthHandler)
 
 	// HTTP API
+	createGame := limiter.Middleware(handler.ClassCreate, http.HandlerFunc(httpHandler.HandleCreateGame))
 	mux.HandleFunc("/games", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			httpHandler.HandleCreateGame(w, r)
+			createGame.ServeHTTP(w, r)
 		case http.MethodOptions:
 			w.WriteHeader(http.StatusOK)
 		default:
@@ -62,10 +113,12 @@ func main() {
 		}
 	})
 	mux.HandleFunc("/games/", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/replay"):
+			httpHandler.HandleGetReplay(w, r)
+		case r.Method == http.MethodGet:
 			httpHandler.HandleGetGame(w, r)
-		case http.MethodOptions:
+		case r.Method == http.MethodOptions:
 			w.WriteHeader(http.StatusOK)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -84,9 +137,42 @@ func main() {
 		}
 	})
 	mux.HandleFunc("/admin/games/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/flush-interval"):
+			adminHandler.HandleSetFlushInterval(w, r)
+		case r.Method == http.MethodGet:
+			adminHandler.HandleGetGameDetail(w, r)
+		case r.Method == http.MethodOptions:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/admin/clients", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			adminHandler.HandleGetGameDetail(w, r)
+			adminHandler.HandleListClients(w, r)
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/archive", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			adminHandler.HandleSearchArchive(w, r)
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/archive/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			adminHandler.HandleGetArchivedGame(w, r)
 		case http.MethodOptions:
 			w.WriteHeader(http.StatusOK)
 		default:
@@ -95,13 +181,14 @@ func main() {
 	})
 
 	// WebSocket
-	mux.Handle("/ws", wsHandler)
+	mux.Handle("/ws", limiter.Middleware("", wsHandler))
 
 	// Long polling
+	pollConnect := limiter.Middleware("", http.HandlerFunc(pollHandler.HandleConnect))
 	mux.HandleFunc("/poll/connect", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			pollHandler.HandleConnect(w, r)
+			pollConnect.ServeHTTP(w, r)
 		case http.MethodOptions:
 			w.WriteHeader(http.StatusOK)
 		default:
@@ -118,10 +205,11 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	pollSend := limiter.Middleware("", http.HandlerFunc(pollHandler.HandleSend))
 	mux.HandleFunc("/poll/send", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			pollHandler.HandleSend(w, r)
+			pollSend.ServeHTTP(w, r)
 		case http.MethodOptions:
 			w.WriteHeader(http.StatusOK)
 		default:
@@ -139,6 +227,30 @@ func main() {
 		}
 	})
 
+	// Server-Sent Events
+	sseStream := limiter.Middleware("", http.HandlerFunc(sseHandler.HandleStream))
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			sseStream.ServeHTTP(w, r)
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	sseSend := limiter.Middleware("", http.HandlerFunc(sseHandler.HandleSend))
+	mux.HandleFunc("/sse/send", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			sseSend.ServeHTTP(w, r)
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	// Wrap with CORS middleware
 	corsHandler := corsMiddleware(cfg)(mux)
 
@@ -167,20 +279,143 @@ func main() {
 
 	log.Println("Shutting down server...")
 
-	// Stop cleanup routine
-	close(stopCleanup)
-
 	// Graceful shutdown with 30s timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Once the listener is closed, tell every client to reconnect. This also
+	// ends SSE streams and long polls, which Shutdown waits for; hijacked
+	// WebSocket connections stay open until their sockets flush.
+	server.RegisterOnShutdown(func() {
+		h.Shutdown(message.ServerRestartingMessage{
+			Type:             message.TypeServerRestarting,
+			ReconnectDelayMs: int(cfg.ReconnectDelay / time.Millisecond),
+		})
+	})
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	wsHandler.WaitForClosed(ctx)
+	// Let every game finish the commands already under way
+	commands.Close()
+	backplane.Close()
+
+	// Stop cleanup routine
+	close(stopCleanup)
+
+	// Save live games so the next process can pick them up
+	if err := saveGames(store, cfg.ShutdownSnapshotPath); err != nil {
+		log.Printf("Error saving shutdown snapshot: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		log.Printf("Error closing game store: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Error closing game archive: %v", err)
 	}
 
 	log.Println("Server stopped")
 }
 
+// restoreGames loads games saved by a previous shutdown into the store and
+// marks every player as disconnected, since no sockets survive a restart.
+func restoreGames(store game.Store, path string) {
+	games, err := game.ReadSnapshotFile(path)
+	if err != nil {
+		log.Printf("Error reading shutdown snapshot: %v", err)
+	}
+
+	restored := 0
+	for _, g := range games {
+		// Durable stores may already have a newer copy
+		if store.Get(g.Code) != nil {
+			continue
+		}
+		if err := store.Add(g); err != nil {
+			log.Printf("Error restoring game %s: %v", g.Code, err)
+			continue
+		}
+		restored++
+	}
+	if restored > 0 {
+		log.Printf("Restored %d games from %s", restored, path)
+	}
+
+	// The snapshot is only valid for the restart it was written for
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing shutdown snapshot: %v", err)
+	}
+
+	for _, g := range store.GetAll() {
+		if g.ResetConnections() {
+			if err := store.Save(g); err != nil {
+				log.Printf("Error saving game %s: %v", g.Code, err)
+			}
+		}
+	}
+}
+
+// saveGames writes every live game to the shutdown snapshot.
+func saveGames(store game.Store, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	games := store.GetAll()
+	if err := game.WriteSnapshotFile(path, games); err != nil {
+		return err
+	}
+	log.Printf("Saved %d games to %s", len(games), path)
+	return nil
+}
+
+// openStore creates the game store selected by the configuration.
+func openStore(cfg *config.Config) (game.Store, error) {
+	codes, err := game.NewCodeScheme(cfg.CodeScheme, cfg.CodeLength, cfg.CodeAlphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.StoreBackend {
+	case "memory":
+		store := game.NewShardedStore(cfg.StoreShards)
+		store.SetCodeScheme(codes)
+		return store, nil
+	case "file":
+		log.Printf("Using file store in %s", cfg.DataDir)
+		store, err := game.OpenFileStore(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		store.SetCodeScheme(codes)
+		return store, nil
+	case "eventlog":
+		log.Printf("Using event log store in %s", cfg.DataDir)
+		store, err := game.OpenEventLogStore(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		store.SetCodeScheme(codes)
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.StoreBackend)
+	}
+}
+
+// openBackplane creates the hub backplane selected by the configuration.
+func openBackplane(cfg *config.Config) (hub.Backplane, error) {
+	switch cfg.Backplane {
+	case "local":
+		return hub.NewLocalBackplane(), nil
+	case "redis":
+		log.Printf("Using Redis backplane at %s", cfg.RedisAddr)
+		return hub.NewRedisBackplane(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisPrefix)
+	default:
+		return nil, fmt.Errorf("unknown backplane %q", cfg.Backplane)
+	}
+}
+
 // corsMiddleware adds CORS headers to responses.
 func corsMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
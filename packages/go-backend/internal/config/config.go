@@ -2,14 +2,128 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds the application configuration loaded from environment variables.
 type Config struct {
 	Port           int
 	AllowedOrigins []string
+
+	// StoreBackend selects the game store: "memory", "file" or "eventlog".
+	StoreBackend string
+	// StoreShards is the number of shards used by the "memory" store.
+	StoreShards int
+	// DataDir is where durable stores keep their files.
+	DataDir string
+	// CompactInterval is how often the "eventlog" store compacts its log.
+	CompactInterval time.Duration
+	// ArchiveDir is where finished games are archived.
+	ArchiveDir string
+
+	// ShutdownSnapshotPath is where live games are saved on shutdown and
+	// restored from on start.
+	ShutdownSnapshotPath string
+	// ReconnectDelay is the delay suggested to clients when the server restarts.
+	ReconnectDelay time.Duration
+
+	// CodeScheme selects how game codes are generated: "random" or "words".
+	CodeScheme string
+	// CodeLength and CodeAlphabet configure the "random" code scheme.
+	CodeLength   int
+	CodeAlphabet string
+
+	// Backplane selects how game broadcasts reach other instances: "local"
+	// (single instance) or "redis".
+	Backplane string
+	// RedisAddr, RedisPassword and RedisPrefix configure the Redis backplane.
+	RedisAddr     string
+	RedisPassword string
+	RedisPrefix   string
+
+	// SlowConsumerPolicy is what the hub does with a client that can't keep
+	// up: "disconnect", "resync" or "coalesce".
+	SlowConsumerPolicy string
+
+	// SessionPolicy is what happens when a player joins a game again from
+	// another tab: "shared" keeps both sessions, "last-wins" closes the older.
+	SessionPolicy string
+
+	// WaitingTTL, PlayingTTL and FinishedTTL are how long a game in each
+	// status may go without activity before it expires.
+	WaitingTTL  time.Duration
+	PlayingTTL  time.Duration
+	FinishedTTL time.Duration
+
+	// MoveFlushInterval is how long moves wait to be broadcast together as
+	// one movesBatch. Zero broadcasts each move at once.
+	MoveFlushInterval time.Duration
+
+	// ChatBlockedWords are masked in chat messages.
+	ChatBlockedWords []string
+	// ReactionWindow is how long reactions are tallied before each is
+	// broadcast with how many players sent it.
+	ReactionWindow time.Duration
+
+	// WebSocket holds the /ws connection settings.
+	WebSocket WebSocketConfig
+
+	// RateLimit holds the limits on how fast clients may act.
+	RateLimit RateLimitConfig
+}
+
+// RateLimitConfig holds the token bucket limits on client actions.
+type RateLimitConfig struct {
+	// Create limits POST /games per source IP. Join, Roll, Chat and React
+	// limit those actions per connection.
+	Create RateLimit
+	Join   RateLimit
+	Roll   RateLimit
+	Chat   RateLimit
+	React  RateLimit
+	// PerIP limits everything from one source IP, over all its connections.
+	PerIP RateLimit
+	// MaxViolations is how many limited actions in a row get a connection
+	// disconnected. Zero never disconnects.
+	MaxViolations int
+	// TrustProxy takes the source IP from the last X-Forwarded-For entry,
+	// for when the server is behind a load balancer that sets it.
+	TrustProxy bool
+}
+
+// RateLimit is a token bucket: up to Burst actions at once, refilled at
+// PerSecond. Zero PerSecond means no limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// WebSocketConfig holds the settings for WebSocket connections.
+type WebSocketConfig struct {
+	// ReadBufferSize and WriteBufferSize are the I/O buffer sizes in bytes
+	// of each connection.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// MaxMessageSize is the largest message accepted from a client, in bytes.
+	MaxMessageSize int64
+
+	// PongWait is how long a connection may stay silent before it is dropped.
+	// PingPeriod is how often the server pings, and must be less than PongWait.
+	PongWait   time.Duration
+	PingPeriod time.Duration
+	// WriteWait is how long a write may take.
+	WriteWait time.Duration
+
+	// Compression enables permessage-deflate for clients that offer it.
+	Compression bool
+	// CompressionThreshold is the smallest message, in bytes, worth
+	// compressing. Smaller ones are sent as they are.
+	CompressionThreshold int
+	// CompressionLevel is the flate level, from -2 (Huffman only) to 9.
+	CompressionLevel int
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -29,10 +143,244 @@ func Load() *Config {
 		}
 	}
 
+	storeBackend := "memory"
+	if b := os.Getenv("STORE_BACKEND"); b != "" {
+		storeBackend = strings.ToLower(strings.TrimSpace(b))
+	}
+
+	storeShards := 32
+	if n := os.Getenv("STORE_SHARDS"); n != "" {
+		if parsed, err := strconv.Atoi(n); err == nil && parsed > 0 {
+			storeShards = parsed
+		}
+	}
+
+	dataDir := "data"
+	if d := os.Getenv("DATA_DIR"); d != "" {
+		dataDir = d
+	}
+
+	compactInterval := parseDuration("EVENTLOG_COMPACT_INTERVAL", 5*time.Minute)
+
+	archiveDir := filepath.Join(dataDir, "archive")
+	if d := os.Getenv("ARCHIVE_DIR"); d != "" {
+		archiveDir = d
+	}
+
+	shutdownSnapshotPath := filepath.Join(dataDir, "shutdown-snapshot.json")
+	if p := os.Getenv("SHUTDOWN_SNAPSHOT_PATH"); p != "" {
+		shutdownSnapshotPath = p
+	}
+
+	reconnectDelay := 3 * time.Second
+	if d := os.Getenv("RECONNECT_DELAY_MS"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil {
+			reconnectDelay = time.Duration(parsed) * time.Millisecond
+		}
+	}
+
+	codeScheme := "random"
+	if c := os.Getenv("CODE_SCHEME"); c != "" {
+		codeScheme = strings.ToLower(strings.TrimSpace(c))
+	}
+
+	codeLength := 6
+	if l := os.Getenv("CODE_LENGTH"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			codeLength = parsed
+		}
+	}
+
+	codeAlphabet := "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	if a := os.Getenv("CODE_ALPHABET"); a != "" {
+		codeAlphabet = a
+	}
+
+	backplane := "local"
+	if b := os.Getenv("BACKPLANE"); b != "" {
+		backplane = strings.ToLower(strings.TrimSpace(b))
+	}
+
+	redisAddr := "localhost:6379"
+	if a := os.Getenv("REDIS_ADDR"); a != "" {
+		redisAddr = a
+	}
+
+	redisPrefix := "snakes:"
+	if p := os.Getenv("REDIS_PREFIX"); p != "" {
+		redisPrefix = p
+	}
+
+	slowConsumerPolicy := "resync"
+	if p := os.Getenv("SLOW_CONSUMER_POLICY"); p != "" {
+		slowConsumerPolicy = strings.ToLower(strings.TrimSpace(p))
+	}
+
+	sessionPolicy := "shared"
+	if p := os.Getenv("SESSION_POLICY"); p != "" {
+		sessionPolicy = strings.ToLower(strings.TrimSpace(p))
+	}
+
+	waitingTTL := parseDuration("GAME_TTL_WAITING", 30*time.Minute)
+	playingTTL := parseDuration("GAME_TTL_PLAYING", 2*time.Hour)
+	finishedTTL := parseDuration("GAME_TTL_FINISHED", 15*time.Minute)
+
+	moveFlushInterval := parseDuration("MOVE_FLUSH_INTERVAL", 0)
+
+	var chatBlockedWords []string
+	if w := os.Getenv("CHAT_BLOCKED_WORDS"); w != "" {
+		chatBlockedWords = strings.Split(w, ",")
+	}
+
+	reactionWindow := parseDuration("REACTION_WINDOW", time.Second)
+
+	webSocket := DefaultWebSocketConfig()
+	webSocket.ReadBufferSize = parseSize("WS_READ_BUFFER_SIZE", webSocket.ReadBufferSize)
+	webSocket.WriteBufferSize = parseSize("WS_WRITE_BUFFER_SIZE", webSocket.WriteBufferSize)
+	webSocket.MaxMessageSize = int64(parseSize("WS_MAX_MESSAGE_SIZE", int(webSocket.MaxMessageSize)))
+	webSocket.PongWait = parseDuration("WS_PONG_WAIT", webSocket.PongWait)
+	webSocket.PingPeriod = parseDuration("WS_PING_PERIOD", webSocket.PongWait*9/10)
+	if webSocket.PingPeriod >= webSocket.PongWait {
+		// A ping must arrive before the client's read deadline
+		webSocket.PingPeriod = webSocket.PongWait * 9 / 10
+	}
+	webSocket.WriteWait = parseDuration("WS_WRITE_WAIT", webSocket.WriteWait)
+	if c := os.Getenv("WS_COMPRESSION"); c != "" {
+		if parsed, err := strconv.ParseBool(c); err == nil {
+			webSocket.Compression = parsed
+		}
+	}
+	webSocket.CompressionThreshold = parseSize("WS_COMPRESSION_THRESHOLD", webSocket.CompressionThreshold)
+	if l := os.Getenv("WS_COMPRESSION_LEVEL"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed >= -2 && parsed <= 9 {
+			webSocket.CompressionLevel = parsed
+		}
+	}
+
+	rateLimit := DefaultRateLimitConfig()
+	rateLimit.Create = parseRate("RATE_LIMIT_CREATE", rateLimit.Create)
+	rateLimit.Join = parseRate("RATE_LIMIT_JOIN", rateLimit.Join)
+	rateLimit.Roll = parseRate("RATE_LIMIT_ROLL", rateLimit.Roll)
+	rateLimit.Chat = parseRate("RATE_LIMIT_CHAT", rateLimit.Chat)
+	rateLimit.React = parseRate("RATE_LIMIT_REACT", rateLimit.React)
+	rateLimit.PerIP = parseRate("RATE_LIMIT_PER_IP", rateLimit.PerIP)
+	if v := os.Getenv("RATE_LIMIT_MAX_VIOLATIONS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			rateLimit.MaxViolations = parsed
+		}
+	}
+	if v := os.Getenv("RATE_LIMIT_TRUST_PROXY"); v != "" {
+		if parsed, err := strconv.ParseBool(v); err == nil {
+			rateLimit.TrustProxy = parsed
+		}
+	}
+
 	return &Config{
-		Port:           port,
-		AllowedOrigins: allowedOrigins,
+		Port:                 port,
+		AllowedOrigins:       allowedOrigins,
+		StoreBackend:         storeBackend,
+		StoreShards:          storeShards,
+		DataDir:              dataDir,
+		CompactInterval:      compactInterval,
+		ArchiveDir:           archiveDir,
+		ShutdownSnapshotPath: shutdownSnapshotPath,
+		ReconnectDelay:       reconnectDelay,
+		CodeScheme:           codeScheme,
+		CodeLength:           codeLength,
+		CodeAlphabet:         codeAlphabet,
+		Backplane:            backplane,
+		RedisAddr:            redisAddr,
+		RedisPassword:        os.Getenv("REDIS_PASSWORD"),
+		RedisPrefix:          redisPrefix,
+		SlowConsumerPolicy:   slowConsumerPolicy,
+		SessionPolicy:        sessionPolicy,
+		WaitingTTL:           waitingTTL,
+		PlayingTTL:           playingTTL,
+		FinishedTTL:          finishedTTL,
+		MoveFlushInterval:    moveFlushInterval,
+		ChatBlockedWords:     chatBlockedWords,
+		ReactionWindow:       reactionWindow,
+		WebSocket:            webSocket,
+		RateLimit:            rateLimit,
+	}
+}
+
+// DefaultRateLimitConfig returns the rate limits used when none are given.
+// Rolls are generous, as the game is a race.
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Create:        RateLimit{PerSecond: 0.2, Burst: 5},
+		Join:          RateLimit{PerSecond: 1, Burst: 5},
+		Roll:          RateLimit{PerSecond: 10, Burst: 20},
+		Chat:          RateLimit{PerSecond: 1, Burst: 5},
+		React:         RateLimit{PerSecond: 5, Burst: 10},
+		PerIP:         RateLimit{PerSecond: 50, Burst: 100},
+		MaxViolations: 20,
+	}
+}
+
+// DefaultWebSocketConfig returns the WebSocket settings used when none are
+// given.
+func DefaultWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		ReadBufferSize:       1024,
+		WriteBufferSize:      1024,
+		MaxMessageSize:       4096,
+		PongWait:             60 * time.Second,
+		PingPeriod:           54 * time.Second,
+		WriteWait:            10 * time.Second,
+		Compression:          true,
+		CompressionThreshold: 512,
+		CompressionLevel:     1,
+	}
+}
+
+// parseDuration reads a duration such as "30m" from an environment variable,
+// falling back to def if it is unset or invalid.
+func parseDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return def
+}
+
+// parseSize reads a positive byte count from an environment variable,
+// falling back to def if it is unset or invalid.
+func parseSize(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return def
+}
+
+// parseRate reads a rate limit written as "perSecond:burst", e.g. "0.5:10",
+// from an environment variable, falling back to def if it is unset or
+// invalid. "0" turns the limit off.
+func parseRate(key string, def RateLimit) RateLimit {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if v == "0" {
+		return RateLimit{}
+	}
+	rate, burst, ok := strings.Cut(v, ":")
+	if !ok {
+		return def
+	}
+	perSecond, err := strconv.ParseFloat(rate, 64)
+	if err != nil || perSecond <= 0 {
+		return def
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n <= 0 {
+		return def
 	}
+	return RateLimit{PerSecond: perSecond, Burst: n}
 }
 
 // IsOriginAllowed checks if the given origin is in the allowed list.
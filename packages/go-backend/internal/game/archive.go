@@ -0,0 +1,395 @@
+package game
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const archiveFile = "archive.log"
+
+// ArchivedGame is the permanent record of a finished game.
+type ArchivedGame struct {
+	// ID identifies the record; codes are reused, so it includes the creation time.
+	ID         string          `json:"id"`
+	Code       string          `json:"code"`
+	Board      Board           `json:"board"`
+	Settings   ArchiveSettings `json:"settings"`
+	Standings  []Standing      `json:"standings"`
+	WinnerID   string          `json:"winnerId"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	DurationMs int64           `json:"durationMs"`
+	MoveCount  int             `json:"moveCount"`
+}
+
+// ArchiveSettings records how a game was set up.
+type ArchiveSettings struct {
+	CreatorID  string `json:"creatorId"`
+	MaxPlayers int    `json:"maxPlayers"`
+}
+
+// Standing is a player's final place in a finished game.
+type Standing struct {
+	Rank     int    `json:"rank"`
+	PlayerID string `json:"playerId"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Position int    `json:"position"`
+}
+
+// ArchiveID returns the archive record ID for a game.
+func ArchiveID(code string, createdAt time.Time) string {
+	return fmt.Sprintf("%s-%d", code, createdAt.UnixMilli())
+}
+
+// Archive builds the archive record for a finished game.
+func (g *Game) Archive() ArchivedGame {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	a := ArchivedGame{
+		ID:         ArchiveID(g.Code, g.CreatedAt),
+		Code:       g.Code,
+		Settings:   ArchiveSettings{CreatorID: g.CreatorID, MaxPlayers: MaxPlayers},
+		WinnerID:   g.WinnerID,
+		CreatedAt:  g.CreatedAt,
+		StartedAt:  g.startedAt,
+		FinishedAt: g.finishedAt,
+		MoveCount:  g.moveCount,
+	}
+	if g.Board != nil {
+		a.Board = *g.Board
+	}
+
+	if a.FinishedAt.IsZero() {
+		a.FinishedAt = g.UpdatedAt
+	}
+	if !a.StartedAt.IsZero() {
+		a.DurationMs = a.FinishedAt.Sub(a.StartedAt).Milliseconds()
+	}
+
+	// Winner first, then everyone else by how far they got
+	players := make([]*Player, len(g.Players))
+	copy(players, g.Players)
+	sort.SliceStable(players, func(i, j int) bool {
+		if (players[i].ID == g.WinnerID) != (players[j].ID == g.WinnerID) {
+			return players[i].ID == g.WinnerID
+		}
+		return players[i].Position > players[j].Position
+	})
+
+	a.Standings = make([]Standing, len(players))
+	for i, p := range players {
+		a.Standings[i] = Standing{
+			Rank:     i + 1,
+			PlayerID: p.ID,
+			Name:     p.Name,
+			Color:    p.Color,
+			Position: p.Position,
+		}
+	}
+	return a
+}
+
+// ArchiveQuery filters archive searches. Zero fields match everything.
+type ArchiveQuery struct {
+	// From and To bound FinishedAt; From is inclusive, To exclusive.
+	From time.Time
+	To   time.Time
+	// Player matches any player whose name contains it, ignoring case.
+	Player string
+	// Board matches the board name, ignoring case.
+	Board string
+	// Limit caps the number of results.
+	Limit int
+}
+
+// Matches reports whether an archived game satisfies the query.
+func (q ArchiveQuery) Matches(a ArchivedGame) bool {
+	if !q.From.IsZero() && a.FinishedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !a.FinishedAt.Before(q.To) {
+		return false
+	}
+	if q.Board != "" && !strings.EqualFold(a.Board.Name, q.Board) {
+		return false
+	}
+	if q.Player != "" {
+		name := strings.ToLower(q.Player)
+		for _, s := range a.Standings {
+			if strings.Contains(strings.ToLower(s.Name), name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Archive holds finished games after they leave the live Store.
+type Archive interface {
+	// Put records a finished game. Putting the same ID again is a no-op.
+	Put(a ArchivedGame) error
+	// Get returns an archived game by ID.
+	Get(id string) (ArchivedGame, bool)
+	// Search returns matching games, most recently finished first.
+	Search(q ArchiveQuery) []ArchivedGame
+	// Count returns the number of archived games.
+	Count() int
+	// Close releases any resources held by the archive.
+	Close() error
+}
+
+// MemoryArchive is an in-memory Archive.
+type MemoryArchive struct {
+	mu    sync.RWMutex
+	games map[string]ArchivedGame
+}
+
+// NewMemoryArchive creates an empty in-memory archive.
+func NewMemoryArchive() *MemoryArchive {
+	return &MemoryArchive{games: make(map[string]ArchivedGame)}
+}
+
+// Put records a finished game.
+func (a *MemoryArchive) Put(g ArchivedGame) error {
+	a.put(g)
+	return nil
+}
+
+// put records a game and reports whether it was new.
+func (a *MemoryArchive) put(g ArchivedGame) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.games[g.ID]; exists {
+		return false
+	}
+	a.games[g.ID] = g
+	return true
+}
+
+// Has reports whether a game with the ID has been archived.
+func (a *MemoryArchive) Has(id string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.games[id]
+	return ok
+}
+
+// Get returns an archived game by ID.
+func (a *MemoryArchive) Get(id string) (ArchivedGame, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	g, ok := a.games[id]
+	return g, ok
+}
+
+// Search returns matching games, most recently finished first.
+func (a *MemoryArchive) Search(q ArchiveQuery) []ArchivedGame {
+	a.mu.RLock()
+	results := make([]ArchivedGame, 0)
+	for _, g := range a.games {
+		if q.Matches(g) {
+			results = append(results, g)
+		}
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].FinishedAt.After(results[j].FinishedAt)
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+// Count returns the number of archived games.
+func (a *MemoryArchive) Count() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.games)
+}
+
+// Close is a no-op for the in-memory archive.
+func (a *MemoryArchive) Close() error {
+	return nil
+}
+
+// FileArchive is a durable Archive backed by an append-only file of
+// checksummed JSON records, one per game, in the same framing as the event
+// log. Records are indexed in memory on open.
+type FileArchive struct {
+	mem *MemoryArchive
+
+	// mu serializes appends.
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileArchive opens (or creates) an archive in dir.
+func OpenFileArchive(dir string) (*FileArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive dir: %w", err)
+	}
+
+	a := &FileArchive{mem: NewMemoryArchive()}
+	path := filepath.Join(dir, archiveFile)
+	if err := a.load(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	a.file = file
+
+	if n := a.mem.Count(); n > 0 {
+		log.Printf("Loaded %d archived games from %s", n, dir)
+	}
+	return a, nil
+}
+
+// load indexes every record in the archive file and truncates a torn tail.
+func (a *FileArchive) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+
+		data, ok := decodeRecord(line)
+		if !ok {
+			break
+		}
+		var g ArchivedGame
+		if err := json.Unmarshal(data, &g); err != nil {
+			break
+		}
+		good += int64(len(line))
+		a.mem.put(g)
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > good {
+		log.Printf("Truncating %d bytes of incomplete records from %s", info.Size()-good, path)
+		if err := os.Truncate(path, good); err != nil {
+			return fmt.Errorf("truncate archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// Put appends a finished game to the archive file.
+func (a *FileArchive) Put(g ArchivedGame) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.mem.Has(g.ID) {
+		return nil
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(encodeRecord(data)); err != nil {
+		return err
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+
+	a.mem.put(g)
+	return nil
+}
+
+// Get returns an archived game by ID.
+func (a *FileArchive) Get(id string) (ArchivedGame, bool) {
+	return a.mem.Get(id)
+}
+
+// Search returns matching games, most recently finished first.
+func (a *FileArchive) Search(q ArchiveQuery) []ArchivedGame {
+	return a.mem.Search(q)
+}
+
+// Count returns the number of archived games.
+func (a *FileArchive) Count() int {
+	return a.mem.Count()
+}
+
+// Close closes the archive file.
+func (a *FileArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// ArchivingStore wraps a Store and copies every game into an Archive when it
+// finishes. The finished game stays in the live store, so its players can
+// still see the result, until the expiry policy removes it.
+type ArchivingStore struct {
+	Store
+	archive Archive
+}
+
+// NewArchivingStore wraps store so finished games are archived.
+func NewArchivingStore(store Store, archive Archive) *ArchivingStore {
+	return &ArchivingStore{Store: store, archive: archive}
+}
+
+// Save persists the game and archives it if it has finished.
+func (s *ArchivingStore) Save(g *Game) error {
+	if err := s.Store.Save(g); err != nil {
+		return err
+	}
+	if g.GetStatus() != StatusFinished {
+		return nil
+	}
+	if err := s.archive.Put(g.Archive()); err != nil {
+		return fmt.Errorf("archive game %s: %w", g.Code, err)
+	}
+	return nil
+}
+
+// ExpireGames expires idle games, archiving any finished game that has not
+// been archived yet (for example one finished before archiving was enabled).
+func (s *ArchivingStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	return s.Store.ExpireGames(policy, func(g *Game) {
+		if g.GetStatus() == StatusFinished {
+			if err := s.archive.Put(g.Archive()); err != nil {
+				log.Printf("Error archiving game %s: %v", g.Code, err)
+			}
+		}
+		if onExpire != nil {
+			onExpire(g)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package game
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// finishRace plays a two-player game until someone wins.
+func finishRace(t *testing.T, store Store) *Game {
+	t.Helper()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+	for i := 0; i < 10000 && g.GetStatus() != StatusFinished; i++ {
+		g.RollDice(alice.ID)
+		g.RollDice(bob.ID)
+	}
+	if g.GetStatus() != StatusFinished {
+		t.Fatal("Game should have finished")
+	}
+	return g
+}
+
+func TestGameArchive(t *testing.T) {
+	g := finishRace(t, NewMemoryStore())
+	a := g.Archive()
+
+	if a.ID != ArchiveID(g.Code, g.CreatedAt) {
+		t.Errorf("Unexpected archive ID %s", a.ID)
+	}
+	if a.Board.Name != DefaultBoardName {
+		t.Errorf("Expected board %s, got %s", DefaultBoardName, a.Board.Name)
+	}
+	if len(a.Standings) != 2 {
+		t.Fatalf("Expected 2 standings, got %d", len(a.Standings))
+	}
+	if a.Standings[0].PlayerID != g.WinnerID || a.Standings[0].Rank != 1 {
+		t.Errorf("Winner should be ranked first, got %+v", a.Standings[0])
+	}
+	if a.Standings[0].Position != g.Board.Size {
+		t.Errorf("Winner should finish on %d, got %d", g.Board.Size, a.Standings[0].Position)
+	}
+
+	moves := 0
+	for _, e := range g.Events() {
+		if e.Type == EventDiceRolled {
+			moves++
+		}
+	}
+	if a.MoveCount != moves {
+		t.Errorf("Expected %d moves, got %d", moves, a.MoveCount)
+	}
+	if a.StartedAt.IsZero() || a.FinishedAt.Before(a.StartedAt) {
+		t.Errorf("Unexpected start %v and finish %v", a.StartedAt, a.FinishedAt)
+	}
+	if a.DurationMs != a.FinishedAt.Sub(a.StartedAt).Milliseconds() {
+		t.Errorf("Duration should match start and finish, got %dms", a.DurationMs)
+	}
+}
+
+func TestArchiveSearch(t *testing.T) {
+	archive := NewMemoryArchive()
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	archive.Put(ArchivedGame{
+		ID: "A", Board: Board{Name: "classic"}, FinishedAt: day,
+		Standings: []Standing{{Name: "Alice"}, {Name: "Bob"}},
+	})
+	archive.Put(ArchivedGame{
+		ID: "B", Board: Board{Name: "classic"}, FinishedAt: day.Add(24 * time.Hour),
+		Standings: []Standing{{Name: "Carol"}},
+	})
+	archive.Put(ArchivedGame{
+		ID: "C", Board: Board{Name: "mini"}, FinishedAt: day.Add(48 * time.Hour),
+		Standings: []Standing{{Name: "alicia"}},
+	})
+
+	tests := []struct {
+		name  string
+		query ArchiveQuery
+		want  []string
+	}{
+		{"all newest first", ArchiveQuery{}, []string{"C", "B", "A"}},
+		{"date range", ArchiveQuery{From: day, To: day.Add(48 * time.Hour)}, []string{"B", "A"}},
+		{"player", ArchiveQuery{Player: "ALI"}, []string{"C", "A"}},
+		{"board", ArchiveQuery{Board: "Classic"}, []string{"B", "A"}},
+		{"combined", ArchiveQuery{Player: "ali", Board: "classic"}, []string{"A"}},
+		{"limit", ArchiveQuery{Limit: 1}, []string{"C"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := archive.Search(tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d results, got %d", len(tt.want), len(got))
+			}
+			for i, id := range tt.want {
+				if got[i].ID != id {
+					t.Errorf("Result %d: expected %s, got %s", i, id, got[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestFileArchiveReload(t *testing.T) {
+	dir := t.TempDir()
+
+	archive, err := OpenFileArchive(dir)
+	if err != nil {
+		t.Fatalf("OpenFileArchive failed: %v", err)
+	}
+	g := finishRace(t, NewMemoryStore())
+	archive.Put(g.Archive())
+	archive.Put(g.Archive())
+	archive.Close()
+
+	// Simulate a crash mid-append
+	f, _ := os.OpenFile(filepath.Join(dir, archiveFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`0000abcd {"id":"BRO`)
+	f.Close()
+
+	reopened, err := OpenFileArchive(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Count() != 1 {
+		t.Fatalf("Expected 1 archived game, got %d", reopened.Count())
+	}
+	got, ok := reopened.Get(g.Archive().ID)
+	if !ok {
+		t.Fatal("Archived game should survive a reopen")
+	}
+	if got.WinnerID != g.WinnerID {
+		t.Errorf("Expected winner %s, got %s", g.WinnerID, got.WinnerID)
+	}
+}
+
+func TestArchivingStoreArchivesFinishedGames(t *testing.T) {
+	archive := NewMemoryArchive()
+	store := NewArchivingStore(NewMemoryStore(), archive)
+
+	waiting, _, _ := store.Create("Alice")
+	store.Save(waiting)
+	if archive.Count() != 0 {
+		t.Errorf("Unfinished games should not be archived, got %d", archive.Count())
+	}
+
+	g := finishRace(t, store)
+	store.Save(g)
+	if _, ok := archive.Get(g.Archive().ID); !ok {
+		t.Error("Finished game should be archived on save")
+	}
+
+	// Still live until it expires, so players can see the result
+	if store.Get(g.Code) == nil {
+		t.Error("Finished game should stay in the live store")
+	}
+}
+
+func TestArchivingStoreArchivesOnExpiry(t *testing.T) {
+	archive := NewMemoryArchive()
+	inner := NewMemoryStore()
+
+	// Finished without going through the archiving store
+	g := finishRace(t, inner)
+	idleFor(g, time.Hour)
+
+	store := NewArchivingStore(inner, archive)
+	store.ExpireGames(testExpiry, nil)
+
+	if store.Count() != 0 {
+		t.Errorf("Expired game should be removed, got %d games", store.Count())
+	}
+	if archive.Count() != 1 {
+		t.Errorf("Expired finished game should be archived, got %d", archive.Count())
+	}
+}
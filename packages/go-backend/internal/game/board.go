@@ -9,6 +9,7 @@ type SnakeLadder struct {
 
 // Board represents the game board configuration.
 type Board struct {
+	Name            string        `json:"name,omitempty"`
 	Size            int           `json:"size"`
 	SnakesAndLadders []SnakeLadder `json:"snakesAndLadders"`
 }
@@ -27,9 +28,13 @@ type MoveEffect struct {
 	To   int    `json:"to"`
 }
 
+// DefaultBoardName identifies the default board in archives and searches.
+const DefaultBoardName = "classic"
+
 // DefaultBoard returns the default 100-square board with snakes and ladders.
 func DefaultBoard() *Board {
 	return &Board{
+		Name: DefaultBoardName,
 		Size: 100,
 		SnakesAndLadders: []SnakeLadder{
 			// Ladders (10 total)
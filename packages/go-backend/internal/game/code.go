@@ -0,0 +1,123 @@
+package game
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultCodeAlphabet excludes confusing characters: I, L, O, 0, 1.
+const DefaultCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// DefaultCodeLength is the length of codes produced by the default scheme.
+const DefaultCodeLength = 6
+
+// maxCodeAttempts bounds how many codes a store tries before giving up.
+const maxCodeAttempts = 100
+
+// ErrNoFreeCode is returned when a store cannot find an unused game code.
+var ErrNoFreeCode = errors.New("no free game code available")
+
+// CodeScheme generates candidate game codes. Stores retry until a generated
+// code is not already in use.
+type CodeScheme interface {
+	Generate() string
+}
+
+// RandomCodes generates fixed-length codes from an alphabet.
+type RandomCodes struct {
+	Length   int
+	Alphabet string
+}
+
+// DefaultCodes is the scheme used when none is configured.
+var DefaultCodes CodeScheme = RandomCodes{Length: DefaultCodeLength, Alphabet: DefaultCodeAlphabet}
+
+// Generate returns a random code.
+func (c RandomCodes) Generate() string {
+	code := make([]byte, c.Length)
+	for i := range code {
+		code[i] = c.Alphabet[randomIndex(len(c.Alphabet))]
+	}
+	return string(code)
+}
+
+// WordPairCodes generates human-friendly codes such as BRAVE-OTTER.
+type WordPairCodes struct{}
+
+// Generate returns a random adjective-animal pair.
+func (WordPairCodes) Generate() string {
+	return codeAdjectives[randomIndex(len(codeAdjectives))] + "-" + codeAnimals[randomIndex(len(codeAnimals))]
+}
+
+// NewCodeScheme builds a scheme from configuration. scheme is "random" or
+// "words"; length and alphabet only apply to "random".
+func NewCodeScheme(scheme string, length int, alphabet string) (CodeScheme, error) {
+	switch scheme {
+	case "", "random":
+		alphabet = strings.ToUpper(alphabet)
+		if length <= 0 {
+			return nil, fmt.Errorf("code length must be positive, got %d", length)
+		}
+		if alphabet == "" {
+			return nil, errors.New("code alphabet must not be empty")
+		}
+		return RandomCodes{Length: length, Alphabet: alphabet}, nil
+	case "words":
+		return WordPairCodes{}, nil
+	default:
+		return nil, fmt.Errorf("unknown code scheme %q", scheme)
+	}
+}
+
+// NormalizeCode canonicalizes a user-supplied game code. Lookups are
+// case-insensitive, so every stored code is upper case.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// allocateCode generates codes until one is not taken. Callers must make
+// taken and the subsequent insert atomic, typically by holding a store lock.
+func allocateCode(codes CodeScheme, taken func(code string) bool) (string, error) {
+	for i := 0; i < maxCodeAttempts; i++ {
+		code := NormalizeCode(codes.Generate())
+		if code != "" && !taken(code) {
+			return code, nil
+		}
+	}
+	return "", ErrNoFreeCode
+}
+
+// randomIndex returns a uniformly random index in [0, n).
+func randomIndex(n int) int {
+	v, _ := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	return int(v.Int64())
+}
+
+var codeAdjectives = []string{
+	"AMBER", "BOLD", "BRAVE", "BRIGHT", "BRISK", "CALM", "CHEERY", "CLEVER",
+	"COSMIC", "CRISP", "CURLY", "DANDY", "DARING", "DAZZLING", "EAGER", "EPIC",
+	"FANCY", "FEARLESS", "FIERY", "FLUFFY", "FROSTY", "FUNKY", "FUZZY", "GENTLE",
+	"GIANT", "GIDDY", "GLAD", "GOLDEN", "GRAND", "GROOVY", "HAPPY", "HARDY",
+	"HONEST", "JAZZY", "JOLLY", "JUMPY", "KEEN", "KIND", "LIVELY", "LOYAL",
+	"LUCKY", "MAGIC", "MELLOW", "MERRY", "MIGHTY", "MISTY", "NIMBLE", "NOBLE",
+	"PEPPY", "PLUCKY", "POLITE", "PROUD", "QUICK", "QUIET", "RAPID", "ROYAL",
+	"RUSTY", "SHINY", "SILLY", "SNAPPY", "SPEEDY", "SPICY", "STEADY", "STORMY",
+	"SUNNY", "SUPER", "SWIFT", "TIDY", "TURBO", "VELVET", "VIVID", "WACKY",
+	"WARM", "WILD", "WISE", "WITTY", "ZANY", "ZESTY", "ZIPPY", "ZEN",
+}
+
+var codeAnimals = []string{
+	"BADGER", "BEAVER", "BISON", "BUNNY", "CAMEL", "CHEETAH", "COBRA", "CONDOR",
+	"COYOTE", "CRANE", "DINGO", "DOLPHIN", "EAGLE", "FALCON", "FERRET", "GECKO",
+	"GIBBON", "GIRAFFE", "GOOSE", "GORILLA", "HAWK", "HEDGEHOG", "HERON", "HIPPO",
+	"HYENA", "IBIS", "IGUANA", "IMPALA", "JACKAL", "JAGUAR", "KOALA", "LEMUR",
+	"LEOPARD", "LION", "LLAMA", "LYNX", "MAGPIE", "MARMOT", "MEERKAT", "MOOSE",
+	"NEWT", "OCELOT", "ORCA", "OSPREY", "OSTRICH", "OTTER", "PANDA", "PANTHER",
+	"PARROT", "PELICAN", "PENGUIN", "PUFFIN", "PUMA", "PYTHON", "RABBIT", "RACCOON",
+	"RAVEN", "RHINO", "SALMON", "SEAL", "SHARK", "SLOTH", "SPARROW", "SQUID",
+	"STOAT", "SWAN", "TAPIR", "TIGER", "TOUCAN", "TURTLE", "VIPER", "WALRUS",
+	"WEASEL", "WHALE", "WOLF", "WOMBAT", "YAK", "ZEBRA", "KIWI", "MOLE",
+}
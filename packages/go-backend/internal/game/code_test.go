@@ -0,0 +1,106 @@
+package game
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// codeSetter is implemented by every Store that supports configurable codes.
+type codeSetter interface {
+	SetCodeScheme(codes CodeScheme)
+}
+
+func TestRandomCodes(t *testing.T) {
+	codes := RandomCodes{Length: 8, Alphabet: "XYZ"}
+	code := codes.Generate()
+
+	if len(code) != 8 {
+		t.Errorf("Expected 8 characters, got %d", len(code))
+	}
+	if strings.Trim(code, "XYZ") != "" {
+		t.Errorf("Code %s uses characters outside the alphabet", code)
+	}
+}
+
+func TestWordPairCodes(t *testing.T) {
+	code := WordPairCodes{}.Generate()
+	if !regexp.MustCompile(`^[A-Z]+-[A-Z]+$`).MatchString(code) {
+		t.Errorf("Expected ADJECTIVE-ANIMAL, got %s", code)
+	}
+}
+
+func TestNewCodeSchemeValidation(t *testing.T) {
+	if _, err := NewCodeScheme("random", 0, "ABC"); err == nil {
+		t.Error("Expected error for zero length")
+	}
+	if _, err := NewCodeScheme("random", 4, ""); err == nil {
+		t.Error("Expected error for empty alphabet")
+	}
+	if _, err := NewCodeScheme("emoji", 4, "ABC"); err == nil {
+		t.Error("Expected error for unknown scheme")
+	}
+
+	codes, err := NewCodeScheme("random", 4, "abc")
+	if err != nil {
+		t.Fatalf("NewCodeScheme failed: %v", err)
+	}
+	if code := codes.Generate(); strings.ToUpper(code) != code {
+		t.Errorf("Codes should be upper case, got %s", code)
+	}
+}
+
+func TestStoreCreateNeverReusesLiveCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		// 2 characters from a 3-letter alphabet: only 9 codes exist
+		store.(codeSetter).SetCodeScheme(RandomCodes{Length: 2, Alphabet: "ABC"})
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		seen := make(map[string]bool)
+		for i := 0; i < 9; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g, _, err := store.Create("Alice")
+				if err != nil {
+					t.Errorf("Create should find a free code: %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if seen[g.Code] {
+					t.Errorf("Code %s allocated twice", g.Code)
+				}
+				seen[g.Code] = true
+			}()
+		}
+		wg.Wait()
+
+		if store.Count() != 9 {
+			t.Errorf("Expected 9 games, got %d", store.Count())
+		}
+
+		if _, _, err := store.Create("Bob"); err != ErrNoFreeCode {
+			t.Errorf("Expected ErrNoFreeCode when every code is taken, got %v", err)
+		}
+		if store.Count() != 9 {
+			t.Errorf("Failed create should not store a game, got %d", store.Count())
+		}
+	})
+}
+
+func TestStoreGetIsCaseInsensitive(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		store.(codeSetter).SetCodeScheme(WordPairCodes{})
+		g, _, _ := store.Create("Alice")
+
+		if store.Get(strings.ToLower(g.Code)) != g {
+			t.Errorf("Lookup of %s should ignore case", strings.ToLower(g.Code))
+		}
+		if store.Get(" "+g.Code+" ") != g {
+			t.Error("Lookup should ignore surrounding whitespace")
+		}
+	})
+}
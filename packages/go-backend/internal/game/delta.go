@@ -0,0 +1,93 @@
+package game
+
+// MaxDeltaEvents bounds how many events ChangesSince looks back over, and so
+// how much of its timeline a game keeps in memory. A client further behind
+// than this gets a full snapshot instead.
+const MaxDeltaEvents = 1024
+
+// StateDelta is how a game's players changed between two versions. Values
+// are the players' current state, so applying a delta twice is harmless.
+type StateDelta struct {
+	From uint64
+	To   uint64
+	// Added are the players who joined after From, in join order.
+	Added []Player
+	// Positions and Connected hold the new position and connection flag of
+	// the other players, by ID, if they changed.
+	Positions map[string]int
+	Connected map[string]bool
+}
+
+// ChangesSince returns how the players changed since version. It returns
+// false if the timeline no longer reaches back that far, or version is newer
+// than the game; the caller should send a full snapshot instead.
+func (g *Game) ChangesSince(version uint64) (StateDelta, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	delta := StateDelta{From: version, To: g.version}
+	if version > g.version || g.version-version > MaxDeltaEvents {
+		return StateDelta{}, false
+	}
+	if version == g.version {
+		return delta, true
+	}
+	// Timelines restored from a snapshot may not start at Seq 1.
+	if len(g.events) == 0 || g.events[0].Seq > version+1 {
+		return StateDelta{}, false
+	}
+
+	added := make(map[string]bool)
+	moved := make(map[string]bool)
+	flipped := make(map[string]bool)
+	for _, e := range g.events[version+1-g.events[0].Seq:] {
+		switch d := e.Data.(type) {
+		case *GameCreatedData:
+			added[d.Creator.ID] = true
+		case *PlayerAddedData:
+			added[d.Player.ID] = true
+		case *ConnectionChangedData:
+			flipped[d.PlayerID] = true
+		case *GameStartedData:
+			// Everyone moves to the first square
+			for _, p := range g.Players {
+				moved[p.ID] = true
+			}
+		case *DiceRolledData:
+			moved[d.PlayerID] = true
+		}
+	}
+
+	for _, p := range g.Players {
+		if added[p.ID] {
+			delta.Added = append(delta.Added, *p)
+			continue
+		}
+		if moved[p.ID] {
+			if delta.Positions == nil {
+				delta.Positions = make(map[string]int)
+			}
+			delta.Positions[p.ID] = p.Position
+		}
+		if flipped[p.ID] {
+			if delta.Connected == nil {
+				delta.Connected = make(map[string]bool)
+			}
+			delta.Connected[p.ID] = p.IsConnected
+		}
+	}
+	return delta, true
+}
+
+// PlayersAt returns a copy of the players and the version they are at.
+func (g *Game) PlayersAt() ([]*Player, uint64) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	players := make([]*Player, len(g.Players))
+	for i, p := range g.Players {
+		playerCopy := *p
+		players[i] = &playerCopy
+	}
+	return players, g.version
+}
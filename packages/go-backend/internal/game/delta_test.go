@@ -0,0 +1,122 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestChangesSince(t *testing.T) {
+	game, alice := NewGame("Alice")
+	bob, _ := game.AddPlayer("Bob")
+	game.SetPlayerConnected(alice.ID, true)
+	known := game.Version()
+
+	carol, _ := game.AddPlayer("Carol")
+	game.SetPlayerConnected(bob.ID, true)
+	game.Start(alice.ID)
+	game.RollDice(alice.ID)
+
+	delta, ok := game.ChangesSince(known)
+	if !ok {
+		t.Fatal("Expected a delta")
+	}
+	if delta.From != known || delta.To != game.Version() {
+		t.Errorf("Expected versions %d to %d, got %d to %d", known, game.Version(), delta.From, delta.To)
+	}
+	if len(delta.Added) != 1 || delta.Added[0].ID != carol.ID {
+		t.Fatalf("Expected Carol to be added, got %+v", delta.Added)
+	}
+	if delta.Added[0].Position != 1 {
+		t.Errorf("Added players should have their current position, got %d", delta.Added[0].Position)
+	}
+
+	// Starting moved everyone, and only Alice rolled since
+	if len(delta.Positions) != 2 {
+		t.Errorf("Expected 2 positions, got %v", delta.Positions)
+	}
+	if delta.Positions[alice.ID] != playerByID(game, alice.ID).Position {
+		t.Errorf("Expected Alice's current position, got %d", delta.Positions[alice.ID])
+	}
+	if connected, ok := delta.Connected[bob.ID]; !ok || !connected || len(delta.Connected) != 1 {
+		t.Errorf("Expected only Bob's connection flag, got %v", delta.Connected)
+	}
+}
+
+func TestChangesSinceCurrentVersion(t *testing.T) {
+	game, _ := NewGame("Alice")
+
+	delta, ok := game.ChangesSince(game.Version())
+	if !ok {
+		t.Fatal("Expected an empty delta")
+	}
+	if len(delta.Added) != 0 || delta.Positions != nil || delta.Connected != nil {
+		t.Errorf("Expected no changes, got %+v", delta)
+	}
+}
+
+func TestChangesSinceTooOld(t *testing.T) {
+	game, alice := NewGame("Alice")
+	game.AddPlayer("Bob")
+	game.Start(alice.ID)
+
+	tests := []struct {
+		name    string
+		game    *Game
+		version uint64
+	}{
+		{"future version", game, game.Version() + 1},
+		{"timeline trimmed", RestoreGame(GameSnapshot{Code: game.Code, Version: game.Version()}), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.game.ChangesSince(tt.version); ok {
+				t.Error("Expected no delta")
+			}
+		})
+	}
+
+	// Too many events behind
+	for i := 0; i < MaxDeltaEvents; i++ {
+		game.SetPlayerConnected(alice.ID, i%2 == 0)
+	}
+	if _, ok := game.ChangesSince(1); ok {
+		t.Errorf("Expected no delta more than %d events behind", MaxDeltaEvents)
+	}
+}
+
+func TestTimelineIsTrimmed(t *testing.T) {
+	game, alice := NewGame("Alice")
+	for i := 0; i < 3*MaxDeltaEvents; i++ {
+		game.SetPlayerConnected(alice.ID, i%2 == 0)
+	}
+
+	events := game.Events()
+	if len(events) < MaxDeltaEvents || len(events) >= 2*MaxDeltaEvents {
+		t.Errorf("Expected between %d and %d events kept, got %d", MaxDeltaEvents, 2*MaxDeltaEvents, len(events))
+	}
+	if last := events[len(events)-1].Seq; last != game.Version() {
+		t.Errorf("Expected the timeline to end at %d, got %d", game.Version(), last)
+	}
+	if _, ok := game.ChangesSince(game.Version() - MaxDeltaEvents); !ok {
+		t.Error("Expected a delta within MaxDeltaEvents after trimming")
+	}
+}
+
+func TestPlayersAt(t *testing.T) {
+	game, _ := NewGame("Alice")
+	game.AddPlayer("Bob")
+
+	players, version := game.PlayersAt()
+	if len(players) != 2 || version != game.Version() {
+		t.Errorf("Expected 2 players at version %d, got %d at %d", game.Version(), len(players), version)
+	}
+}
+
+func playerByID(g *Game, id string) *Player {
+	for _, p := range g.GetPlayers() {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
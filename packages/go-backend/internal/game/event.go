@@ -0,0 +1,153 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Event types recorded for every state change of a game.
+const (
+	EventGameCreated       = "gameCreated"
+	EventPlayerAdded       = "playerAdded"
+	EventConnectionChanged = "connectionChanged"
+	EventGameStarted       = "gameStarted"
+	EventDiceRolled        = "diceRolled"
+	EventGameFinished      = "gameFinished"
+
+	// EventGameRemoved is written by stores when a game is deleted. It is
+	// never part of a game's own timeline.
+	EventGameRemoved = "gameRemoved"
+)
+
+// ErrEventOutOfOrder is returned when an event does not follow the game's current version.
+var ErrEventOutOfOrder = errors.New("event out of order")
+
+// Event is a domain event describing a single change to a game.
+type Event struct {
+	// Seq is the game version after the event is applied, starting at 1.
+	Seq      uint64    `json:"seq"`
+	GameCode string    `json:"gameCode"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Data     EventData `json:"data,omitempty"`
+}
+
+// EventData is the typed payload of an Event.
+type EventData interface {
+	eventType() string
+}
+
+// GameCreatedData is the payload of EventGameCreated.
+type GameCreatedData struct {
+	Creator Player `json:"creator"`
+	Board   *Board `json:"board"`
+}
+
+// PlayerAddedData is the payload of EventPlayerAdded.
+type PlayerAddedData struct {
+	Player Player `json:"player"`
+}
+
+// ConnectionChangedData is the payload of EventConnectionChanged.
+type ConnectionChangedData struct {
+	PlayerID  string `json:"playerId"`
+	Connected bool   `json:"connected"`
+}
+
+// GameStartedData is the payload of EventGameStarted.
+type GameStartedData struct {
+	PlayerID string `json:"playerId"`
+}
+
+// DiceRolledData is the payload of EventDiceRolled.
+type DiceRolledData struct {
+	PlayerID string      `json:"playerId"`
+	DiceRoll int         `json:"diceRoll"`
+	From     int         `json:"from"`
+	To       int         `json:"to"`
+	Effect   *MoveEffect `json:"effect,omitempty"`
+}
+
+// GameFinishedData is the payload of EventGameFinished.
+type GameFinishedData struct {
+	WinnerID string `json:"winnerId"`
+}
+
+func (*GameCreatedData) eventType() string       { return EventGameCreated }
+func (*PlayerAddedData) eventType() string       { return EventPlayerAdded }
+func (*ConnectionChangedData) eventType() string { return EventConnectionChanged }
+func (*GameStartedData) eventType() string       { return EventGameStarted }
+func (*DiceRolledData) eventType() string        { return EventDiceRolled }
+func (*GameFinishedData) eventType() string      { return EventGameFinished }
+
+// newEventData returns an empty payload for an event type, or nil if the type
+// carries no payload.
+func newEventData(eventType string) (EventData, error) {
+	switch eventType {
+	case EventGameCreated:
+		return &GameCreatedData{}, nil
+	case EventPlayerAdded:
+		return &PlayerAddedData{}, nil
+	case EventConnectionChanged:
+		return &ConnectionChangedData{}, nil
+	case EventGameStarted:
+		return &GameStartedData{}, nil
+	case EventDiceRolled:
+		return &DiceRolledData{}, nil
+	case EventGameFinished:
+		return &GameFinishedData{}, nil
+	case EventGameRemoved:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+}
+
+// UnmarshalJSON decodes an event and its typed payload.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Seq      uint64          `json:"seq"`
+		GameCode string          `json:"gameCode"`
+		Type     string          `json:"type"`
+		Time     time.Time       `json:"time"`
+		Data     json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	payload, err := newEventData(raw.Type)
+	if err != nil {
+		return err
+	}
+	if payload != nil && len(raw.Data) > 0 {
+		if err := json.Unmarshal(raw.Data, payload); err != nil {
+			return fmt.Errorf("decode %s payload: %w", raw.Type, err)
+		}
+	}
+
+	*e = Event{
+		Seq:      raw.Seq,
+		GameCode: raw.GameCode,
+		Type:     raw.Type,
+		Time:     raw.Time,
+		Data:     payload,
+	}
+	return nil
+}
+
+// ReplayGame rebuilds a game by applying its events in order.
+func ReplayGame(events []Event) (*Game, error) {
+	g := &Game{}
+	for _, e := range events {
+		if err := g.applyEvent(e); err != nil {
+			return nil, err
+		}
+	}
+	if g.Code == "" {
+		return nil, fmt.Errorf("%w: missing %s", ErrEventOutOfOrder, EventGameCreated)
+	}
+	return g, nil
+}
@@ -0,0 +1,565 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logSnapshotFile = "snapshot.json"
+	logFilePrefix   = "events-"
+	logFileExt      = ".log"
+	logHistoryDir   = "history"
+)
+
+// logSnapshot is the compaction snapshot written by EventLogStore. It names
+// the log generation whose events follow it.
+type logSnapshot struct {
+	Generation uint64         `json:"generation"`
+	Time       time.Time      `json:"time"`
+	Games      []GameSnapshot `json:"games"`
+}
+
+// EventLogStore is a durable Store backed by an append-only log of game
+// events. Games are served from memory; Save appends the events a game has
+// recorded since its last Save.
+//
+// Each record is one line holding a CRC32 of the JSON-encoded event followed
+// by the JSON itself. On open the latest snapshot is loaded and the log that
+// follows it is replayed; a torn or corrupt tail left by a crash is truncated.
+//
+// Compact writes a new snapshot and starts a fresh log generation, so the log
+// never grows without bound. The events of the old generation are folded into
+// one history file per game first, so replays still see the full timeline.
+type EventLogStore struct {
+	mem *MemoryStore
+	dir string
+
+	// mu serializes log writes and compaction and guards the fields below.
+	mu         sync.Mutex
+	file       *os.File
+	generation uint64
+	// logged holds the last event Seq written for each game.
+	logged map[string]uint64
+}
+
+// OpenEventLogStore opens (or creates) an event log in dir and rebuilds every
+// game by replaying it.
+func OpenEventLogStore(dir string) (*EventLogStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, logHistoryDir), 0o755); err != nil {
+		return nil, fmt.Errorf("create event log dir: %w", err)
+	}
+
+	s := &EventLogStore{
+		mem:    NewMemoryStore(),
+		dir:    dir,
+		logged: make(map[string]uint64),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, err
+	}
+	s.removeStaleLogs()
+
+	file, err := os.OpenFile(s.logPath(s.generation), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	s.file = file
+
+	if n := len(s.mem.games); n > 0 {
+		log.Printf("Replayed %d games from event log in %s", n, dir)
+	}
+	return s, nil
+}
+
+// loadSnapshot restores games from the last compaction snapshot, if any.
+func (s *EventLogStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, logSnapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap logSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	s.generation = snap.Generation
+	for _, gs := range snap.Games {
+		s.mem.games[gs.Code] = RestoreGame(gs)
+		s.logged[gs.Code] = gs.Version
+	}
+	return nil
+}
+
+// replayLog applies the current log generation on top of the snapshot and
+// truncates any torn tail.
+func (s *EventLogStore) replayLog() error {
+	path := s.logPath(s.generation)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read event log: %w", err)
+		}
+
+		e, ok := decodeLogRecord(line)
+		if !ok {
+			break
+		}
+		good += int64(len(line))
+		s.replayEvent(e)
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > good {
+		log.Printf("Truncating %d bytes of incomplete records from %s", info.Size()-good, path)
+		if err := os.Truncate(path, good); err != nil {
+			return fmt.Errorf("truncate event log: %w", err)
+		}
+	}
+	return nil
+}
+
+// replayEvent applies a single logged event to the in-memory games.
+func (s *EventLogStore) replayEvent(e Event) {
+	code := e.GameCode
+
+	switch e.Type {
+	case EventGameRemoved:
+		delete(s.mem.games, code)
+		delete(s.logged, code)
+		return
+	case EventGameCreated:
+		g, err := ReplayGame([]Event{e})
+		if err != nil {
+			log.Printf("Skipping event for game %s: %v", code, err)
+			return
+		}
+		s.mem.games[code] = g
+	default:
+		g := s.mem.games[code]
+		if g == nil {
+			return
+		}
+		// Already covered by the snapshot
+		if e.Seq <= g.version {
+			return
+		}
+		if err := g.applyEvent(e); err != nil {
+			log.Printf("Skipping event for game %s: %v", code, err)
+			return
+		}
+	}
+
+	s.logged[code] = e.Seq
+}
+
+// removeStaleLogs deletes log generations other than the current one. Older
+// generations left by a crash during Compact are folded into the game
+// histories first; newer ones were never used.
+func (s *EventLogStore) removeStaleLogs() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	current := filepath.Base(s.logPath(s.generation))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, logFilePrefix) && strings.HasSuffix(name, logFileExt) && name != current {
+			path := filepath.Join(s.dir, name)
+			if name < current {
+				if err := s.foldLog(path); err != nil {
+					log.Printf("Keeping event log %s: %v", name, err)
+					continue
+				}
+			}
+			os.Remove(path)
+		}
+		if strings.HasSuffix(name, tempFileExt) {
+			os.Remove(filepath.Join(s.dir, name))
+		}
+	}
+
+	// Leftovers from a history write interrupted before its rename
+	histories, _ := os.ReadDir(filepath.Join(s.dir, logHistoryDir))
+	for _, entry := range histories {
+		if strings.HasSuffix(entry.Name(), tempFileExt) {
+			os.Remove(filepath.Join(s.dir, logHistoryDir, entry.Name()))
+		}
+	}
+}
+
+// SetCodeScheme changes how codes for new games are generated.
+func (s *EventLogStore) SetCodeScheme(codes CodeScheme) {
+	s.mem.SetCodeScheme(codes)
+}
+
+// Create creates a new game and logs it.
+func (s *EventLogStore) Create(creatorName string) (*Game, *Player, error) {
+	g, player, err := s.mem.Create(creatorName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.Save(g); err != nil {
+		s.mem.Delete(g.Code)
+		return nil, nil, err
+	}
+	return g, player, nil
+}
+
+// Add stores an existing game and logs its full timeline.
+func (s *EventLogStore) Add(g *Game) error {
+	if err := s.mem.Add(g); err != nil {
+		return err
+	}
+	return s.Save(g)
+}
+
+// Get retrieves a game by code.
+func (s *EventLogStore) Get(code string) *Game {
+	return s.mem.Get(code)
+}
+
+// Save appends the events the game recorded since it was last saved.
+func (s *EventLogStore) Save(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Deleted while the caller was working on it; don't bring it back.
+	if s.mem.Get(g.Code) != g {
+		return nil
+	}
+
+	events := g.EventsSince(s.logged[g.Code])
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := s.appendLocked(events...); err != nil {
+		return err
+	}
+	s.logged[g.Code] = events[len(events)-1].Seq
+	return nil
+}
+
+// Delete removes a game and logs its removal.
+func (s *EventLogStore) Delete(code string) {
+	code = NormalizeCode(code)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mem.Get(code) == nil {
+		return
+	}
+	s.mem.Delete(code)
+	s.logRemovalLocked(code)
+}
+
+// History returns a game's folded history followed by the events logged for
+// it in the current generation and any it has added since its last Save.
+func (s *EventLogStore) History(code string) ([]Event, error) {
+	code = NormalizeCode(code)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.mem.Get(code)
+	if g == nil {
+		return nil, nil
+	}
+
+	events, _, err := readHistory(s.historyPath(code))
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	logged, _, err := readRecords(s.logPath(s.generation))
+	if err != nil {
+		return nil, fmt.Errorf("read event log: %w", err)
+	}
+	for _, e := range logged {
+		if e.GameCode == code {
+			events, _ = nextHistory(events, e)
+		}
+	}
+	return append(events, g.EventsSince(lastSeq(events))...), nil
+}
+
+// Count returns the number of games in the store.
+func (s *EventLogStore) Count() int {
+	return s.mem.Count()
+}
+
+// GetAll returns all games in the store.
+func (s *EventLogStore) GetAll() []*Game {
+	return s.mem.GetAll()
+}
+
+// ExpireGames removes idle games and logs their removal.
+func (s *EventLogStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	removed := s.mem.expire(policy, onExpire)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, code := range removed {
+		// A new game may already have taken the code
+		if s.mem.Get(code) == nil {
+			s.logRemovalLocked(code)
+		}
+	}
+	return len(removed)
+}
+
+// Compact writes a snapshot of every game and starts a new, empty log
+// generation. The old generation is deleted once the snapshot is durable.
+func (s *EventLogStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.generation + 1
+
+	// Create the next log before the snapshot that points to it.
+	if err := writeFileAtomic(s.logPath(next), nil); err != nil {
+		return fmt.Errorf("create event log: %w", err)
+	}
+
+	games := s.mem.GetAll()
+	snap := logSnapshot{
+		Generation: next,
+		Time:       time.Now(),
+		Games:      make([]GameSnapshot, len(games)),
+	}
+	for i, g := range games {
+		snap.Games[i] = g.Snapshot()
+	}
+
+	// Log what the snapshot covers but no Save has yet, so the old
+	// generation holds every event folded into the histories.
+	for i, g := range games {
+		var pending []Event
+		for _, e := range g.EventsSince(s.logged[g.Code]) {
+			if e.Seq <= snap.Games[i].Version {
+				pending = append(pending, e)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		if err := s.appendLocked(pending...); err != nil {
+			return fmt.Errorf("write event log: %w", err)
+		}
+		s.logged[g.Code] = lastSeq(pending)
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, logSnapshotFile), data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	file, err := os.OpenFile(s.logPath(next), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+
+	// Without its history the old generation is kept, to be folded on open.
+	s.file.Close()
+	if err := s.foldLog(s.logPath(s.generation)); err != nil {
+		log.Printf("Error folding event log into game histories: %v", err)
+	} else {
+		os.Remove(s.logPath(s.generation))
+	}
+	s.file = file
+	s.generation = next
+
+	s.logged = make(map[string]uint64, len(snap.Games))
+	for _, gs := range snap.Games {
+		s.logged[gs.Code] = gs.Version
+	}
+	return nil
+}
+
+// StartCompactionRoutine periodically compacts the log until stop is closed.
+func (s *EventLogStore) StartCompactionRoutine(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				log.Printf("Error compacting event log: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close compacts the log one last time and closes it.
+func (s *EventLogStore) Close() error {
+	if err := s.Compact(); err != nil {
+		log.Printf("Error compacting event log: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// foldLog merges the events of a log generation into each game's history
+// file.
+func (s *EventLogStore) foldLog(path string) error {
+	logged, _, err := readRecords(path)
+	if err != nil {
+		return err
+	}
+
+	type timeline struct {
+		events []Event
+		reset  bool
+	}
+	timelines := make(map[string]*timeline)
+	for _, e := range logged {
+		t := timelines[e.GameCode]
+		if t == nil {
+			t = &timeline{}
+			timelines[e.GameCode] = t
+		}
+		var reset bool
+		t.events, reset = nextHistory(t.events, e)
+		t.reset = t.reset || reset
+	}
+
+	for code, t := range timelines {
+		path := s.historyPath(code)
+		if t.reset && t.events == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		events := t.events
+		if !t.reset {
+			history, _, err := readHistory(path)
+			if err != nil {
+				return err
+			}
+			for _, e := range t.events {
+				history = appendHistory(history, e)
+			}
+			events = history
+		}
+
+		data, err := encodeEvents(events)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logRemovalLocked appends a removal record. Callers must hold mu.
+func (s *EventLogStore) logRemovalLocked(code string) {
+	delete(s.logged, code)
+	err := s.appendLocked(Event{GameCode: code, Type: EventGameRemoved, Time: time.Now()})
+	if err != nil {
+		log.Printf("Error logging removal of game %s: %v", code, err)
+	}
+}
+
+// appendLocked writes events to the log and fsyncs it. Callers must hold mu.
+func (s *EventLogStore) appendLocked(events ...Event) error {
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(data); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *EventLogStore) logPath(generation uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", logFilePrefix, generation, logFileExt))
+}
+
+func (s *EventLogStore) historyPath(code string) string {
+	return filepath.Join(s.dir, logHistoryDir, filepath.Base(code)+logFileExt)
+}
+
+// encodeRecord frames data as a "<crc> <data>\n" log line.
+func encodeRecord(data []byte) []byte {
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data))
+}
+
+// decodeRecord parses a line written by encodeRecord, reporting false if it
+// is incomplete or fails its checksum.
+func decodeRecord(line []byte) ([]byte, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return nil, false
+	}
+
+	var sum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &sum); err != nil {
+		return nil, false
+	}
+	data := line[9:]
+	if crc32.ChecksumIEEE(data) != sum {
+		return nil, false
+	}
+	return data, true
+}
+
+// decodeLogRecord parses an event log line, reporting false if it is
+// incomplete or corrupt.
+func decodeLogRecord(line []byte) (Event, bool) {
+	data, ok := decodeRecord(line)
+	if !ok {
+		return Event{}, false
+	}
+
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Event{}, false
+	}
+	return e, true
+}
@@ -0,0 +1,164 @@
+package game
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// playRace creates a started two-player game in store with a few rolls saved.
+func playRace(t *testing.T, store Store) *Game {
+	t.Helper()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+	g.SetPlayerConnected(bob.ID, false)
+	g.SetPlayerConnected(bob.ID, true)
+	for i := 0; i < 5; i++ {
+		g.RollDice(alice.ID)
+		g.RollDice(bob.ID)
+	}
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return g
+}
+
+func assertSameGame(t *testing.T, want, got *Game) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Game should have been replayed")
+	}
+	ws, gs := want.Snapshot(), got.Snapshot()
+	if gs.Version != ws.Version {
+		t.Errorf("Expected version %d, got %d", ws.Version, gs.Version)
+	}
+	if gs.Status != ws.Status {
+		t.Errorf("Expected status %s, got %s", ws.Status, gs.Status)
+	}
+	if len(gs.Players) != len(ws.Players) {
+		t.Fatalf("Expected %d players, got %d", len(ws.Players), len(gs.Players))
+	}
+	for i := range ws.Players {
+		// Times lose their monotonic reading and location when serialized
+		if !gs.Players[i].JoinedAt.Equal(ws.Players[i].JoinedAt) {
+			t.Errorf("Player %d JoinedAt mismatch", i)
+		}
+		ws.Players[i].JoinedAt, gs.Players[i].JoinedAt = time.Time{}, time.Time{}
+		if gs.Players[i] != ws.Players[i] {
+			t.Errorf("Player %d mismatch: want %+v, got %+v", i, ws.Players[i], gs.Players[i])
+		}
+	}
+	if gs.MoveCount != ws.MoveCount || !gs.StartedAt.Equal(ws.StartedAt) {
+		t.Errorf("Expected %d moves from %v, got %d from %v", ws.MoveCount, ws.StartedAt, gs.MoveCount, gs.StartedAt)
+	}
+}
+
+func TestEventLogStoreReplaysOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenEventLogStore(dir)
+	g := playRace(t, store)
+
+	// Reopen without closing, as after kill -9
+	reopened, err := OpenEventLogStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	assertSameGame(t, g, reopened.Get(g.Code))
+	if got := reopened.Get(g.Code).Events(); len(got) != len(g.Events()) {
+		t.Errorf("Expected %d events, got %d", len(g.Events()), len(got))
+	}
+}
+
+func TestEventLogStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenEventLogStore(dir)
+	g := playRace(t, store)
+	removed, _, _ := store.Create("Zed")
+
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// Events after the snapshot land in the new generation
+	g.RollDice(g.CreatorID)
+	store.Save(g)
+	store.Delete(removed.Code)
+
+	entries, _ := os.ReadDir(dir)
+	logs := 0
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() != logSnapshotFile {
+			logs++
+		}
+	}
+	if logs != 1 {
+		t.Errorf("Expected a single log generation after compaction, found %d files", logs)
+	}
+
+	reopened, err := OpenEventLogStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	assertSameGame(t, g, reopened.Get(g.Code))
+	// The snapshot carries no timeline; only the roll after it is replayed
+	if got := reopened.Get(g.Code).Events(); len(got) != 1 || got[0].Seq != g.Version() {
+		t.Errorf("Expected only the event after the snapshot, got %d events", len(got))
+	}
+	// The replay history still covers the whole game
+	history, err := reopened.History(g.Code)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	assertFullHistory(t, g, history)
+	if reopened.Get(removed.Code) != nil {
+		t.Error("Game deleted after the snapshot should stay deleted")
+	}
+}
+
+func TestEventLogStoreTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenEventLogStore(dir)
+	g := playRace(t, store)
+
+	// Simulate a crash in the middle of writing a record
+	f, _ := os.OpenFile(store.logPath(store.generation), os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`0badc0de {"seq":99,"gameCode":"` + g.Code)
+	f.Close()
+
+	reopened, err := OpenEventLogStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	assertSameGame(t, g, reopened.Get(g.Code))
+
+	// New writes after the truncation must replay cleanly
+	reopened.Get(g.Code).RollDice(g.CreatorID)
+	reopened.Save(reopened.Get(g.Code))
+
+	again, _ := OpenEventLogStore(dir)
+	assertSameGame(t, reopened.Get(g.Code), again.Get(g.Code))
+}
+
+func TestReplayGameMatchesLiveState(t *testing.T) {
+	store := NewMemoryStore()
+	g := playRace(t, store)
+
+	replayed, err := ReplayGame(g.Events())
+	if err != nil {
+		t.Fatalf("ReplayGame failed: %v", err)
+	}
+	assertSameGame(t, g, replayed)
+}
+
+func TestReplayGameRejectsGaps(t *testing.T) {
+	g, _ := NewGame("Alice")
+	g.AddPlayer("Bob")
+	g.AddPlayer("Carol")
+
+	events := g.Events()
+	_, err := ReplayGame([]Event{events[0], events[2]})
+	if err == nil {
+		t.Error("Expected an error for a gap in the timeline")
+	}
+}
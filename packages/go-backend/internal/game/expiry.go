@@ -0,0 +1,29 @@
+package game
+
+import "time"
+
+// ExpiryPolicy sets how long a game may go without activity before it is
+// removed, per status. Activity is measured from the game's UpdatedAt.
+type ExpiryPolicy struct {
+	WaitingTTL  time.Duration
+	PlayingTTL  time.Duration
+	FinishedTTL time.Duration
+}
+
+// TTL returns the idle time allowed for a game in the given status.
+func (p ExpiryPolicy) TTL(status string) time.Duration {
+	switch status {
+	case StatusWaiting:
+		return p.WaitingTTL
+	case StatusPlaying:
+		return p.PlayingTTL
+	default:
+		return p.FinishedTTL
+	}
+}
+
+// Expired reports whether the game has been idle longer than its status allows.
+func (p ExpiryPolicy) Expired(g *Game, now time.Time) bool {
+	status, updatedAt := g.activity()
+	return now.Sub(updatedAt) > p.TTL(status)
+}
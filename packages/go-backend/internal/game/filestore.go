@@ -0,0 +1,315 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	gameFileExt    = ".json"
+	historyFileExt = ".events"
+	tempFileExt    = ".tmp"
+)
+
+// FileStore is a durable Store that keeps one JSON file per game in a data
+// directory. Games are served from memory and written through on Save.
+//
+// Each write goes to a temporary file that is fsynced and then renamed over
+// the previous version, so a crash (even kill -9) leaves either the old or the
+// new snapshot on disk, never a partial one.
+//
+// Next to each snapshot, Save appends the game's new events to a history file
+// that keeps its full timeline for replay.
+type FileStore struct {
+	mem *MemoryStore
+	dir string
+
+	// writeMu serializes disk writes and guards written.
+	writeMu sync.Mutex
+	// written holds the last persisted version of each game.
+	written map[string]uint64
+}
+
+// OpenFileStore opens (or creates) a file store in dir and loads every game
+// found there.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	s := &FileStore{
+		mem:     NewMemoryStore(),
+		dir:     dir,
+		written: make(map[string]uint64),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads all game files from disk into memory.
+func (s *FileStore) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read data dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(s.dir, name)
+
+		if entry.IsDir() {
+			continue
+		}
+
+		// Leftovers from a write interrupted before its rename
+		if strings.HasSuffix(name, tempFileExt) {
+			os.Remove(path)
+			continue
+		}
+
+		if !strings.HasSuffix(name, gameFileExt) {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Skipping game file %s: %v", name, err)
+			continue
+		}
+
+		var snap GameSnapshot
+		if err := json.Unmarshal(data, &snap); err != nil || snap.Code == "" {
+			log.Printf("Skipping unreadable game file %s: %v", name, err)
+			continue
+		}
+
+		s.mem.games[snap.Code] = RestoreGame(snap)
+		s.written[snap.Code] = snap.Version
+		s.repairHistory(snap.Code)
+	}
+
+	if n := len(s.mem.games); n > 0 {
+		log.Printf("Loaded %d games from %s", n, s.dir)
+	}
+	return nil
+}
+
+// repairHistory truncates a torn tail left in a game's history file by a
+// crash, so later appends stay readable.
+func (s *FileStore) repairHistory(code string) {
+	path := s.historyPath(code)
+	_, good, err := readHistory(path)
+	if err != nil {
+		log.Printf("Error reading history of game %s: %v", code, err)
+		return
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > good {
+		log.Printf("Truncating %d bytes of incomplete records from %s", info.Size()-good, path)
+		if err := os.Truncate(path, good); err != nil {
+			log.Printf("Error truncating history of game %s: %v", code, err)
+		}
+	}
+}
+
+// SetCodeScheme changes how codes for new games are generated.
+func (s *FileStore) SetCodeScheme(codes CodeScheme) {
+	s.mem.SetCodeScheme(codes)
+}
+
+// Create creates a new game and persists it.
+func (s *FileStore) Create(creatorName string) (*Game, *Player, error) {
+	g, player, err := s.mem.Create(creatorName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.Save(g); err != nil {
+		s.mem.Delete(g.Code)
+		return nil, nil, err
+	}
+	return g, player, nil
+}
+
+// Add stores an existing game and persists it.
+func (s *FileStore) Add(g *Game) error {
+	if err := s.mem.Add(g); err != nil {
+		return err
+	}
+	return s.Save(g)
+}
+
+// Get retrieves a game by code.
+func (s *FileStore) Get(code string) *Game {
+	return s.mem.Get(code)
+}
+
+// Save writes the game's current state to disk if it changed since the last write.
+func (s *FileStore) Save(g *Game) error {
+	snap := g.Snapshot()
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// Deleted while the caller was working on it; don't bring it back.
+	if s.mem.Get(snap.Code) != g {
+		return nil
+	}
+
+	// A concurrent Save already wrote this version or a newer one.
+	v, ok := s.written[snap.Code]
+	if ok && snap.Version <= v {
+		return nil
+	}
+
+	// The history goes first, so it never falls behind the snapshot. A game
+	// new to the disk starts a fresh one in case its code was used before.
+	events := g.EventsSince(v)
+	if !ok {
+		data, err := encodeEvents(events)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.historyPath(snap.Code), data); err != nil {
+			return err
+		}
+	} else if len(events) > 0 {
+		if err := appendHistoryFile(s.historyPath(snap.Code), events); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.gamePath(snap.Code), data); err != nil {
+		return err
+	}
+
+	s.written[snap.Code] = snap.Version
+	return nil
+}
+
+// Delete removes a game from memory and disk.
+func (s *FileStore) Delete(code string) {
+	code = NormalizeCode(code)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mem.Delete(code)
+	s.removeFileLocked(code)
+}
+
+// History returns a game's timeline from its history file, followed by any
+// events it has added since its last Save.
+func (s *FileStore) History(code string) ([]Event, error) {
+	code = NormalizeCode(code)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	g := s.mem.Get(code)
+	if g == nil {
+		return nil, nil
+	}
+	events, _, err := readHistory(s.historyPath(code))
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return append(events, g.EventsSince(lastSeq(events))...), nil
+}
+
+// removeFileLocked deletes a game's files. Callers must hold writeMu.
+func (s *FileStore) removeFileLocked(code string) {
+	delete(s.written, code)
+	if err := os.Remove(s.gamePath(code)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing game file for %s: %v", code, err)
+	}
+	if err := os.Remove(s.historyPath(code)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing history file for %s: %v", code, err)
+	}
+}
+
+// Count returns the number of games in the store.
+func (s *FileStore) Count() int {
+	return s.mem.Count()
+}
+
+// GetAll returns all games in the store.
+func (s *FileStore) GetAll() []*Game {
+	return s.mem.GetAll()
+}
+
+// ExpireGames removes idle games from memory and disk.
+func (s *FileStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	removed := s.mem.expire(policy, onExpire)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	for _, code := range removed {
+		// A new game may already have taken the code
+		if s.mem.Get(code) == nil {
+			s.removeFileLocked(code)
+		}
+	}
+	return len(removed)
+}
+
+// Close is a no-op: every Save is already flushed to disk.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) gamePath(code string) string {
+	return filepath.Join(s.dir, filepath.Base(code)+gameFileExt)
+}
+
+func (s *FileStore) historyPath(code string) string {
+	return filepath.Join(s.dir, filepath.Base(code)+historyFileExt)
+}
+
+// writeFileAtomic writes data to path via a fsynced temporary file and rename.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*"+tempFileExt)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Persist the rename itself. Not every platform supports syncing a
+	// directory, so failures here are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
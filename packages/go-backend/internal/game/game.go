@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 	"sync"
@@ -40,28 +41,34 @@ type Game struct {
 	WinnerID       string
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+
+	// version is the Seq of the last applied event.
+	version uint64
+	// events is the recent end of the game's timeline, oldest first. It
+	// holds at least the last MaxDeltaEvents events.
+	events []Event
+
+	// startedAt, finishedAt and moveCount summarize the whole timeline for
+	// the archive, since events no longer reaches back to the start.
+	startedAt  time.Time
+	finishedAt time.Time
+	moveCount  int
 }
 
 // NewGame creates a new game with a random code and the creator as the first player.
 func NewGame(creatorName string) (*Game, *Player) {
-	code := generateGameCode()
-	playerID := generatePlayerID()
-	now := time.Now()
-
-	player := NewPlayer(playerID, creatorName, 0)
-
-	game := &Game{
-		Code:           code,
-		Status:         StatusWaiting,
-		CreatorID:      playerID,
-		Board:          DefaultBoard(),
-		Players:        []*Player{player},
-		CurrentTurnIdx: 0,
-		CreatedAt:      now,
-		UpdatedAt:      now,
-	}
+	return NewGameWithCode(generateGameCode(), creatorName)
+}
+
+// NewGameWithCode creates a new game with the given code and the creator as the first player.
+func NewGameWithCode(code, creatorName string) (*Game, *Player) {
+	game := &Game{Code: code}
+	game.emit(EventGameCreated, &GameCreatedData{
+		Creator: *NewPlayer(generatePlayerID(), creatorName, 0),
+		Board:   DefaultBoard(),
+	})
 
-	return game, player
+	return game, game.Players[0]
 }
 
 // ErrInvalidName is returned when a player name is invalid.
@@ -88,10 +95,9 @@ func (g *Game) AddPlayer(name string) (*Player, error) {
 
 	playerID := generatePlayerID()
 	player := NewPlayer(playerID, name, len(g.Players))
-	g.Players = append(g.Players, player)
-	g.UpdatedAt = time.Now()
+	g.emit(EventPlayerAdded, &PlayerAddedData{Player: *player})
 
-	return player, nil
+	return g.Players[len(g.Players)-1], nil
 }
 
 // GetPlayer returns a player by ID.
@@ -112,14 +118,28 @@ func (g *Game) SetPlayerConnected(playerID string, connected bool) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	if g.findPlayer(playerID) == nil {
+		return ErrPlayerNotFound
+	}
+
+	g.emit(EventConnectionChanged, &ConnectionChangedData{PlayerID: playerID, Connected: connected})
+	return nil
+}
+
+// ResetConnections marks every connected player as disconnected, e.g. after a
+// server restart when no client sockets survive. It reports whether anything changed.
+func (g *Game) ResetConnections() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	changed := false
 	for _, p := range g.Players {
-		if p.ID == playerID {
-			p.IsConnected = connected
-			g.UpdatedAt = time.Now()
-			return nil
+		if p.IsConnected {
+			g.emit(EventConnectionChanged, &ConnectionChangedData{PlayerID: p.ID, Connected: false})
+			changed = true
 		}
 	}
-	return ErrPlayerNotFound
+	return changed
 }
 
 // Start begins the game.
@@ -135,12 +155,7 @@ func (g *Game) Start(playerID string) error {
 		return ErrNotGameCreator
 	}
 
-	g.Status = StatusPlaying
-	g.CurrentTurnIdx = 0
-	for _, p := range g.Players {
-		p.Position = 1
-	}
-	g.UpdatedAt = time.Now()
+	g.emit(EventGameStarted, &GameStartedData{PlayerID: playerID})
 	return nil
 }
 
@@ -156,14 +171,7 @@ func (g *Game) RollDice(playerID string) (diceRoll, prevPos, newPos int, effect
 	}
 
 	// Find player - no turn check, this is a race!
-	var player *Player
-	for _, p := range g.Players {
-		if p.ID == playerID {
-			player = p
-			break
-		}
-	}
-
+	player := g.findPlayer(playerID)
 	if player == nil {
 		err = ErrPlayerNotFound
 		return
@@ -176,21 +184,143 @@ func (g *Game) RollDice(playerID string) (diceRoll, prevPos, newPos int, effect
 
 	// Process move
 	result := g.Board.ProcessMove(player.Position, diceRoll)
-	player.Position = result.NewPosition
 	newPos = result.NewPosition
 	effect = result.Effect
 	isWinner = result.IsWinner
 
+	g.emit(EventDiceRolled, &DiceRolledData{
+		PlayerID: playerID,
+		DiceRoll: diceRoll,
+		From:     prevPos,
+		To:       newPos,
+		Effect:   effect,
+	})
 	if isWinner {
-		g.Status = StatusFinished
-		g.WinnerID = playerID
+		g.emit(EventGameFinished, &GameFinishedData{WinnerID: playerID})
 	}
 	// No turn advancement - everyone races independently!
 
-	g.UpdatedAt = time.Now()
 	return
 }
 
+// findPlayer returns the live player with the given ID. Callers must hold the lock.
+func (g *Game) findPlayer(playerID string) *Player {
+	for _, p := range g.Players {
+		if p.ID == playerID {
+			return p
+		}
+	}
+	return nil
+}
+
+// emit records a new event on the game's timeline and applies it.
+// Callers must hold the write lock.
+func (g *Game) emit(eventType string, data EventData) {
+	e := Event{
+		Seq:      g.version + 1,
+		GameCode: g.Code,
+		Type:     eventType,
+		Time:     time.Now(),
+		Data:     data,
+	}
+	// Events built here always follow the current version.
+	g.applyEvent(e)
+}
+
+// applyEvent applies an event to the game state and appends it to the
+// timeline. It is shared by live mutations and replay so both paths produce
+// the same state. Callers must hold the write lock (or own the game exclusively).
+func (g *Game) applyEvent(e Event) error {
+	if e.Seq != g.version+1 {
+		return fmt.Errorf("%w: game %s at version %d, got seq %d", ErrEventOutOfOrder, g.Code, g.version, e.Seq)
+	}
+
+	switch d := e.Data.(type) {
+	case *GameCreatedData:
+		creator := d.Creator
+		g.Code = e.GameCode
+		g.Status = StatusWaiting
+		g.CreatorID = creator.ID
+		g.Board = d.Board
+		g.Players = []*Player{&creator}
+		g.CurrentTurnIdx = 0
+		g.CreatedAt = e.Time
+	case *PlayerAddedData:
+		player := d.Player
+		g.Players = append(g.Players, &player)
+	case *ConnectionChangedData:
+		if p := g.findPlayer(d.PlayerID); p != nil {
+			p.IsConnected = d.Connected
+		}
+	case *GameStartedData:
+		g.Status = StatusPlaying
+		g.CurrentTurnIdx = 0
+		for _, p := range g.Players {
+			p.Position = 1
+		}
+		g.startedAt = e.Time
+	case *DiceRolledData:
+		if p := g.findPlayer(d.PlayerID); p != nil {
+			p.Position = d.To
+		}
+		g.moveCount++
+	case *GameFinishedData:
+		g.Status = StatusFinished
+		g.WinnerID = d.WinnerID
+		g.finishedAt = e.Time
+	default:
+		return fmt.Errorf("cannot apply %s event to game %s", e.Type, g.Code)
+	}
+
+	g.version = e.Seq
+	g.UpdatedAt = e.Time
+	g.events = append(g.events, e)
+	// Trimmed in batches so appending stays cheap
+	if len(g.events) >= 2*MaxDeltaEvents {
+		g.events = append([]Event(nil), g.events[len(g.events)-MaxDeltaEvents:]...)
+	}
+	return nil
+}
+
+// Events returns a copy of the recent end of the game's event timeline: at
+// least its last MaxDeltaEvents events, or all of them for a shorter game.
+func (g *Game) Events() []Event {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	events := make([]Event, len(g.events))
+	copy(events, g.events)
+	return events
+}
+
+// EventsSince returns the events with a Seq greater than seq that are still on
+// the timeline.
+func (g *Game) EventsSince(seq uint64) []Event {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if seq >= g.version {
+		return nil
+	}
+
+	// Timelines restored from a snapshot may not start at Seq 1.
+	start := 0
+	for start < len(g.events) && g.events[start].Seq <= seq {
+		start++
+	}
+
+	events := make([]Event, len(g.events)-start)
+	copy(events, g.events[start:])
+	return events
+}
+
+// Version returns the Seq of the last event applied to the game.
+func (g *Game) Version() uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.version
+}
+
 // GetCurrentTurnPlayerID returns the ID of the player whose turn it is.
 func (g *Game) GetCurrentTurnPlayerID() string {
 	g.mu.RLock()
@@ -229,6 +359,20 @@ func (g *Game) GetCreatedAt() time.Time {
 	return g.CreatedAt
 }
 
+// GetUpdatedAt returns when the game last changed.
+func (g *Game) GetUpdatedAt() time.Time {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.UpdatedAt
+}
+
+// activity returns the status and last update time under a single lock.
+func (g *Game) activity() (string, time.Time) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.Status, g.UpdatedAt
+}
+
 // GetInfo returns a snapshot of the game state for serialization.
 func (g *Game) GetInfo() (code, status, creatorID, winnerID string, board *Board, createdAt, updatedAt time.Time) {
 	g.mu.RLock()
@@ -236,16 +380,9 @@ func (g *Game) GetInfo() (code, status, creatorID, winnerID string, board *Board
 	return g.Code, g.Status, g.CreatorID, g.WinnerID, g.Board, g.CreatedAt, g.UpdatedAt
 }
 
-// generateGameCode creates a 6-character alphanumeric code.
-// Excludes confusing characters: I, L, O, 0, 1
+// generateGameCode creates a code using the default scheme.
 func generateGameCode() string {
-	const chars = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
-	code := make([]byte, 6)
-	for i := range code {
-		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
-		code[i] = chars[n.Int64()]
-	}
-	return string(code)
+	return DefaultCodes.Generate()
 }
 
 // generatePlayerID creates a unique player ID.
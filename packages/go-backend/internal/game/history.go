@@ -0,0 +1,123 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// History files hold a game's full event timeline for replay, one record per
+// event in the same framing as the event log. Games themselves only keep
+// their recent events.
+
+// readHistory reads the timeline in a history file, stopping at the first
+// incomplete or corrupt record. It also returns the length of the readable
+// prefix so a torn tail can be truncated. A missing file has no events.
+func readHistory(path string) ([]Event, int64, error) {
+	records, good, err := readRecords(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var events []Event
+	for _, e := range records {
+		events = appendHistory(events, e)
+	}
+	return events, good, nil
+}
+
+// readRecords reads the events in a log or history file as written, up to
+// the first incomplete or corrupt record.
+func readRecords(path string) ([]Event, int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var events []Event
+	var good int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e, ok := decodeLogRecord(line)
+		if !ok {
+			break
+		}
+		good += int64(len(line))
+		events = append(events, e)
+	}
+	return events, good, nil
+}
+
+// appendHistory adds e to the end of a timeline. An event that repeats or
+// goes back on an earlier Seq replaces it and everything after it, so
+// records rewritten after a crash win over the ones they supersede.
+func appendHistory(history []Event, e Event) []Event {
+	n := len(history)
+	for n > 0 && history[n-1].Seq >= e.Seq {
+		n--
+	}
+	return append(history[:n], e)
+}
+
+// nextHistory adds a logged event to a game's timeline. Creating a game
+// starts its timeline over and removing it ends it; reset reports whether
+// either happened, so the earlier timeline no longer applies.
+func nextHistory(history []Event, e Event) (events []Event, reset bool) {
+	switch e.Type {
+	case EventGameRemoved:
+		return nil, true
+	case EventGameCreated:
+		return []Event{e}, true
+	default:
+		return appendHistory(history, e), false
+	}
+}
+
+// encodeEvents frames events as log records.
+func encodeEvents(events []Event) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodeRecord(data))
+	}
+	return buf.Bytes(), nil
+}
+
+// appendHistoryFile appends events to a history file and fsyncs it.
+func appendHistoryFile(path string, events []Event) error {
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
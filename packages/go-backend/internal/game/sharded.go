@@ -0,0 +1,126 @@
+package game
+
+import "sync/atomic"
+
+// DefaultShardCount is the number of shards used when none is configured.
+const DefaultShardCount = 32
+
+// ShardedStore is an in-memory Store that spreads games over independently
+// locked shards keyed by a hash of the game code. Lookups for different games
+// rarely contend, and expiry scans one shard at a time without holding any
+// shard lock while it inspects games.
+type ShardedStore struct {
+	shards []*MemoryStore
+	codes  atomic.Value // CodeScheme
+}
+
+// NewShardedStore creates an in-memory store with n shards.
+func NewShardedStore(n int) *ShardedStore {
+	if n <= 0 {
+		n = DefaultShardCount
+	}
+
+	s := &ShardedStore{shards: make([]*MemoryStore, n)}
+	for i := range s.shards {
+		s.shards[i] = NewMemoryStore()
+	}
+	s.SetCodeScheme(DefaultCodes)
+	return s
+}
+
+// SetCodeScheme changes how codes for new games are generated.
+func (s *ShardedStore) SetCodeScheme(codes CodeScheme) {
+	s.codes.Store(&codes)
+}
+
+// shard returns the shard that owns a normalized code. The code is hashed
+// with 32-bit FNV-1a, inlined to keep lookups allocation-free.
+func (s *ShardedStore) shard(code string) *MemoryStore {
+	h := uint32(2166136261)
+	for i := 0; i < len(code); i++ {
+		h ^= uint32(code[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+// Create creates a new game and stores it. Each candidate code is checked and
+// claimed under the lock of the shard that owns it.
+func (s *ShardedStore) Create(creatorName string) (*Game, *Player, error) {
+	codes := *s.codes.Load().(*CodeScheme)
+
+	for i := 0; i < maxCodeAttempts; i++ {
+		code := NormalizeCode(codes.Generate())
+		if code == "" {
+			continue
+		}
+		if game, player, ok := s.shard(code).createWithCode(code, creatorName); ok {
+			return game, player, nil
+		}
+	}
+	return nil, nil, ErrNoFreeCode
+}
+
+// Add stores an existing game.
+func (s *ShardedStore) Add(g *Game) error {
+	return s.shard(g.Code).Add(g)
+}
+
+// Get retrieves a game by code, ignoring case.
+func (s *ShardedStore) Get(code string) *Game {
+	code = NormalizeCode(code)
+	shard := s.shard(code)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.games[code]
+}
+
+// Save records the game's new events in its shard's history.
+func (s *ShardedStore) Save(g *Game) error {
+	return s.shard(g.Code).Save(g)
+}
+
+// Delete removes a game from the store.
+func (s *ShardedStore) Delete(code string) {
+	code = NormalizeCode(code)
+	s.shard(code).Delete(code)
+}
+
+// History returns a game's full event timeline from its shard.
+func (s *ShardedStore) History(code string) ([]Event, error) {
+	code = NormalizeCode(code)
+	return s.shard(code).History(code)
+}
+
+// Count returns the number of games in the store.
+func (s *ShardedStore) Count() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Count()
+	}
+	return n
+}
+
+// GetAll returns all games in the store.
+func (s *ShardedStore) GetAll() []*Game {
+	var games []*Game
+	for _, shard := range s.shards {
+		games = append(games, shard.GetAll()...)
+	}
+	return games
+}
+
+// ExpireGames removes idle games, one shard at a time.
+func (s *ShardedStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.ExpireGames(policy, onExpire)
+	}
+	return removed
+}
+
+// Close is a no-op for the in-memory store.
+func (s *ShardedStore) Close() error {
+	return nil
+}
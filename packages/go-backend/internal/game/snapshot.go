@@ -0,0 +1,129 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// GameSnapshot is a serializable copy of a game's state. It leaves out the
+// event timeline, so a restored game starts a new one.
+type GameSnapshot struct {
+	Code           string    `json:"code"`
+	Status         string    `json:"status"`
+	CreatorID      string    `json:"creatorId"`
+	Board          *Board    `json:"board"`
+	Players        []Player  `json:"players"`
+	CurrentTurnIdx int       `json:"currentTurnIdx"`
+	WinnerID       string    `json:"winnerId,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Version        uint64    `json:"version"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+	MoveCount      int       `json:"moveCount,omitempty"`
+}
+
+// Snapshot returns a copy of the game state that is safe to serialize.
+func (g *Game) Snapshot() GameSnapshot {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	players := make([]Player, len(g.Players))
+	for i, p := range g.Players {
+		players[i] = *p
+	}
+
+	return GameSnapshot{
+		Code:           g.Code,
+		Status:         g.Status,
+		CreatorID:      g.CreatorID,
+		Board:          g.Board,
+		Players:        players,
+		CurrentTurnIdx: g.CurrentTurnIdx,
+		WinnerID:       g.WinnerID,
+		CreatedAt:      g.CreatedAt,
+		UpdatedAt:      g.UpdatedAt,
+		Version:        g.version,
+		StartedAt:      g.startedAt,
+		FinishedAt:     g.finishedAt,
+		MoveCount:      g.moveCount,
+	}
+}
+
+// RestoreGame rebuilds a game from a snapshot.
+func RestoreGame(s GameSnapshot) *Game {
+	players := make([]*Player, len(s.Players))
+	for i := range s.Players {
+		p := s.Players[i]
+		players[i] = &p
+	}
+
+	board := s.Board
+	if board == nil {
+		board = DefaultBoard()
+	}
+
+	return &Game{
+		Code:           s.Code,
+		Status:         s.Status,
+		CreatorID:      s.CreatorID,
+		Board:          board,
+		Players:        players,
+		CurrentTurnIdx: s.CurrentTurnIdx,
+		WinnerID:       s.WinnerID,
+		CreatedAt:      s.CreatedAt,
+		UpdatedAt:      s.UpdatedAt,
+		version:        s.Version,
+		startedAt:      s.StartedAt,
+		finishedAt:     s.FinishedAt,
+		moveCount:      s.MoveCount,
+	}
+}
+
+// snapshotFile is the on-disk format written by WriteSnapshotFile.
+type snapshotFile struct {
+	SavedAt time.Time      `json:"savedAt"`
+	Games   []GameSnapshot `json:"games"`
+}
+
+// WriteSnapshotFile atomically writes the state of the given games to path.
+func WriteSnapshotFile(path string, games []*Game) error {
+	file := snapshotFile{
+		SavedAt: time.Now(),
+		Games:   make([]GameSnapshot, len(games)),
+	}
+	for i, g := range games {
+		file.Games[i] = g.Snapshot()
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// ReadSnapshotFile loads the games written by WriteSnapshotFile. A missing
+// file yields no games and no error.
+func ReadSnapshotFile(path string) ([]*Game, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode snapshot file: %w", err)
+	}
+
+	games := make([]*Game, len(file.Games))
+	for i, gs := range file.Games {
+		games[i] = RestoreGame(gs)
+	}
+	return games, nil
+}
@@ -0,0 +1,61 @@
+package game
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	store := NewMemoryStore()
+	g := playRace(t, store)
+	waiting, _, _ := store.Create("Zed")
+
+	if err := WriteSnapshotFile(path, store.GetAll()); err != nil {
+		t.Fatalf("WriteSnapshotFile failed: %v", err)
+	}
+
+	games, err := ReadSnapshotFile(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshotFile failed: %v", err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("Expected 2 games, got %d", len(games))
+	}
+
+	byCode := make(map[string]*Game)
+	for _, rg := range games {
+		byCode[rg.Code] = rg
+	}
+	assertSameGame(t, g, byCode[g.Code])
+	if byCode[waiting.Code].GetStatus() != StatusWaiting {
+		t.Errorf("Expected waiting game to stay waiting")
+	}
+}
+
+func TestReadSnapshotFileMissing(t *testing.T) {
+	games, err := ReadSnapshotFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Errorf("Missing snapshot should not error: %v", err)
+	}
+	if len(games) != 0 {
+		t.Errorf("Expected no games, got %d", len(games))
+	}
+}
+
+func TestResetConnections(t *testing.T) {
+	g, alice := NewGame("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.SetPlayerConnected(bob.ID, false)
+
+	if !g.ResetConnections() {
+		t.Error("ResetConnections should report a change")
+	}
+	if g.GetPlayer(alice.ID).IsConnected {
+		t.Error("Alice should be disconnected")
+	}
+	if g.ResetConnections() {
+		t.Error("Second ResetConnections should report no change")
+	}
+}
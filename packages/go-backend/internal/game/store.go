@@ -1,57 +1,184 @@
 package game
 
 import (
+	"errors"
+	"log"
 	"sync"
 	"time"
 )
 
-// Store provides thread-safe in-memory game storage.
-type Store struct {
+// ErrGameExists is returned when adding a game whose code is already in use.
+var ErrGameExists = errors.New("game already exists")
+
+// Store is the game persistence interface used by the handlers.
+//
+// Games returned by a Store are live objects: callers mutate them through the
+// Game methods and then call Save so durable implementations can persist the
+// new state.
+type Store interface {
+	// Create creates a new game under a code that is not in use and stores it.
+	Create(creatorName string) (*Game, *Player, error)
+	// Add stores an existing game, such as one restored from a snapshot.
+	Add(g *Game) error
+	// Get retrieves a game by code, or nil if it does not exist.
+	Get(code string) *Game
+	// Save persists the current state of a game previously returned by the store.
+	Save(g *Game) error
+	// Delete removes a game from the store.
+	Delete(code string)
+	// History returns a game's full event timeline, oldest first, for
+	// replay. It is nil if the store has no game with the code.
+	History(code string) ([]Event, error)
+	// Count returns the number of games in the store.
+	Count() int
+	// GetAll returns all games in the store.
+	GetAll() []*Game
+	// ExpireGames removes games that have been idle longer than the policy
+	// allows for their status and returns how many were removed. onExpire, if
+	// not nil, is called for each game before it is removed.
+	ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// MemoryStore provides thread-safe in-memory game storage.
+type MemoryStore struct {
 	mu    sync.RWMutex
 	games map[string]*Game
+	// history holds each game's events up to its last Save. Games only keep
+	// their recent events, so the store keeps the rest for replay.
+	history map[string][]Event
+	codes   CodeScheme
 }
 
-// NewStore creates a new game store.
-func NewStore() *Store {
-	return &Store{
-		games: make(map[string]*Game),
+// NewMemoryStore creates a new in-memory game store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		games:   make(map[string]*Game),
+		history: make(map[string][]Event),
+		codes:   DefaultCodes,
 	}
 }
 
-// Create creates a new game and stores it.
-func (s *Store) Create(creatorName string) (*Game, *Player) {
-	game, player := NewGame(creatorName)
+// SetCodeScheme changes how codes for new games are generated.
+func (s *MemoryStore) SetCodeScheme(codes CodeScheme) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = codes
+}
 
+// Create creates a new game and stores it. The code is allocated under the
+// store lock, so a new game can never overwrite a live one.
+func (s *MemoryStore) Create(creatorName string) (*Game, *Player, error) {
 	s.mu.Lock()
-	s.games[game.Code] = game
-	s.mu.Unlock()
+	defer s.mu.Unlock()
 
-	return game, player
+	code, err := allocateCode(s.codes, func(code string) bool {
+		_, taken := s.games[code]
+		return taken
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	game, player := NewGameWithCode(code, creatorName)
+	s.games[code] = game
+	return game, player, nil
 }
 
-// Get retrieves a game by code.
-func (s *Store) Get(code string) *Game {
+// createWithCode creates a game under code unless the code is already taken.
+func (s *MemoryStore) createWithCode(code, creatorName string) (*Game, *Player, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, taken := s.games[code]; taken {
+		return nil, nil, false
+	}
+
+	game, player := NewGameWithCode(code, creatorName)
+	s.games[code] = game
+	return game, player, true
+}
+
+// Add stores an existing game.
+func (s *MemoryStore) Add(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.games[g.Code]; exists {
+		return ErrGameExists
+	}
+	s.games[g.Code] = g
+	return nil
+}
+
+// Get retrieves a game by code, ignoring case.
+func (s *MemoryStore) Get(code string) *Game {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.games[code]
+	return s.games[NormalizeCode(code)]
+}
+
+// Save records the events the game has added since it was last saved, so
+// its history outlasts the game's own recent events. The game itself is
+// always up to date.
+func (s *MemoryStore) Save(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Deleted while the caller was working on it
+	if s.games[g.Code] != g {
+		return nil
+	}
+	history := s.history[g.Code]
+	s.history[g.Code] = append(history, g.EventsSince(lastSeq(history))...)
+	return nil
 }
 
 // Delete removes a game from the store.
-func (s *Store) Delete(code string) {
+func (s *MemoryStore) Delete(code string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	code = NormalizeCode(code)
 	delete(s.games, code)
+	delete(s.history, code)
+}
+
+// History returns the events saved for a game followed by any it has added
+// since. A game added to the store, rather than created in it, has the
+// events it brought with it and those after.
+func (s *MemoryStore) History(code string) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code = NormalizeCode(code)
+	g, ok := s.games[code]
+	if !ok {
+		return nil, nil
+	}
+	history := s.history[code]
+	events := make([]Event, len(history), len(history)+1)
+	copy(events, history)
+	return append(events, g.EventsSince(lastSeq(history))...), nil
+}
+
+// lastSeq returns the Seq of the last of events, or 0 if there are none.
+func lastSeq(events []Event) uint64 {
+	if len(events) == 0 {
+		return 0
+	}
+	return events[len(events)-1].Seq
 }
 
 // Count returns the number of games in the store.
-func (s *Store) Count() int {
+func (s *MemoryStore) Count() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.games)
 }
 
 // GetAll returns all games in the store.
-func (s *Store) GetAll() []*Game {
+func (s *MemoryStore) GetAll() []*Game {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -62,33 +189,56 @@ func (s *Store) GetAll() []*Game {
 	return games
 }
 
-// CleanupOldGames removes games older than the specified duration.
-func (s *Store) CleanupOldGames(maxAge time.Duration) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ExpireGames removes idle games according to the policy.
+func (s *MemoryStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	return len(s.expire(policy, onExpire))
+}
 
-	cutoff := time.Now().Add(-maxAge)
-	removed := 0
+// expire removes expired games and returns their codes. Games are checked and
+// notified without holding the store lock, so lookups are never blocked on a
+// game's own lock or on the notification.
+func (s *MemoryStore) expire(policy ExpiryPolicy, onExpire func(*Game)) []string {
+	now := time.Now()
+	var removed []string
 
-	for code, game := range s.games {
-		if game.GetCreatedAt().Before(cutoff) {
-			delete(s.games, code)
-			removed++
+	for _, g := range s.GetAll() {
+		if !policy.Expired(g, now) {
+			continue
 		}
+
+		if onExpire != nil {
+			onExpire(g)
+		}
+
+		s.mu.Lock()
+		// Only remove the game we checked, not a newer one under the same code
+		if s.games[g.Code] == g {
+			delete(s.games, g.Code)
+			delete(s.history, g.Code)
+			removed = append(removed, g.Code)
+		}
+		s.mu.Unlock()
 	}
 
 	return removed
 }
 
-// StartCleanupRoutine starts a background goroutine that periodically cleans up old games.
-func (s *Store) StartCleanupRoutine(interval, maxAge time.Duration, stop <-chan struct{}) {
+// Close is a no-op for the in-memory store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// StartCleanupRoutine periodically expires idle games from a store until stop is closed.
+func StartCleanupRoutine(s Store, interval time.Duration, policy ExpiryPolicy, onExpire func(*Game), stop <-chan struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			s.CleanupOldGames(maxAge)
+			if removed := s.ExpireGames(policy, onExpire); removed > 0 {
+				log.Printf("Expired %d idle games", removed)
+			}
 		case <-stop:
 			return
 		}
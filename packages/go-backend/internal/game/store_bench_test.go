@@ -0,0 +1,179 @@
+package game
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchGames is how many live games each benchmark store holds.
+const benchGames = 5000
+
+// benchStore is what the benchmarks need of a store.
+type benchStore interface {
+	Create(creatorName string) (*Game, *Player, error)
+	Get(code string) *Game
+	Delete(code string)
+	ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int
+}
+
+// benchStores lists the in-memory stores compared by the benchmarks. Run
+// them with -cpu 1,4,8 to see how each scales with contention.
+var benchStores = []struct {
+	name string
+	open func() benchStore
+}{
+	{"global", func() benchStore { return newGlobalLockStore() }},
+	{"memory", func() benchStore { return NewMemoryStore() }},
+	{"sharded", func() benchStore { return NewShardedStore(DefaultShardCount) }},
+}
+
+// globalLockStore is the store as it was before sharding, kept as the
+// benchmarks' baseline: one lock for every game, held for the whole of an
+// expiry scan, which takes each game's own lock.
+type globalLockStore struct {
+	mu    sync.RWMutex
+	games map[string]*Game
+}
+
+func newGlobalLockStore() *globalLockStore {
+	return &globalLockStore{games: make(map[string]*Game)}
+}
+
+func (s *globalLockStore) Create(creatorName string) (*Game, *Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, err := allocateCode(DefaultCodes, func(code string) bool {
+		_, taken := s.games[code]
+		return taken
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	g, player := NewGameWithCode(code, creatorName)
+	s.games[code] = g
+	return g, player, nil
+}
+
+func (s *globalLockStore) Get(code string) *Game {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.games[NormalizeCode(code)]
+}
+
+func (s *globalLockStore) Delete(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.games, NormalizeCode(code))
+}
+
+func (s *globalLockStore) ExpireGames(policy ExpiryPolicy, onExpire func(*Game)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for code, g := range s.games {
+		if policy.Expired(g, now) {
+			delete(s.games, code)
+			removed++
+		}
+	}
+	return removed
+}
+
+// fillStore creates benchGames games and returns their codes.
+func fillStore(b *testing.B, store benchStore) []string {
+	b.Helper()
+	codes := make([]string, benchGames)
+	for i := range codes {
+		g, _, err := store.Create("Alice")
+		if err != nil {
+			b.Fatalf("Create failed: %v", err)
+		}
+		codes[i] = g.Code
+	}
+	return codes
+}
+
+// BenchmarkStoreGet measures parallel lookups of live games.
+func BenchmarkStoreGet(b *testing.B) {
+	for _, impl := range benchStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.open()
+			codes := fillStore(b, store)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					store.Get(codes[r.Intn(len(codes))])
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStoreMixed measures a load-test-like mix: mostly lookups, with
+// one in ten operations creating or deleting a game.
+func BenchmarkStoreMixed(b *testing.B) {
+	for _, impl := range benchStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.open()
+			codes := fillStore(b, store)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					switch n := r.Intn(10); {
+					case n == 0:
+						if g, _, err := store.Create("Bob"); err == nil {
+							store.Delete(g.Code)
+						}
+					default:
+						if g := store.Get(codes[r.Intn(len(codes))]); g != nil {
+							g.GetStatus()
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStoreGetDuringExpiry measures lookups while expiry scans run
+// continuously in the background.
+func BenchmarkStoreGetDuringExpiry(b *testing.B) {
+	for _, impl := range benchStores {
+		b.Run(impl.name, func(b *testing.B) {
+			store := impl.open()
+			codes := fillStore(b, store)
+
+			var stop atomic.Bool
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for !stop.Load() {
+					// Nothing is idle, so every game is inspected and kept
+					store.ExpireGames(testExpiry, nil)
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					store.Get(codes[r.Intn(len(codes))])
+				}
+			})
+			b.StopTimer()
+
+			stop.Store(true)
+			<-done
+		})
+	}
+}
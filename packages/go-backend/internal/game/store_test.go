@@ -1,85 +1,372 @@
 package game
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
+// storeImpls lists every Store implementation the shared tests run against.
+var storeImpls = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"sharded", func(t *testing.T) Store { return NewShardedStore(4) }},
+	{"file", func(t *testing.T) Store {
+		store, err := OpenFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("OpenFileStore failed: %v", err)
+		}
+		return store
+	}},
+	{"eventlog", func(t *testing.T) Store {
+		store, err := OpenEventLogStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("OpenEventLogStore failed: %v", err)
+		}
+		return store
+	}},
+}
+
+// forEachStore runs fn as a subtest against every Store implementation.
+func forEachStore(t *testing.T, fn func(t *testing.T, store Store)) {
+	for _, impl := range storeImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			store := impl.open(t)
+			defer store.Close()
+			fn(t, store)
+		})
+	}
+}
+
 func TestStore(t *testing.T) {
-	store := NewStore()
+	forEachStore(t, func(t *testing.T, store Store) {
+		// Create a game
+		game, player, _ := store.Create("Alice")
+
+		if game == nil {
+			t.Fatal("Game should not be nil")
+		}
+		if player == nil {
+			t.Fatal("Player should not be nil")
+		}
+
+		// Get the game
+		found := store.Get(game.Code)
+		if found == nil {
+			t.Fatal("Should find the game")
+		}
+		if found.Code != game.Code {
+			t.Errorf("Found game code should match")
+		}
+
+		// Count
+		if store.Count() != 1 {
+			t.Errorf("Store should have 1 game, got %d", store.Count())
+		}
+
+		// Delete
+		store.Delete(game.Code)
+		if store.Count() != 0 {
+			t.Errorf("Store should have 0 games, got %d", store.Count())
+		}
+
+		// Get after delete
+		notFound := store.Get(game.Code)
+		if notFound != nil {
+			t.Error("Should not find deleted game")
+		}
+	})
+}
+
+func TestStoreSave(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		game, _, _ := store.Create("Alice")
+		if _, err := game.AddPlayer("Bob"); err != nil {
+			t.Fatalf("AddPlayer should not error: %v", err)
+		}
+
+		if err := store.Save(game); err != nil {
+			t.Fatalf("Save should not error: %v", err)
+		}
+
+		found := store.Get(game.Code)
+		if len(found.GetPlayers()) != 2 {
+			t.Errorf("Saved game should have 2 players, got %d", len(found.GetPlayers()))
+		}
+	})
+}
+
+// testExpiry keeps waiting games for an hour, playing games for two and
+// finished games for ten minutes.
+var testExpiry = ExpiryPolicy{
+	WaitingTTL:  time.Hour,
+	PlayingTTL:  2 * time.Hour,
+	FinishedTTL: 10 * time.Minute,
+}
+
+// idleFor backdates a game's last activity.
+func idleFor(g *Game, d time.Duration) {
+	g.mu.Lock()
+	g.UpdatedAt = time.Now().Add(-d)
+	g.mu.Unlock()
+}
+
+func TestStoreExpireGames(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		game, _, _ := store.Create("Alice")
+		idleFor(game, 90*time.Minute)
+
+		var notified []string
+		removed := store.ExpireGames(testExpiry, func(g *Game) {
+			// Clients are told before the game disappears
+			if store.Get(g.Code) == nil {
+				t.Error("Game should still exist when onExpire is called")
+			}
+			notified = append(notified, g.Code)
+		})
+
+		if removed != 1 {
+			t.Errorf("Should remove 1 game, removed %d", removed)
+		}
+		if store.Count() != 0 {
+			t.Errorf("Store should have 0 games, got %d", store.Count())
+		}
+		if len(notified) != 1 || notified[0] != game.Code {
+			t.Errorf("Expected onExpire for %s, got %v", game.Code, notified)
+		}
+	})
+}
+
+func TestStoreExpireGamesKeepsActive(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		// An old game that is still being played
+		game, alice, _ := store.Create("Alice")
+		game.AddPlayer("Bob")
+		game.mu.Lock()
+		game.CreatedAt = time.Now().Add(-3 * time.Hour)
+		game.mu.Unlock()
+		game.Start(alice.ID)
+		idleFor(game, 90*time.Minute)
+
+		removed := store.ExpireGames(testExpiry, nil)
+
+		if removed != 0 {
+			t.Errorf("Should remove 0 games, removed %d", removed)
+		}
+		if store.Count() != 1 {
+			t.Errorf("Store should have 1 game, got %d", store.Count())
+		}
+	})
+}
+
+func TestStoreExpireGamesUsesStatusTTL(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		waiting, _, _ := store.Create("Alice")
+		idleFor(waiting, 30*time.Minute)
+
+		playing, alice, _ := store.Create("Alice")
+		playing.AddPlayer("Bob")
+		playing.Start(alice.ID)
+		idleFor(playing, 3*time.Hour)
+
+		finished, _, _ := store.Create("Alice")
+		finished.mu.Lock()
+		finished.Status = StatusFinished
+		finished.mu.Unlock()
+		idleFor(finished, 30*time.Minute)
 
-	// Create a game
-	game, player := store.Create("Alice")
+		removed := store.ExpireGames(testExpiry, nil)
 
-	if game == nil {
-		t.Fatal("Game should not be nil")
+		if removed != 2 {
+			t.Errorf("Should remove 2 games, removed %d", removed)
+		}
+		if store.Get(waiting.Code) == nil {
+			t.Error("Waiting game within its TTL should be kept")
+		}
+		if store.Get(playing.Code) != nil {
+			t.Error("Idle playing game should expire")
+		}
+		if store.Get(finished.Code) != nil {
+			t.Error("Idle finished game should expire")
+		}
+	})
+}
+
+// --- FileStore durability tests ---
+
+func TestFileStoreReloadsGames(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
 	}
-	if player == nil {
-		t.Fatal("Player should not be nil")
+
+	game, alice, _ := store.Create("Alice")
+	bob, _ := game.AddPlayer("Bob")
+	game.Start(alice.ID)
+	game.RollDice(bob.ID)
+	if err := store.Save(game); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	want := game.Snapshot()
+
+	// Reopen without closing, as after kill -9
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
 	}
 
-	// Get the game
-	found := store.Get(game.Code)
+	found := reopened.Get(game.Code)
 	if found == nil {
-		t.Fatal("Should find the game")
+		t.Fatal("Game should survive a reopen")
 	}
-	if found.Code != game.Code {
-		t.Errorf("Found game code should match")
+	got := found.Snapshot()
+	if got.Status != StatusPlaying {
+		t.Errorf("Expected status playing, got %s", got.Status)
 	}
-
-	// Count
-	if store.Count() != 1 {
-		t.Errorf("Store should have 1 game, got %d", store.Count())
+	if len(got.Players) != 2 {
+		t.Fatalf("Expected 2 players, got %d", len(got.Players))
 	}
+	if got.Players[1].Position != want.Players[1].Position {
+		t.Errorf("Expected Bob at %d, got %d", want.Players[1].Position, got.Players[1].Position)
+	}
+	if got.Version != want.Version {
+		t.Errorf("Expected version %d, got %d", want.Version, got.Version)
+	}
+}
+
+func TestFileStoreDeleteRemovesFile(t *testing.T) {
+	dir := t.TempDir()
 
-	// Delete
+	store, _ := OpenFileStore(dir)
+	game, _, _ := store.Create("Alice")
 	store.Delete(game.Code)
-	if store.Count() != 0 {
-		t.Errorf("Store should have 0 games, got %d", store.Count())
+
+	reopened, _ := OpenFileStore(dir)
+	if reopened.Count() != 0 {
+		t.Errorf("Deleted game should not be reloaded, got %d games", reopened.Count())
 	}
+}
+
+func TestFileStoreIgnoresPartialWrites(t *testing.T) {
+	dir := t.TempDir()
 
-	// Get after delete
-	notFound := store.Get(game.Code)
-	if notFound != nil {
-		t.Error("Should not find deleted game")
+	store, _ := OpenFileStore(dir)
+	game, _, _ := store.Create("Alice")
+
+	// Simulate a crash mid-write and a corrupted file
+	tmpPath := filepath.Join(dir, game.Code+gameFileExt+".123"+tempFileExt)
+	os.WriteFile(tmpPath, []byte(`{"code":"`), 0o644)
+	os.WriteFile(filepath.Join(dir, "BROKEN"+gameFileExt), []byte(`{"co`), 0o644)
+
+	reopened, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if reopened.Count() != 1 {
+		t.Errorf("Expected 1 game, got %d", reopened.Count())
+	}
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Error("Leftover temp file should be removed on open")
+	}
+}
+
+func TestFileStoreExpireRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+
+	store, _ := OpenFileStore(dir)
+	game, _, _ := store.Create("Alice")
+	idleFor(game, 2*time.Hour)
+	store.ExpireGames(testExpiry, nil)
+
+	reopened, _ := OpenFileStore(dir)
+	if reopened.Count() != 0 {
+		t.Errorf("Expired game should not be reloaded, got %d games", reopened.Count())
 	}
 }
 
-func TestStoreCleanup(t *testing.T) {
-	store := NewStore()
+func TestFileStoreSkipsStaleSave(t *testing.T) {
+	dir := t.TempDir()
 
-	// Create a game
-	game, _ := store.Create("Alice")
+	store, _ := OpenFileStore(dir)
+	game, _, _ := store.Create("Alice")
+	game.AddPlayer("Bob")
+	store.Save(game)
 
-	// Set game creation time to 3 hours ago
-	game.mu.Lock()
-	game.CreatedAt = time.Now().Add(-3 * time.Hour)
-	game.mu.Unlock()
+	// Pretend a slower writer still holds an older version
+	store.written[game.Code] = game.Snapshot().Version + 1
+	game.AddPlayer("Carol")
+	store.Save(game)
 
-	// Cleanup games older than 2 hours
-	removed := store.CleanupOldGames(2 * time.Hour)
+	reopened, _ := OpenFileStore(dir)
+	if n := len(reopened.Get(game.Code).GetPlayers()); n != 2 {
+		t.Errorf("Stale save should be skipped, expected 2 players on disk, got %d", n)
+	}
+}
 
-	if removed != 1 {
-		t.Errorf("Should remove 1 game, removed %d", removed)
+// assertFullHistory checks that events hold every Seq from 1 to g's version.
+func assertFullHistory(t *testing.T, g *Game, events []Event) {
+	t.Helper()
+	if uint64(len(events)) != g.Version() {
+		t.Fatalf("Expected %d events, got %d", g.Version(), len(events))
 	}
-	if store.Count() != 0 {
-		t.Errorf("Store should have 0 games, got %d", store.Count())
+	for i, e := range events {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("Event %d: expected seq %d, got %d", i, i+1, e.Seq)
+		}
 	}
 }
 
-func TestStoreCleanupKeepsRecent(t *testing.T) {
-	store := NewStore()
+func TestStoreHistoryOutlastsDeltaWindow(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		g, _, _ := store.Create("Alice")
+		bob, _ := g.AddPlayer("Bob")
+		for i := 0; i < 3*MaxDeltaEvents; i++ {
+			g.SetPlayerConnected(bob.ID, i%2 == 1)
+			if i%100 == 0 {
+				store.Save(g)
+			}
+			// Fold part of the history into the event log's history files
+			if s, ok := store.(*EventLogStore); ok && i == MaxDeltaEvents {
+				s.Compact()
+			}
+		}
 
-	// Create a game (recent)
-	store.Create("Alice")
+		if len(g.Events()) >= int(g.Version()) {
+			t.Fatal("Game should have trimmed its own events")
+		}
+		// Events since the last Save come from the game itself
+		events, err := store.History(g.Code)
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		assertFullHistory(t, g, events)
 
-	// Cleanup games older than 2 hours
-	removed := store.CleanupOldGames(2 * time.Hour)
+		store.Delete(g.Code)
+		if events, _ := store.History(g.Code); events != nil {
+			t.Errorf("Deleted game should have no history, got %d events", len(events))
+		}
+	})
+}
+
+func TestFileStoreReloadsHistory(t *testing.T) {
+	dir := t.TempDir()
 
-	if removed != 0 {
-		t.Errorf("Should remove 0 games, removed %d", removed)
+	store, _ := OpenFileStore(dir)
+	g := playRace(t, store)
+	for i := 0; i < 2*MaxDeltaEvents; i++ {
+		g.SetPlayerConnected(g.CreatorID, i%2 == 1)
+		store.Save(g)
 	}
-	if store.Count() != 1 {
-		t.Errorf("Store should have 1 game, got %d", store.Count())
+
+	reopened, _ := OpenFileStore(dir)
+	events, err := reopened.History(g.Code)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
 	}
+	assertFullHistory(t, g, events)
 }
@@ -0,0 +1,202 @@
+package handler
+
+import "time"
+
+const (
+	// actorMailboxSize is how many commands may wait for a game's actor.
+	actorMailboxSize = 64
+	// actorIdleTimeout is how long an actor with nothing to do stays running.
+	actorIdleTimeout = 5 * time.Minute
+)
+
+// gameActor is the goroutine that runs a game's commands one at a time.
+// Each command's state changes and broadcasts finish before the next one
+// starts, so clients see events in the order they were applied.
+type gameActor struct {
+	code    string
+	mailbox chan func()
+	// pending counts jobs handed to the actor and not yet finished. It is
+	// guarded by Dispatcher.mu so an idle actor can't exit under a sender.
+	pending int
+	// stop asks the actor to finish its pending jobs and exit.
+	stop chan struct{}
+	done chan struct{}
+	// stopping is set, under Dispatcher.mu, once the actor has been asked to
+	// stop. It stays in the dispatcher as a tombstone until stopped is
+	// closed, so a new actor for the game can't start while it still runs.
+	stopping bool
+	stopped  chan struct{}
+}
+
+// inGame runs job on the actor of the game with the given code, starting one
+// if needed, and waits for it to finish. A job for a game whose actor is
+// stopping waits for it to stop first. Jobs without a game, or arriving after
+// Close, run on the caller's goroutine.
+func (d *Dispatcher) inGame(code string, job func()) {
+	if code == "" {
+		job()
+		return
+	}
+
+	d.mu.Lock()
+	var a *gameActor
+	for {
+		if d.closed {
+			d.mu.Unlock()
+			job()
+			return
+		}
+		var ok bool
+		a, ok = d.actors[code]
+		if !ok {
+			a = &gameActor{
+				code:    code,
+				mailbox: make(chan func(), actorMailboxSize),
+				stop:    make(chan struct{}),
+				done:    make(chan struct{}),
+				stopped: make(chan struct{}),
+			}
+			d.actors[code] = a
+			go d.runActor(a)
+		}
+		if !a.stopping {
+			break
+		}
+		d.mu.Unlock()
+		<-a.stopped
+		d.mu.Lock()
+	}
+	a.pending++
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	a.mailbox <- func() {
+		defer close(finished)
+		job()
+	}
+	<-finished
+}
+
+// runActor processes an actor's mailbox until it is stopped or idle.
+func (d *Dispatcher) runActor(a *gameActor) {
+	defer close(a.done)
+
+	idle := time.NewTimer(actorIdleTimeout)
+	defer idle.Stop()
+	stop := a.stop
+
+	for {
+		select {
+		case job := <-a.mailbox:
+			job()
+			d.mu.Lock()
+			a.pending--
+			d.mu.Unlock()
+			idle.Reset(actorIdleTimeout)
+			if stop != nil {
+				continue
+			}
+		case <-idle.C:
+			idle.Reset(actorIdleTimeout)
+		case <-stop:
+			// Keep serving jobs already handed over, then exit
+			stop = nil
+		}
+
+		if d.retire(a) {
+			return
+		}
+	}
+}
+
+// retire removes an actor with no pending jobs from the dispatcher and
+// reports whether it should exit. A stopping actor is left for StopGame to
+// remove.
+func (d *Dispatcher) retire(a *gameActor) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if a.pending > 0 {
+		return false
+	}
+	if d.actors[a.code] == a && !a.stopping {
+		delete(d.actors, a.code)
+	}
+	return true
+}
+
+// StopGame stops a game's actor once its pending commands have run, e.g.
+// because the game is being removed from the store. It broadcasts the game's
+// batched moves and forgets its idempotency keys and chat. Commands for the
+// game that arrive meanwhile wait, then start a new actor.
+func (d *Dispatcher) StopGame(code string) {
+	d.mu.Lock()
+	a, ok := d.actors[code]
+	if ok && a.stopping {
+		// Already being stopped
+		d.mu.Unlock()
+		<-a.stopped
+		return
+	}
+	if ok {
+		a.stopping = true
+	}
+	delete(d.flushIntervals, code)
+	d.mu.Unlock()
+
+	if ok {
+		close(a.stop)
+		<-a.done
+	}
+	d.flushMoves(code)
+	d.results.forget(code)
+	d.chat.forget(code)
+
+	if ok {
+		d.mu.Lock()
+		if d.actors[code] == a {
+			delete(d.actors, code)
+		}
+		d.mu.Unlock()
+		close(a.stopped)
+	}
+}
+
+// Close stops every actor once its pending commands have run, then
+// broadcasts any batched moves. Commands dispatched afterwards run on the
+// caller's goroutine.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	actors := d.actors
+	d.actors = make(map[string]*gameActor)
+	var stopping []*gameActor
+	for _, a := range actors {
+		// Actors StopGame is stopping are left to it
+		if !a.stopping {
+			a.stopping = true
+			stopping = append(stopping, a)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, a := range stopping {
+		close(a.stop)
+	}
+	for _, a := range actors {
+		<-a.done
+	}
+	for _, a := range stopping {
+		close(a.stopped)
+	}
+
+	d.mu.Lock()
+	codes := make([]string, 0, len(d.batches))
+	for code := range d.batches {
+		codes = append(codes, code)
+	}
+	d.mu.Unlock()
+	for _, code := range codes {
+		d.flushMoves(code)
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestConcurrentRollsBroadcastInOrder(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+
+	watcher := &hub.Client{ID: "watcher", Send: make(chan []byte, 4096)}
+	h.Register(watcher)
+	h.JoinGame(watcher, g.Code, "")
+
+	// Several connections per player roll at once
+	var wg sync.WaitGroup
+	for _, playerID := range []string{alice.ID, bob.ID} {
+		for i := 0; i < 4; i++ {
+			client := newDispatcherClient(h, fmt.Sprintf("%s-%d", playerID, i))
+			h.JoinGame(client, g.Code, playerID)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					res := d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice})
+					if _, ok := res.Reply.(message.PlayerMovedMessage); !ok {
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(watcher.Send)
+
+	positions := map[string]int{}
+	var winner string
+	for data := range watcher.Send {
+		if winner != "" {
+			t.Fatalf("Nothing should follow gameEnded, got %s", data)
+		}
+
+		var msg struct {
+			Type             string `json:"type"`
+			PlayerID         string `json:"playerId"`
+			PreviousPosition int    `json:"previousPosition"`
+			NewPosition      int    `json:"newPosition"`
+			WinnerID         string `json:"winnerId"`
+		}
+		json.Unmarshal(data, &msg)
+
+		switch msg.Type {
+		case message.TypePlayerMoved:
+			if last, ok := positions[msg.PlayerID]; ok && msg.PreviousPosition != last {
+				t.Fatalf("%s moved from %d but was last at %d", msg.PlayerID, msg.PreviousPosition, last)
+			}
+			positions[msg.PlayerID] = msg.NewPosition
+		case message.TypeGameEnded:
+			if positions[msg.WinnerID] != g.Board.Size {
+				t.Fatalf("gameEnded arrived before %s's winning move", msg.WinnerID)
+			}
+			winner = msg.WinnerID
+		}
+	}
+
+	if winner == "" {
+		t.Error("Expected the game to end")
+	}
+}
+
+func TestStopGameStopsActor(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+
+	d.Dispatch(client, message.ClientMessage{
+		Action:   message.ActionRejoinGame,
+		GameCode: g.Code,
+		PlayerID: alice.ID,
+	})
+	if n := actorCount(d); n != 1 {
+		t.Fatalf("Expected 1 actor, got %d", n)
+	}
+
+	d.StopGame(g.Code)
+	if n := actorCount(d); n != 0 {
+		t.Fatalf("Expected 0 actors after StopGame, got %d", n)
+	}
+
+	// A later command starts a fresh actor
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionStartGame})
+	if _, ok := res.Reply.(message.GameStartedMessage); !ok {
+		t.Errorf("Expected gameStarted, got %T", res.Reply)
+	}
+	if n := actorCount(d); n != 1 {
+		t.Errorf("Expected 1 actor, got %d", n)
+	}
+}
+
+func TestStopGameDuringCommand(t *testing.T) {
+	d, store, _ := newTestDispatcher()
+	g, _, _ := store.Create("Alice")
+
+	var running, overlapped atomic.Int32
+	job := func(release <-chan struct{}) func() {
+		return func() {
+			if running.Add(1) > 1 {
+				overlapped.Store(1)
+			}
+			<-release
+			running.Add(-1)
+		}
+	}
+
+	// Hold the actor busy with a command, then stop the game under it
+	release := make(chan struct{})
+	first := make(chan struct{})
+	go func() {
+		d.inGame(g.Code, job(release))
+		close(first)
+	}()
+	waitFor(t, func() bool { return running.Load() == 1 })
+
+	stopped := make(chan struct{})
+	go func() {
+		d.StopGame(g.Code)
+		close(stopped)
+	}()
+	waitFor(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		a, ok := d.actors[g.Code]
+		return ok && a.stopping
+	})
+
+	// A command arriving meanwhile waits for the old actor
+	second := make(chan struct{})
+	go func() {
+		d.inGame(g.Code, job(closedChan()))
+		close(second)
+	}()
+	select {
+	case <-second:
+		t.Fatal("A command ran while the game's actor was stopping")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	for _, done := range []chan struct{}{first, stopped, second} {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the commands and StopGame to finish")
+		}
+	}
+	if overlapped.Load() != 0 {
+		t.Error("Two actors ran commands for the same game at once")
+	}
+	d.mu.Lock()
+	a, ok := d.actors[g.Code]
+	d.mu.Unlock()
+	if !ok || a.stopping {
+		t.Error("Expected the later command to start a fresh actor")
+	}
+}
+
+func closedChan() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNoActorForMissingGame(t *testing.T) {
+	d, _, h := newTestDispatcher()
+	client := newDispatcherClient(h, "c1")
+
+	d.Dispatch(client, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: "NOPE00",
+		Name:     "Bob",
+	})
+
+	if n := actorCount(d); n != 0 {
+		t.Errorf("Expected 0 actors, got %d", n)
+	}
+}
+
+func TestCloseStopsActors(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+
+	d.Dispatch(client, message.ClientMessage{
+		Action:   message.ActionRejoinGame,
+		GameCode: g.Code,
+		PlayerID: alice.ID,
+	})
+	d.Close()
+
+	if n := actorCount(d); n != 0 {
+		t.Fatalf("Expected 0 actors after Close, got %d", n)
+	}
+
+	// Commands still run, on the caller's goroutine
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionStartGame})
+	if _, ok := res.Reply.(message.GameStartedMessage); !ok {
+		t.Errorf("Expected gameStarted, got %T", res.Reply)
+	}
+	if n := actorCount(d); n != 0 {
+		t.Errorf("Expected no new actors after Close, got %d", n)
+	}
+}
+
+func actorCount(d *Dispatcher) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.actors)
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
 	"github.com/snakes-and-ladders/go-backend/internal/message"
 )
 
@@ -19,22 +21,26 @@ const (
 
 // AdminHandler handles admin API requests.
 type AdminHandler struct {
-	store *game.Store
+	store    game.Store
+	archive  game.Archive
+	hub      *hub.Hub
+	ws       *WebSocketHandler
+	commands *Dispatcher
 }
 
 // NewAdminHandler creates a new admin handler.
-func NewAdminHandler(store *game.Store) *AdminHandler {
-	return &AdminHandler{store: store}
+func NewAdminHandler(store game.Store, archive game.Archive, h *hub.Hub, ws *WebSocketHandler, commands *Dispatcher) *AdminHandler {
+	return &AdminHandler{store: store, archive: archive, hub: h, ws: ws, commands: commands}
 }
 
 // AdminGameSummary represents a summary of a game for admin view.
 type AdminGameSummary struct {
-	Code           string `json:"code"`
-	Status         string `json:"status"`
-	PlayerCount    int    `json:"playerCount"`
-	CreatedAt      string `json:"createdAt"`
+	Code           string  `json:"code"`
+	Status         string  `json:"status"`
+	PlayerCount    int     `json:"playerCount"`
+	CreatedAt      string  `json:"createdAt"`
 	LeaderName     *string `json:"leaderName"`
-	LeaderPosition int    `json:"leaderPosition"`
+	LeaderPosition int     `json:"leaderPosition"`
 }
 
 // AdminGamesResponse represents the response for listing all games.
@@ -56,6 +62,42 @@ type AdminGameDetailResponse struct {
 	Moves   []interface{}       `json:"moves"`
 }
 
+// AdminArchiveSummary represents an archived game in archive listings.
+type AdminArchiveSummary struct {
+	ID          string  `json:"id"`
+	Code        string  `json:"code"`
+	Board       string  `json:"board"`
+	PlayerCount int     `json:"playerCount"`
+	WinnerName  *string `json:"winnerName"`
+	FinishedAt  string  `json:"finishedAt"`
+	DurationMs  int64   `json:"durationMs"`
+	MoveCount   int     `json:"moveCount"`
+}
+
+// AdminArchiveResponse represents the response for searching the archive.
+type AdminArchiveResponse struct {
+	Games []AdminArchiveSummary `json:"games"`
+}
+
+// AdminClientsResponse represents the response for listing connected clients.
+type AdminClientsResponse struct {
+	Clients     []hub.ClientStats `json:"clients"`
+	WebSocket   WebSocketStats    `json:"webSocket"`
+	MoveBatches MoveBatchStats    `json:"moveBatches"`
+}
+
+// FlushIntervalRequest sets how long a game's moves wait to be broadcast
+// together. Zero broadcasts each move at once.
+type FlushIntervalRequest struct {
+	IntervalMs int `json:"intervalMs"`
+}
+
+// FlushIntervalResponse reports a game's flush interval.
+type FlushIntervalResponse struct {
+	GameCode   string `json:"gameCode"`
+	IntervalMs int64  `json:"intervalMs"`
+}
+
 // validateAuth checks if the request has valid admin credentials.
 func (h *AdminHandler) validateAuth(r *http.Request) bool {
 	auth := r.Header.Get("Authorization")
@@ -205,3 +247,167 @@ func (h *AdminHandler) HandleGetGameDetail(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// HandleListClients handles GET /admin/clients requests, reporting each
+// WebSocket client's queue depth and slow consumer counters, how much
+// compression saves across all WebSocket connections, and how many messages
+// batching moves saves.
+func (h *AdminHandler) HandleListClients(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAuth(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "UNAUTHORIZED", Message: "Invalid credentials"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminClientsResponse{
+		Clients:     h.hub.ClientStats(),
+		WebSocket:   h.ws.Stats(),
+		MoveBatches: h.commands.BatchStats(),
+	})
+}
+
+// HandleSetFlushInterval handles POST /admin/games/{code}/flush-interval
+// requests, setting how long the game's moves wait to be broadcast together
+// as one movesBatch.
+func (h *AdminHandler) HandleSetFlushInterval(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAuth(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "UNAUTHORIZED", Message: "Invalid credentials"})
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/admin/games/"), "/flush-interval")
+	code := strings.ToUpper(strings.TrimSpace(path))
+	if h.store.Get(code) == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "NOT_FOUND", Message: "Game not found"})
+		return
+	}
+
+	var req FlushIntervalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBadRequest(w, "Invalid request body")
+		return
+	}
+	if req.IntervalMs < 0 {
+		h.writeBadRequest(w, "intervalMs must not be negative")
+		return
+	}
+
+	h.commands.SetFlushInterval(code, time.Duration(req.IntervalMs)*time.Millisecond)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlushIntervalResponse{
+		GameCode:   code,
+		IntervalMs: h.commands.FlushInterval(code).Milliseconds(),
+	})
+}
+
+// HandleSearchArchive handles GET /admin/archive requests. Results can be
+// filtered with the from, to, player, board and limit query parameters.
+func (h *AdminHandler) HandleSearchArchive(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAuth(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "UNAUTHORIZED", Message: "Invalid credentials"})
+		return
+	}
+
+	params := r.URL.Query()
+	query := game.ArchiveQuery{
+		Player: strings.TrimSpace(params.Get("player")),
+		Board:  strings.TrimSpace(params.Get("board")),
+	}
+
+	var err error
+	if query.From, err = parseArchiveTime(params.Get("from")); err != nil {
+		h.writeBadRequest(w, "Invalid from date: "+err.Error())
+		return
+	}
+	if query.To, err = parseArchiveTime(params.Get("to")); err != nil {
+		h.writeBadRequest(w, "Invalid to date: "+err.Error())
+		return
+	}
+	if l := params.Get("limit"); l != "" {
+		if query.Limit, err = strconv.Atoi(l); err != nil || query.Limit < 0 {
+			h.writeBadRequest(w, "Invalid limit")
+			return
+		}
+	}
+
+	games := h.archive.Search(query)
+	summaries := make([]AdminArchiveSummary, len(games))
+	for i, a := range games {
+		var winnerName *string
+		for _, s := range a.Standings {
+			if s.PlayerID == a.WinnerID {
+				name := s.Name
+				winnerName = &name
+				break
+			}
+		}
+
+		summaries[i] = AdminArchiveSummary{
+			ID:          a.ID,
+			Code:        a.Code,
+			Board:       a.Board.Name,
+			PlayerCount: len(a.Standings),
+			WinnerName:  winnerName,
+			FinishedAt:  a.FinishedAt.Format(time.RFC3339),
+			DurationMs:  a.DurationMs,
+			MoveCount:   a.MoveCount,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminArchiveResponse{Games: summaries})
+}
+
+// HandleGetArchivedGame handles GET /admin/archive/{id} requests.
+func (h *AdminHandler) HandleGetArchivedGame(w http.ResponseWriter, r *http.Request) {
+	if !h.validateAuth(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "UNAUTHORIZED", Message: "Invalid credentials"})
+		return
+	}
+
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/admin/archive/"))
+	if id == "" {
+		h.writeBadRequest(w, "Archive ID is required")
+		return
+	}
+
+	a, ok := h.archive.Get(id)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "NOT_FOUND", Message: "Archived game not found"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+func (h *AdminHandler) writeBadRequest(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: "INVALID_REQUEST", Message: msg})
+}
+
+// parseArchiveTime accepts an RFC 3339 timestamp or a plain YYYY-MM-DD date.
+// An empty value means no bound.
+func parseArchiveTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// maxBatchMoves is the most moves a batch holds before it is flushed early,
+// so batches stay a bounded size.
+const maxBatchMoves = 256
+
+// MoveBatchStats counts what broadcasting moves in batches has saved.
+type MoveBatchStats struct {
+	// Batches is the number of movesBatch messages broadcast, carrying
+	// MovesBatched moves between them.
+	Batches      uint64 `json:"batches"`
+	MovesBatched uint64 `json:"movesBatched"`
+	// BroadcastsSaved is how many fewer broadcasts were published.
+	BroadcastsSaved uint64 `json:"broadcastsSaved"`
+	// MessagesSaved is how many fewer messages batches queued to this
+	// instance's clients, over the batches that saved any. A batch goes to
+	// every client, the players who moved included, so small batches in
+	// small games can cost more than they save; MessagesAdded is how many
+	// more messages those batches queued.
+	MessagesSaved uint64 `json:"messagesSaved"`
+	MessagesAdded uint64 `json:"messagesAdded"`
+}
+
+// batchCounters accumulates MoveBatchStats.
+type batchCounters struct {
+	batches         atomic.Uint64
+	movesBatched    atomic.Uint64
+	broadcastsSaved atomic.Uint64
+	messagesSaved   atomic.Uint64
+	messagesAdded   atomic.Uint64
+}
+
+// flushed counts a batch broadcast to a game with the given number of local
+// clients. Each move would otherwise have gone to all of them but its sender.
+func (c *batchCounters) flushed(moves, clients int) {
+	c.batches.Add(1)
+	c.movesBatched.Add(uint64(moves))
+	c.broadcastsSaved.Add(uint64(moves - 1))
+	if saved := moves*(clients-1) - clients; saved > 0 {
+		c.messagesSaved.Add(uint64(saved))
+	} else {
+		c.messagesAdded.Add(uint64(-saved))
+	}
+}
+
+// moveBatch is a game's moves waiting for its flush interval to pass.
+type moveBatch struct {
+	moves []batchedMove
+	timer *time.Timer
+}
+
+// batchedMove is a move and the client whose roll it was.
+type batchedMove struct {
+	senderID string
+	msg      message.PlayerMovedMessage
+}
+
+// BatchStats returns what broadcasting moves in batches has saved so far.
+func (d *Dispatcher) BatchStats() MoveBatchStats {
+	return MoveBatchStats{
+		Batches:         d.batchStats.batches.Load(),
+		MovesBatched:    d.batchStats.movesBatched.Load(),
+		BroadcastsSaved: d.batchStats.broadcastsSaved.Load(),
+		MessagesSaved:   d.batchStats.messagesSaved.Load(),
+		MessagesAdded:   d.batchStats.messagesAdded.Load(),
+	}
+}
+
+// SetDefaultFlushInterval sets how long moves wait to be broadcast together in
+// games without their own interval. Zero broadcasts each move at once.
+func (d *Dispatcher) SetDefaultFlushInterval(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushDefault = interval
+}
+
+// SetFlushInterval sets how long a game's moves wait to be broadcast
+// together, in place of the default. Zero broadcasts each move at once.
+func (d *Dispatcher) SetFlushInterval(code string, interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushIntervals[code] = interval
+}
+
+// FlushInterval returns how long a game's moves wait to be broadcast.
+func (d *Dispatcher) FlushInterval(code string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flushIntervalLocked(code)
+}
+
+// flushIntervalLocked returns a game's flush interval. Callers must hold mu.
+func (d *Dispatcher) flushIntervalLocked(code string) time.Duration {
+	if interval, ok := d.flushIntervals[code]; ok {
+		return interval
+	}
+	return d.flushDefault
+}
+
+// batchMove adds a move to its game's batch, starting the flush interval if
+// the batch is new. It reports false if the game broadcasts moves at once.
+// It runs on the game's actor.
+func (d *Dispatcher) batchMove(code, senderID string, move message.PlayerMovedMessage) bool {
+	d.mu.Lock()
+	interval := d.flushIntervalLocked(code)
+	if interval <= 0 {
+		d.mu.Unlock()
+		return false
+	}
+
+	b, ok := d.batches[code]
+	if !ok {
+		b = &moveBatch{}
+		d.batches[code] = b
+		b.timer = time.AfterFunc(interval, func() {
+			d.mu.Lock()
+			pending := d.batches[code] == b
+			d.mu.Unlock()
+			if pending {
+				d.inGame(code, func() { d.flushMoves(code) })
+			}
+		})
+	}
+	b.moves = append(b.moves, batchedMove{senderID: senderID, msg: move})
+	full := len(b.moves) >= maxBatchMoves
+	d.mu.Unlock()
+
+	if full {
+		d.flushMoves(code)
+	}
+	return true
+}
+
+// flushMoves broadcasts a game's batched moves, if any. A lone move goes out
+// as the playerMoved it would have been, to everyone but its sender. A batch
+// of moves goes to everyone, so players get their own moves again after the
+// replies to their rolls. It runs on the game's actor, or once the actor has
+// stopped.
+func (d *Dispatcher) flushMoves(code string) {
+	d.mu.Lock()
+	b, ok := d.batches[code]
+	delete(d.batches, code)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+	b.timer.Stop()
+
+	if len(b.moves) == 1 {
+		d.hub.BroadcastToGameExcept(code, b.moves[0].senderID, b.moves[0].msg)
+		return
+	}
+
+	batch := message.MovesBatchMessage{
+		Type:    message.TypeMovesBatch,
+		Moves:   make([]message.PlayerMovedMessage, len(b.moves)),
+		Version: b.moves[len(b.moves)-1].msg.Version,
+	}
+	for i, m := range b.moves {
+		batch.Moves[i] = m.msg
+	}
+	d.hub.BroadcastToGame(code, batch)
+	d.batchStats.flushed(len(b.moves), d.hub.GetGameClientCount(code))
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestMovesBatchedWithinInterval(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+	d.SetFlushInterval(g.Code, 100*time.Millisecond)
+
+	aliceClient := newDispatcherClient(h, "alice")
+	h.JoinGame(aliceClient, g.Code, alice.ID)
+	bobClient := newDispatcherClient(h, "bob")
+	h.JoinGame(bobClient, g.Code, bob.ID)
+	watcher := newDispatcherClient(h, "watcher")
+	h.JoinGame(watcher, g.Code, "")
+
+	d.DispatchToClient(aliceClient, message.ClientMessage{Action: message.ActionRollDice})
+	d.DispatchToClient(bobClient, message.ClientMessage{Action: message.ActionRollDice})
+
+	if len(watcher.Send) != 0 {
+		t.Fatal("Moves should wait for the flush interval")
+	}
+
+	select {
+	case data := <-watcher.Send:
+		var batch message.MovesBatchMessage
+		json.Unmarshal(data, &batch)
+		if batch.Type != message.TypeMovesBatch {
+			t.Fatalf("Expected movesBatch, got %s", data)
+		}
+		if len(batch.Moves) != 2 || batch.Moves[0].PlayerID != alice.ID || batch.Moves[1].PlayerID != bob.ID {
+			t.Errorf("Expected Alice's then Bob's move, got %+v", batch.Moves)
+		}
+		if batch.Version != g.Version() {
+			t.Errorf("Expected version %d, got %d", g.Version(), batch.Version)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the batch to be flushed")
+	}
+
+	stats := d.BatchStats()
+	if stats.Batches != 1 || stats.MovesBatched != 2 || stats.BroadcastsSaved != 1 {
+		t.Errorf("Expected 1 batch of 2 moves, got %+v", stats)
+	}
+	// 2 moves to 2 of 3 clients each, against 1 batch to all 3
+	if stats.MessagesSaved != 1 || stats.MessagesAdded != 0 {
+		t.Errorf("Expected 1 message saved, got %+v", stats)
+	}
+}
+
+func TestBatchStatsCountLosses(t *testing.T) {
+	var c batchCounters
+	// 2 moves to the 1 other of 2 clients each, against 1 batch to both
+	c.flushed(2, 2)
+	// 2 moves to nobody else, against 1 batch to the only client
+	c.flushed(2, 1)
+
+	if saved, added := c.messagesSaved.Load(), c.messagesAdded.Load(); saved != 0 || added != 1 {
+		t.Errorf("Expected 0 messages saved and 1 added, got %d and %d", saved, added)
+	}
+}
+
+func TestLoneMoveSentAsPlayerMoved(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	g.Start(alice.ID)
+	d.SetFlushInterval(g.Code, time.Millisecond)
+
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+	watcher := newDispatcherClient(h, "watcher")
+	h.JoinGame(watcher, g.Code, "")
+
+	d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice})
+
+	select {
+	case data := <-watcher.Send:
+		if !containsType(string(data), message.TypePlayerMoved) {
+			t.Errorf("Expected playerMoved, got %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the move to be flushed")
+	}
+	if len(client.Send) != 0 {
+		t.Error("The sender should not receive its own move")
+	}
+	if stats := d.BatchStats(); stats.Batches != 0 {
+		t.Errorf("A lone move is not a batch, got %+v", stats)
+	}
+}
+
+func TestGameEndedFlushesBatch(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	g.Start(alice.ID)
+	// Long enough that only the end of the game can flush it
+	d.SetFlushInterval(g.Code, time.Hour)
+
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+	watcher := &hub.Client{ID: "watcher", Send: make(chan []byte, 256)}
+	h.Register(watcher)
+	h.JoinGame(watcher, g.Code, "")
+
+	rolls := 0
+	for g.GetStatus() != game.StatusFinished {
+		d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice})
+		rolls++
+	}
+
+	var types []string
+	moves := 0
+	for len(watcher.Send) > 0 {
+		data := <-watcher.Send
+		var msg struct {
+			Type  string            `json:"type"`
+			Moves []json.RawMessage `json:"moves"`
+		}
+		json.Unmarshal(data, &msg)
+		types = append(types, msg.Type)
+		moves += len(msg.Moves)
+		if msg.Type == message.TypePlayerMoved {
+			moves++
+		}
+	}
+
+	if len(types) < 2 || types[len(types)-1] != message.TypeGameEnded {
+		t.Fatalf("Expected the game to end without waiting for the interval, got %v", types)
+	}
+	if moves != rolls {
+		t.Errorf("Expected all %d moves before gameEnded, got %d", rolls, moves)
+	}
+}
+
+func TestStopGameFlushesBatch(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+	d.SetFlushInterval(g.Code, time.Hour)
+
+	for _, playerID := range []string{alice.ID, bob.ID} {
+		client := newDispatcherClient(h, playerID)
+		h.JoinGame(client, g.Code, playerID)
+		d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice})
+	}
+	watcher := newDispatcherClient(h, "watcher")
+	h.JoinGame(watcher, g.Code, "")
+
+	d.StopGame(g.Code)
+
+	if len(watcher.Send) != 1 || !containsType(string(<-watcher.Send), message.TypeMovesBatch) {
+		t.Error("Expected the batch to be flushed when the game stops")
+	}
+	if d.FlushInterval(g.Code) != 0 {
+		t.Errorf("Expected the game's interval to be cleared, got %v", d.FlushInterval(g.Code))
+	}
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+const (
+	// maxChatLength is the longest chat message, in characters.
+	maxChatLength = 200
+	// maxChatHistory is how many recent chat messages a game keeps to send
+	// to players when they join.
+	maxChatHistory = 50
+	// A player may send chatRateLimit messages in any chatRateWindow.
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+)
+
+// ChatFilter moderates chat before it is sent.
+type ChatFilter interface {
+	// Filter returns the text to send in place of text, or false to reject
+	// the message.
+	Filter(text string) (string, bool)
+}
+
+// WordListFilter is a ChatFilter that masks listed words with asterisks,
+// ignoring case.
+type WordListFilter struct {
+	words map[string]bool
+}
+
+// NewWordListFilter creates a WordListFilter for the given words.
+func NewWordListFilter(words []string) *WordListFilter {
+	f := &WordListFilter{words: make(map[string]bool)}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			f.words[w] = true
+		}
+	}
+	return f
+}
+
+// Filter masks the listed words in text. It never rejects a message.
+func (f *WordListFilter) Filter(text string) (string, bool) {
+	if len(f.words) == 0 {
+		return text, true
+	}
+
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := text[start:end]
+		if f.words[strings.ToLower(word)] {
+			word = strings.Repeat("*", utf8.RuneCountInString(word))
+		}
+		b.WriteString(word)
+		start = -1
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord:
+			if start >= 0 {
+				flush(i)
+			}
+			b.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return b.String(), true
+}
+
+// chatRooms holds each game's chat: its recent history, who is muted and
+// when each player last sent something. It only sees chat sent to this
+// instance, so with a backplane a joining player's history can be partial.
+type chatRooms struct {
+	mu    sync.Mutex
+	games map[string]*chatRoom
+}
+
+type chatRoom struct {
+	history []message.ChatMessage
+	muted   map[string]bool
+	// sent is when each player sent their messages in the last
+	// chatRateWindow, oldest first.
+	sent map[string][]time.Time
+}
+
+func newChatRooms() *chatRooms {
+	return &chatRooms{games: make(map[string]*chatRoom)}
+}
+
+// room returns a game's chat, creating it if needed. Callers must hold mu.
+func (c *chatRooms) room(code string) *chatRoom {
+	room, ok := c.games[code]
+	if !ok {
+		room = &chatRoom{muted: make(map[string]bool), sent: make(map[string][]time.Time)}
+		c.games[code] = room
+	}
+	return room
+}
+
+// allow reports whether a player may chat now, counting the message if so.
+// The limit is the player's across all their connections, and applies on
+// top of any RateLimiter.
+func (c *chatRooms) allow(code, playerID string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	room := c.room(code)
+	sent := room.sent[playerID]
+	for len(sent) > 0 && now.Sub(sent[0]) >= chatRateWindow {
+		sent = sent[1:]
+	}
+	if len(sent) >= chatRateLimit {
+		room.sent[playerID] = sent
+		return false
+	}
+	room.sent[playerID] = append(sent, now)
+	return true
+}
+
+func (c *chatRooms) muted(code, playerID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room(code).muted[playerID]
+}
+
+func (c *chatRooms) setMuted(code, playerID string, muted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	room := c.room(code)
+	if muted {
+		room.muted[playerID] = true
+	} else {
+		delete(room.muted, playerID)
+	}
+}
+
+// add records a chat message in its game's history.
+func (c *chatRooms) add(code string, msg message.ChatMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	room := c.room(code)
+	room.history = append(room.history, msg)
+	if len(room.history) > maxChatHistory {
+		room.history = room.history[len(room.history)-maxChatHistory:]
+	}
+}
+
+// history returns a game's recent chat, oldest first.
+func (c *chatRooms) history(code string) []message.ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	room, ok := c.games[code]
+	if !ok || len(room.history) == 0 {
+		return nil
+	}
+	return append([]message.ChatMessage(nil), room.history...)
+}
+
+// forget drops a game's chat.
+func (c *chatRooms) forget(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.games, code)
+}
+
+// SetChatFilter sets the filter chat passes through before it is sent. Nil
+// turns filtering off.
+func (d *Dispatcher) SetChatFilter(filter ChatFilter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.chatFilter = filter
+}
+
+func (d *Dispatcher) sendChat(client *hub.Client, msg message.ClientMessage) Result {
+	g, playerID, res := d.currentGame(client)
+	if g == nil {
+		return res
+	}
+
+	player := g.GetPlayer(playerID)
+	if player == nil {
+		return errorResult(message.ErrPlayerNotFound, "Player not found")
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return errorResult(message.ErrInvalidMessage, "Chat message is empty")
+	}
+	if utf8.RuneCountInString(text) > maxChatLength {
+		return errorResult(message.ErrInvalidMessage, "Chat message is too long")
+	}
+	if d.chat.muted(g.Code, playerID) {
+		return errorResult(message.ErrPlayerMuted, "You have been muted")
+	}
+	now := time.Now()
+	if !d.chat.allow(g.Code, playerID, now) {
+		return errorResult(message.ErrRateLimited, "Too many chat messages, slow down")
+	}
+
+	d.mu.Lock()
+	filter := d.chatFilter
+	d.mu.Unlock()
+	if filter != nil {
+		var ok bool
+		if text, ok = filter.Filter(text); !ok {
+			return errorResult(message.ErrChatRejected, "Chat message was rejected")
+		}
+	}
+
+	chat := message.ChatMessage{
+		Type:       message.TypeChatMessage,
+		PlayerID:   playerID,
+		PlayerName: player.Name,
+		Text:       text,
+		SentAt:     now.UTC().Format(time.RFC3339),
+	}
+	d.chat.add(g.Code, chat)
+
+	return Result{
+		Reply:      chat,
+		Broadcasts: []Broadcast{{GameCode: g.Code, Message: chat}},
+	}
+}
+
+func (d *Dispatcher) mutePlayer(client *hub.Client, msg message.ClientMessage) Result {
+	return d.setMuted(client, msg, true)
+}
+
+func (d *Dispatcher) unmutePlayer(client *hub.Client, msg message.ClientMessage) Result {
+	return d.setMuted(client, msg, false)
+}
+
+// setMuted mutes or unmutes the player named in msg, which only the game's
+// creator may do.
+func (d *Dispatcher) setMuted(client *hub.Client, msg message.ClientMessage, muted bool) Result {
+	g, playerID, res := d.currentGame(client)
+	if g == nil {
+		return res
+	}
+
+	if _, _, creatorID, _, _, _, _ := g.GetInfo(); playerID != creatorID {
+		return errorResult(message.ErrNotGameCreator, "Only the game creator can mute players")
+	}
+	if msg.PlayerID == playerID {
+		return errorResult(message.ErrInvalidMessage, "You can't mute yourself")
+	}
+	if g.GetPlayer(msg.PlayerID) == nil {
+		return errorResult(message.ErrPlayerNotFound, "Player not found in game")
+	}
+
+	d.chat.setMuted(g.Code, msg.PlayerID, muted)
+
+	mutedMsg := message.PlayerMutedMessage{
+		Type:     message.TypePlayerMuted,
+		PlayerID: msg.PlayerID,
+		Muted:    muted,
+	}
+	return Result{
+		Reply:      mutedMsg,
+		Broadcasts: []Broadcast{{GameCode: g.Code, Message: mutedMsg}},
+	}
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/config"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestSendChat(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	aliceClient := newDispatcherClient(h, "alice")
+	h.JoinGame(aliceClient, g.Code, alice.ID)
+	watcher := newDispatcherClient(h, "watcher")
+	h.JoinGame(watcher, g.Code, "")
+
+	res := d.Dispatch(aliceClient, message.ClientMessage{Action: message.ActionSendChat, Text: "  good luck!  "})
+
+	chat, ok := res.Reply.(message.ChatMessage)
+	if !ok || chat.Text != "good luck!" || chat.PlayerID != alice.ID || chat.PlayerName != "Alice" {
+		t.Errorf("Expected Alice's chat, got %+v", res.Reply)
+	}
+	if len(watcher.Send) != 1 || !containsType(string(<-watcher.Send), message.TypeChatMessage) {
+		t.Error("Expected the chat to be broadcast")
+	}
+	if len(aliceClient.Send) != 0 {
+		t.Error("The sender should only get the reply")
+	}
+
+	// Players joining later see it
+	res = d.Dispatch(newDispatcherClient(h, "bob"), message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob"})
+	joined := res.Reply.(message.JoinedGameMessage)
+	if len(joined.Chat) != 1 || joined.Chat[0].Text != "good luck!" {
+		t.Errorf("Expected the chat history on join, got %+v", joined.Chat)
+	}
+}
+
+func TestSendChatRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "   ", "Chat message is empty"},
+		{"too long", strings.Repeat("é", maxChatLength+1), "Chat message is too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, store, h := newTestDispatcher()
+			g, alice, _ := store.Create("Alice")
+			client := newDispatcherClient(h, "alice")
+			h.JoinGame(client, g.Code, alice.ID)
+
+			res := d.Dispatch(client, message.ClientMessage{Action: message.ActionSendChat, Text: tt.text})
+
+			errMsg, ok := res.Reply.(message.ErrorMessage)
+			if !ok || errMsg.Message != tt.want {
+				t.Errorf("Expected %q, got %+v", tt.want, res.Reply)
+			}
+			if len(res.Broadcasts) != 0 {
+				t.Error("A rejected chat should not be broadcast")
+			}
+		})
+	}
+}
+
+func TestSendChatRateLimited(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+	// The limit is the player's, not the connection's
+	other := newDispatcherClient(h, "alice-2")
+	h.JoinGame(other, g.Code, alice.ID)
+
+	for i := 0; i < chatRateLimit; i++ {
+		d.Dispatch(client, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+	}
+	res := d.Dispatch(other, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+
+	if errMsg, ok := res.Reply.(message.ErrorMessage); !ok || errMsg.Code != message.ErrRateLimited {
+		t.Errorf("Expected RATE_LIMITED, got %+v", res.Reply)
+	}
+	if len(d.chat.history(g.Code)) != chatRateLimit {
+		t.Error("A limited chat should not be kept")
+	}
+
+	// The window slides
+	if !d.chat.allow(g.Code, alice.ID, time.Now().Add(chatRateWindow)) {
+		t.Error("Expected chat to be allowed once the window has passed")
+	}
+}
+
+func TestSendChatNotLimitedByReactions(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetRateLimiter(NewRateLimiter(config.RateLimitConfig{
+		Chat:  config.RateLimit{PerSecond: 0.01, Burst: 1},
+		React: config.RateLimit{PerSecond: 0.01, Burst: 1},
+	}))
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	d.Dispatch(client, message.ClientMessage{Action: message.ActionReact, Reaction: "party"})
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+
+	if _, ok := res.Reply.(message.ChatMessage); !ok {
+		t.Errorf("Expected the chat to be sent after a reaction, got %+v", res.Reply)
+	}
+}
+
+func TestMutePlayer(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	aliceClient := newDispatcherClient(h, "alice")
+	h.JoinGame(aliceClient, g.Code, alice.ID)
+	bobClient := newDispatcherClient(h, "bob")
+	h.JoinGame(bobClient, g.Code, bob.ID)
+
+	res := d.Dispatch(bobClient, message.ClientMessage{Action: message.ActionMutePlayer, PlayerID: alice.ID})
+	if errMsg, ok := res.Reply.(message.ErrorMessage); !ok || errMsg.Code != message.ErrNotGameCreator {
+		t.Errorf("Expected NOT_GAME_CREATOR, got %+v", res.Reply)
+	}
+
+	res = d.Dispatch(aliceClient, message.ClientMessage{Action: message.ActionMutePlayer, PlayerID: bob.ID})
+	if muted, ok := res.Reply.(message.PlayerMutedMessage); !ok || muted.PlayerID != bob.ID || !muted.Muted {
+		t.Errorf("Expected Bob to be muted, got %+v", res.Reply)
+	}
+	if len(bobClient.Send) != 1 || !containsType(string(<-bobClient.Send), message.TypePlayerMuted) {
+		t.Error("Expected the mute to be broadcast")
+	}
+
+	res = d.Dispatch(bobClient, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+	if errMsg, ok := res.Reply.(message.ErrorMessage); !ok || errMsg.Code != message.ErrPlayerMuted {
+		t.Errorf("Expected PLAYER_MUTED, got %+v", res.Reply)
+	}
+
+	d.Dispatch(aliceClient, message.ClientMessage{Action: message.ActionUnmutePlayer, PlayerID: bob.ID})
+	res = d.Dispatch(bobClient, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+	if _, ok := res.Reply.(message.ChatMessage); !ok {
+		t.Errorf("Expected Bob to chat once unmuted, got %+v", res.Reply)
+	}
+}
+
+func TestSendChatFiltered(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetChatFilter(rejectAll{})
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+
+	if errMsg, ok := res.Reply.(message.ErrorMessage); !ok || errMsg.Code != message.ErrChatRejected {
+		t.Errorf("Expected CHAT_REJECTED, got %+v", res.Reply)
+	}
+	if d.chat.history(g.Code) != nil {
+		t.Error("A rejected chat should not be kept")
+	}
+}
+
+func TestSendChatWithoutFilter(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetChatFilter(nil)
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionSendChat, Text: "hi"})
+
+	if chat, ok := res.Reply.(message.ChatMessage); !ok || chat.Text != "hi" {
+		t.Errorf("Expected the chat unfiltered, got %+v", res.Reply)
+	}
+}
+
+type rejectAll struct{}
+
+func (rejectAll) Filter(text string) (string, bool) { return "", false }
+
+func TestPollReceivesChat(t *testing.T) {
+	h := newTestPollHandler()
+	g, alice, _ := h.store.Create("Alice")
+	aliceClient := newDispatcherClient(h.hub, "alice")
+	h.hub.JoinGame(aliceClient, g.Code, alice.ID)
+
+	connID := connectPoll(t, h)
+	sendMessage(t, h, connID, message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob"})
+	h.commands.Dispatch(aliceClient, message.ClientMessage{Action: message.ActionSendChat, Text: "hi Bob"})
+
+	resp := pollMessages(t, h, connID, "")
+	for _, data := range resp.Messages {
+		if messageType(data) == message.TypeChatMessage {
+			var chat message.ChatMessage
+			json.Unmarshal(data, &chat)
+			if chat.Text != "hi Bob" {
+				t.Errorf("Expected hi Bob, got %q", chat.Text)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected a chatMessage, got %d other messages", len(resp.Messages))
+}
+
+// --- WordListFilter tests ---
+
+func TestWordListFilter(t *testing.T) {
+	f := NewWordListFilter([]string{"Darn", " heck "})
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"well darn it", "well **** it"},
+		{"HECK, DARN!", "****, ****!"},
+		{"darned heckle", "darned heckle"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := f.Filter(tt.text)
+			if !ok || got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
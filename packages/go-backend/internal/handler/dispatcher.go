@@ -0,0 +1,596 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// Broadcast is a message for the clients in a game.
+type Broadcast struct {
+	GameCode string
+	Message  interface{}
+	// IncludeSender also delivers the message to the client that sent the
+	// command, which otherwise only gets the reply.
+	IncludeSender bool
+}
+
+// Result is the outcome of a client command.
+type Result struct {
+	// Reply is sent to the client that sent the command, if not nil.
+	Reply message.Reply
+	// Broadcasts are published to the game after the reply.
+	Broadcasts []Broadcast
+	// Disconnect is set when the client was disconnected for having too many
+	// requests in a row rate limited.
+	Disconnect bool
+}
+
+// maxRequestIDLength is the longest requestId a client may send.
+const maxRequestIDLength = 128
+
+// command is one client action.
+type command struct {
+	run func(client *hub.Client, msg message.ClientMessage) Result
+	// joins is set for commands that act on the game named in the message
+	// rather than the one the connection is in.
+	joins bool
+	// mutates is set for commands that change the game, which a client can
+	// safely retry with an idempotency key.
+	mutates bool
+	// global is set for commands that don't touch a game.
+	global bool
+}
+
+// Dispatcher runs client commands the same way whichever transport they
+// arrived on. Each transport is a thin adapter: it decodes a ClientMessage,
+// dispatches it with the connection's hub client as its identity, and
+// sends the reply.
+//
+// Commands act on the game and player the connection has joined as, not on
+// whatever the message claims, so a client can only play as itself. Each
+// game's commands run one at a time on the game's actor, which also
+// publishes their broadcasts, so events go out in the order they happened.
+//
+// A connection may start with hello to agree a protocol version and the
+// features it wants. They are kept on its hub client, and what it is sent is
+// tailored to them.
+//
+// Each client's requests are rate limited by action class and source IP, and
+// a client with too many limited in a row is disconnected.
+//
+// A player may be connected from several sessions, e.g. browser tabs, and
+// stays connected until the last one closes. Under SessionLastWins joining
+// again closes the older sessions instead.
+//
+// Players in a game can chat. Chat is rate limited per player, passes through
+// a ChatFilter and can be muted by the game's creator, and joining players
+// are sent the game's recent chat. Reactions from a fixed catalogue are
+// tallied by the hub and broadcast as one count per reaction per window.
+//
+// A game with a flush interval has its moves held back and broadcast together
+// as one movesBatch at the end of the interval. Any other broadcast flushes
+// the moves before it, so gameEnded and the rest are never delayed.
+type Dispatcher struct {
+	store    game.Store
+	hub      *hub.Hub
+	commands map[string]command
+
+	// mu guards actors, closed and the batching state.
+	mu     sync.Mutex
+	actors map[string]*gameActor
+	closed bool
+
+	// flushIntervals overrides flushDefault by game, and batches holds each
+	// game's moves waiting to be flushed.
+	flushDefault   time.Duration
+	flushIntervals map[string]time.Duration
+	batches        map[string]*moveBatch
+	batchStats     batchCounters
+
+	// results are the replies to recent actions sent with an idempotency key.
+	results *idempotentResults
+
+	// chat is each game's chat, which passes through chatFilter, if any,
+	// guarded by mu, before it is sent.
+	chat       *chatRooms
+	chatFilter ChatFilter
+
+	// limiter, guarded by mu, limits how fast clients may act.
+	limiter *RateLimiter
+	// sessionPolicy, guarded by mu, is what happens to a player's other
+	// sessions when they join again.
+	sessionPolicy SessionPolicy
+}
+
+// NewDispatcher creates a new Dispatcher.
+func NewDispatcher(store game.Store, h *hub.Hub) *Dispatcher {
+	d := &Dispatcher{
+		store:          store,
+		hub:            h,
+		actors:         make(map[string]*gameActor),
+		flushIntervals: make(map[string]time.Duration),
+		batches:        make(map[string]*moveBatch),
+		results:        newIdempotentResults(),
+		chat:           newChatRooms(),
+		sessionPolicy:  SessionsShared,
+	}
+	d.commands = map[string]command{
+		message.ActionJoinGame:   {run: d.joinGame, joins: true, mutates: true},
+		message.ActionRejoinGame: {run: d.rejoinGame, joins: true},
+		message.ActionRollDice:   {run: d.rollDice, mutates: true},
+		message.ActionStartGame:  {run: d.startGame, mutates: true},
+		message.ActionPing:       {run: d.ping, global: true},
+		message.ActionHello:      {run: d.hello, global: true},
+
+		message.ActionSendChat:     {run: d.sendChat},
+		message.ActionMutePlayer:   {run: d.mutePlayer},
+		message.ActionUnmutePlayer: {run: d.unmutePlayer},
+		message.ActionReact:        {run: d.react},
+	}
+	d.SetReactionWindow(hub.DefaultReactionWindow)
+	return d
+}
+
+// Handles reports whether action is a known command.
+func (d *Dispatcher) Handles(action string) bool {
+	_, ok := d.commands[action]
+	return ok
+}
+
+// Dispatch runs a command for a client and publishes its broadcasts. The
+// reply is left to the caller, e.g. to write as an HTTP response.
+func (d *Dispatcher) Dispatch(client *hub.Client, msg message.ClientMessage) Result {
+	return d.dispatch(client, msg, false)
+}
+
+// DispatchToClient runs a command for a client and queues the reply on the
+// client's hub Send channel ahead of the command's broadcasts.
+func (d *Dispatcher) DispatchToClient(client *hub.Client, msg message.ClientMessage) Result {
+	return d.dispatch(client, msg, true)
+}
+
+// DispatchJSON decodes and runs a command for a client whose replies travel
+// over its hub Send channel, as for WebSocket and SSE.
+func (d *Dispatcher) DispatchJSON(client *hub.Client, data []byte) {
+	d.DispatchEncoded(client, message.JSON, data)
+}
+
+// DispatchEncoded is DispatchJSON for a command in another encoding.
+func (d *Dispatcher) DispatchEncoded(client *hub.Client, codec message.Codec, data []byte) {
+	var msg message.ClientMessage
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		// Garbage counts against the client's limits too
+		if res := d.limit(client, ""); res.Reply != nil {
+			d.refuse(client, res, true)
+			return
+		}
+		d.hub.SendToClient(client, message.NewErrorMessage(message.ErrInvalidMessage, "Invalid message format"))
+		return
+	}
+	d.DispatchToClient(client, msg)
+}
+
+func (d *Dispatcher) dispatch(client *hub.Client, msg message.ClientMessage, sendReply bool) Result {
+	res := d.limit(client, msg.Action)
+	cmd, ok := d.commands[msg.Action]
+	switch {
+	case res.Reply != nil:
+		// Rate limited
+	case len(msg.RequestID) > maxRequestIDLength:
+		// Not worth echoing or logging
+		msg.RequestID = ""
+		res = errorResult(message.ErrInvalidMessage, "requestId is too long")
+	case len(msg.IdempotencyKey) > maxIdempotencyKeyLength:
+		res = errorResult(message.ErrInvalidMessage, "idempotencyKey is too long")
+	case !ok:
+		res = errorResult(message.ErrInvalidMessage, "Unknown action: "+msg.Action)
+	}
+	if res.Reply != nil {
+		res.Reply = answer(client, msg, res.Reply)
+		d.refuse(client, res, sendReply)
+		return res
+	}
+
+	var code string
+	switch {
+	case cmd.joins:
+		code = strings.ToUpper(msg.GameCode)
+	case !cmd.global:
+		code, _ = d.hub.GameOf(client)
+	}
+	if code != "" && d.store.Get(code) == nil {
+		// Nothing to serialize; the command reports the missing game
+		code = ""
+	}
+
+	d.inGame(code, func() {
+		res = d.run(cmd, code, client, msg)
+		if res.Reply != nil {
+			res.Reply = answer(client, msg, res.Reply)
+			if sendReply {
+				d.hub.SendToClient(client, res.Reply)
+			}
+		}
+		d.publish(client, res)
+	})
+	return res
+}
+
+// answer stamps a reply with the requestId of the message it answers, and
+// logs it if it is an error so bug reports can be matched to the log. Rate
+// limited requests aren't logged, or a flood of them would flood the log.
+func answer(client *hub.Client, msg message.ClientMessage, reply message.Reply) message.Reply {
+	if e, ok := reply.(message.ErrorMessage); ok && e.Code != message.ErrRateLimited {
+		if msg.RequestID != "" {
+			log.Printf("Request %q: %q from client %s failed: %s: %s", msg.RequestID, msg.Action, client.ID, e.Code, e.Message)
+		} else {
+			log.Printf("%q from client %s failed: %s: %s", msg.Action, client.ID, e.Code, e.Message)
+		}
+	}
+	if msg.RequestID == "" {
+		return reply
+	}
+	return reply.WithRequestID(msg.RequestID)
+}
+
+// Disconnect marks a client's player as disconnected when its connection goes
+// away, and tells the other players. A player with another session still open
+// in the game stays connected. Only this instance's sessions are counted.
+func (d *Dispatcher) Disconnect(client *hub.Client) Result {
+	code, _ := d.hub.GameOf(client)
+
+	var res Result
+	d.inGame(code, func() {
+		res = d.disconnect(client)
+		d.publish(client, res)
+	})
+	return res
+}
+
+func (d *Dispatcher) disconnect(client *hub.Client) Result {
+	code, playerID := d.hub.GameOf(client)
+	if code == "" || playerID == "" {
+		return Result{}
+	}
+
+	g := d.store.Get(code)
+	if g == nil {
+		return Result{}
+	}
+
+	player := g.GetPlayer(playerID)
+	if player == nil {
+		return Result{}
+	}
+	if len(d.otherSessions(client, code, playerID)) > 0 {
+		return Result{}
+	}
+
+	g.SetPlayerConnected(playerID, false)
+	persistGame(d.store, g)
+
+	return Result{Broadcasts: []Broadcast{{
+		GameCode: code,
+		Message: message.PlayerLeftMessage{
+			Type:       message.TypePlayerLeft,
+			PlayerID:   playerID,
+			PlayerName: player.Name,
+			Version:    g.Version(),
+		},
+	}}}
+}
+
+// publish publishes a result's broadcasts, holding back moves for games that
+// batch them.
+func (d *Dispatcher) publish(client *hub.Client, res Result) {
+	for _, b := range res.Broadcasts {
+		if move, ok := b.Message.(message.PlayerMovedMessage); ok && !b.IncludeSender {
+			if d.batchMove(b.GameCode, client.ID, move) {
+				continue
+			}
+		}
+		// Anything else goes out at once, after the moves before it
+		d.flushMoves(b.GameCode)
+
+		if b.IncludeSender {
+			d.hub.BroadcastToGame(b.GameCode, b.Message)
+		} else {
+			d.hub.BroadcastToGameExcept(b.GameCode, client.ID, b.Message)
+		}
+	}
+}
+
+func (d *Dispatcher) joinGame(client *hub.Client, msg message.ClientMessage) Result {
+	code := strings.ToUpper(msg.GameCode)
+	g := d.store.Get(code)
+	if g == nil {
+		return errorResult(message.ErrGameNotFound, "Game not found")
+	}
+
+	player, err := g.AddPlayer(msg.Name)
+	if err != nil {
+		switch err {
+		case game.ErrGameFull:
+			return errorResult(message.ErrGameFull, "Game is full")
+		case game.ErrGameAlreadyStarted:
+			return errorResult(message.ErrGameAlreadyStarted, "Game has already started")
+		case game.ErrInvalidName:
+			return errorResult(message.ErrInvalidMessage, "Player name is required")
+		default:
+			return errorResult(message.ErrInternalError, "Failed to join game")
+		}
+	}
+
+	persistGame(d.store, g)
+	d.hub.JoinGame(client, code, player.ID)
+
+	return Result{
+		Reply:      d.joinedGame(client, g, player.ID, nil),
+		Broadcasts: []Broadcast{playerJoined(g, player)},
+	}
+}
+
+func (d *Dispatcher) rejoinGame(client *hub.Client, msg message.ClientMessage) Result {
+	code := strings.ToUpper(msg.GameCode)
+	g := d.store.Get(code)
+	if g == nil {
+		return errorResult(message.ErrGameNotFound, "Game not found")
+	}
+
+	player := g.GetPlayer(msg.PlayerID)
+	if player == nil {
+		return errorResult(message.ErrPlayerNotFound, "Player not found in game")
+	}
+
+	g.SetPlayerConnected(msg.PlayerID, true)
+	persistGame(d.store, g)
+	d.replaceSessions(client, code, msg.PlayerID)
+
+	if msg.LastSeq != nil && client.Sequenced() {
+		// Replay what the client missed if the hub numbered it and still has
+		// all of it
+		if seq, ok := d.hub.Resume(client, code, msg.PlayerID, msg.Epoch, *msg.LastSeq); ok {
+			return Result{
+				Reply: message.ResumedMessage{
+					Type:     message.TypeResumed,
+					GameCode: code,
+					PlayerID: msg.PlayerID,
+					LastSeq:  *msg.LastSeq,
+					Seq:      seq,
+					Epoch:    d.hub.Epoch(),
+				},
+				Broadcasts: []Broadcast{playerJoined(g, player)},
+			}
+		}
+	} else {
+		d.hub.JoinGame(client, code, msg.PlayerID)
+	}
+
+	// Same reply as a join, so clients handle both alike
+	return Result{
+		Reply:      d.joinedGame(client, g, msg.PlayerID, msg.Version),
+		Broadcasts: []Broadcast{playerJoined(g, player)},
+	}
+}
+
+func (d *Dispatcher) rollDice(client *hub.Client, msg message.ClientMessage) Result {
+	g, playerID, res := d.currentGame(client)
+	if g == nil {
+		return res
+	}
+
+	player := g.GetPlayer(playerID)
+	if player == nil {
+		return errorResult(message.ErrPlayerNotFound, "Player not found")
+	}
+
+	diceRoll, prevPos, newPos, effect, isWinner, err := g.RollDice(playerID)
+	if err != nil {
+		switch err {
+		case game.ErrGameNotStarted:
+			return errorResult(message.ErrGameNotStarted, "Game has not started")
+		default:
+			return errorResult(message.ErrInternalError, "Failed to roll dice")
+		}
+	}
+
+	persistGame(d.store, g)
+
+	var moveEffect *message.MoveEffect
+	if effect != nil {
+		moveEffect = &message.MoveEffect{
+			Type: effect.Type,
+			From: effect.From,
+			To:   effect.To,
+		}
+	}
+
+	moveMsg := message.PlayerMovedMessage{
+		Type:             message.TypePlayerMoved,
+		PlayerID:         playerID,
+		PlayerName:       player.Name,
+		DiceRoll:         diceRoll,
+		PreviousPosition: prevPos,
+		NewPosition:      newPos,
+		Effect:           moveEffect,
+		Version:          g.Version(),
+	}
+	res = Result{
+		Reply:      moveMsg,
+		Broadcasts: []Broadcast{{GameCode: g.Code, Message: moveMsg}},
+	}
+
+	if isWinner {
+		res.Broadcasts = append(res.Broadcasts, Broadcast{
+			GameCode: g.Code,
+			Message: message.GameEndedMessage{
+				Type:       message.TypeGameEnded,
+				WinnerID:   playerID,
+				WinnerName: player.Name,
+				Version:    moveMsg.Version,
+			},
+			IncludeSender: true,
+		})
+	}
+	return res
+}
+
+func (d *Dispatcher) startGame(client *hub.Client, msg message.ClientMessage) Result {
+	g, playerID, res := d.currentGame(client)
+	if g == nil {
+		return res
+	}
+
+	err := g.Start(playerID)
+	if err != nil {
+		switch err {
+		case game.ErrGameAlreadyStarted:
+			return errorResult(message.ErrGameAlreadyStarted, "Game has already started")
+		case game.ErrNotGameCreator:
+			return errorResult(message.ErrNotGameCreator, "Only the game creator can start the game")
+		default:
+			return errorResult(message.ErrInternalError, "Failed to start game")
+		}
+	}
+
+	persistGame(d.store, g)
+
+	startMsg := message.GameStartedMessage{
+		Type:          message.TypeGameStarted,
+		Game:          gameToInfo(g),
+		FirstPlayerID: g.GetCurrentTurnPlayerID(),
+		Version:       g.Version(),
+	}
+	return Result{
+		Reply:      startMsg,
+		Broadcasts: []Broadcast{{GameCode: g.Code, Message: startMsg}},
+	}
+}
+
+func (d *Dispatcher) ping(client *hub.Client, msg message.ClientMessage) Result {
+	return Result{Reply: message.NewPongMessage()}
+}
+
+// hello negotiates the protocol version and the features the connection
+// will use from now on.
+func (d *Dispatcher) hello(client *hub.Client, msg message.ClientMessage) Result {
+	if msg.ProtocolVersion < message.MinProtocolVersion || msg.ProtocolVersion > message.ProtocolVersion {
+		return errorResult(message.ErrUnsupportedVersion, fmt.Sprintf(
+			"Protocol version %d is not supported, use %d to %d",
+			msg.ProtocolVersion, message.MinProtocolVersion, message.ProtocolVersion))
+	}
+
+	features := []string{}
+	for _, f := range msg.Features {
+		if offersFeature(client, f) && !containsString(features, f) {
+			features = append(features, f)
+		}
+	}
+	client.SetFeatures(features)
+	client.SetSequenced(containsString(features, message.FeatureSequencing))
+
+	welcome := message.WelcomeMessage{
+		Type:            message.TypeWelcome,
+		ProtocolVersion: msg.ProtocolVersion,
+		Features:        features,
+	}
+	if client.Sequenced() {
+		welcome.Epoch = d.hub.Epoch()
+	}
+	return Result{Reply: welcome}
+}
+
+// offersFeature reports whether a client's connection can use a feature.
+func offersFeature(client *hub.Client, feature string) bool {
+	switch feature {
+	case message.FeatureBinary:
+		codec, ok := client.Encoding.(message.Codec)
+		return ok && codec.Binary()
+	case message.FeatureDeltas, message.FeatureSequencing:
+		return true
+	}
+	return false
+}
+
+// hasFeature reports whether a client may be sent a feature's messages.
+// Clients that never said hello may get them all.
+func hasFeature(client *hub.Client, feature string) bool {
+	features, ok := client.Features()
+	return !ok || containsString(features, feature)
+}
+
+// knownVersion returns the state version to send a client a delta against:
+// known, unless the client said hello without deltas.
+func knownVersion(client *hub.Client, known *uint64) *uint64 {
+	if !hasFeature(client, message.FeatureDeltas) {
+		return nil
+	}
+	return known
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// currentGame returns the game and player a client has joined as, or an error
+// result if it hasn't joined one.
+func (d *Dispatcher) currentGame(client *hub.Client) (*game.Game, string, Result) {
+	code, playerID := d.hub.GameOf(client)
+	if code == "" || playerID == "" {
+		return nil, "", errorResult(message.ErrGameNotFound, "Not in a game")
+	}
+
+	g := d.store.Get(code)
+	if g == nil {
+		return nil, "", errorResult(message.ErrGameNotFound, "Game not found")
+	}
+	return g, playerID, Result{}
+}
+
+// joinedGame builds the reply to a join or rejoin, with a delta against the
+// state version the client holds if it sent one.
+func (d *Dispatcher) joinedGame(client *hub.Client, g *game.Game, playerID string, known *uint64) message.JoinedGameMessage {
+	players, delta, version := playerState(g, knownVersion(client, known))
+
+	joined := message.JoinedGameMessage{
+		Type:     message.TypeJoinedGame,
+		PlayerID: playerID,
+		Game:     gameToInfo(g),
+		Players:  players,
+		Delta:    delta,
+		Version:  version,
+		Chat:     d.chat.history(g.Code),
+	}
+	if client.Sequenced() {
+		joined.Seq = d.hub.GameSeq(g.Code)
+	}
+	return joined
+}
+
+// playerJoined tells the other players that a player joined or reconnected.
+func playerJoined(g *game.Game, player *game.Player) Broadcast {
+	return Broadcast{
+		GameCode: g.Code,
+		Message: message.PlayerJoinedMessage{
+			Type:    message.TypePlayerJoined,
+			Player:  playerToInfo(player, g.Code),
+			Version: g.Version(),
+		},
+	}
+}
+
+func errorResult(code, msg string) Result {
+	return Result{Reply: message.NewErrorMessage(code, msg)}
+}
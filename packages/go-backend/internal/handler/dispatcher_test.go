@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func newTestDispatcher() (*Dispatcher, game.Store, *hub.Hub) {
+	store := game.NewMemoryStore()
+	h := hub.NewHub()
+	return NewDispatcher(store, h), store, h
+}
+
+func newDispatcherClient(h *hub.Hub, id string) *hub.Client {
+	client := &hub.Client{ID: id, Send: make(chan []byte, 16)}
+	h.Register(client)
+	return client
+}
+
+// --- Dispatch tests ---
+
+func TestDispatchJoinGame(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, _, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+
+	res := d.Dispatch(client, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: g.Code,
+		Name:     "Bob",
+	})
+
+	joined, ok := res.Reply.(message.JoinedGameMessage)
+	if !ok {
+		t.Fatalf("Expected a joinedGame reply, got %T", res.Reply)
+	}
+	if code, playerID := h.GameOf(client); code != g.Code || playerID != joined.PlayerID {
+		t.Errorf("Client should be joined as %s in %s, got %s in %s", joined.PlayerID, g.Code, playerID, code)
+	}
+	if len(res.Broadcasts) != 1 || res.Broadcasts[0].IncludeSender {
+		t.Fatalf("Expected one playerJoined broadcast for the others, got %+v", res.Broadcasts)
+	}
+	if _, ok := res.Broadcasts[0].Message.(message.PlayerJoinedMessage); !ok {
+		t.Errorf("Expected playerJoined, got %T", res.Broadcasts[0].Message)
+	}
+}
+
+func TestDispatchRejoinExcludesSender(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+	other := newDispatcherClient(h, "c2")
+	h.JoinGame(other, g.Code, "")
+
+	d.DispatchToClient(client, message.ClientMessage{
+		Action:   message.ActionRejoinGame,
+		GameCode: g.Code,
+		PlayerID: alice.ID,
+	})
+
+	if msg := string(<-client.Send); !containsType(msg, message.TypeJoinedGame) {
+		t.Errorf("Expected joinedGame for the sender, got %s", msg)
+	}
+	if len(client.Send) != 0 {
+		t.Error("The sender should not receive its own playerJoined")
+	}
+	if msg := string(<-other.Send); !containsType(msg, message.TypePlayerJoined) {
+		t.Errorf("Expected playerJoined for the other client, got %s", msg)
+	}
+}
+
+func TestDispatchRejoinSendsDelta(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	known := g.Version()
+	bob, _ := g.AddPlayer("Bob")
+	client := newDispatcherClient(h, "c1")
+
+	tests := []struct {
+		name      string
+		version   *uint64
+		wantDelta bool
+	}{
+		{"with version", &known, true},
+		{"without version", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := d.Dispatch(client, message.ClientMessage{
+				Action:   message.ActionRejoinGame,
+				GameCode: g.Code,
+				PlayerID: alice.ID,
+				Version:  tt.version,
+			})
+
+			joined, ok := res.Reply.(message.JoinedGameMessage)
+			if !ok {
+				t.Fatalf("Expected a joinedGame reply, got %T", res.Reply)
+			}
+			if joined.Version != g.Version() {
+				t.Errorf("Expected version %d, got %d", g.Version(), joined.Version)
+			}
+			if !tt.wantDelta {
+				if joined.Delta != nil || len(joined.Players) != 2 {
+					t.Errorf("Expected the full player list, got %+v", joined)
+				}
+				return
+			}
+			if joined.Players != nil || joined.Delta == nil {
+				t.Fatalf("Expected only a delta, got %+v", joined)
+			}
+			if len(joined.Delta.Added) != 1 || joined.Delta.Added[0].ID != bob.ID {
+				t.Errorf("Expected Bob to be added, got %+v", joined.Delta.Added)
+			}
+		})
+	}
+}
+
+func TestDispatchUsesConnectionIdentity(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+
+	client := newDispatcherClient(h, "c1")
+	h.JoinGame(client, g.Code, bob.ID)
+
+	// Bob's connection can't roll for Alice by naming her
+	before := playerPosition(g, alice.ID)
+	res := d.Dispatch(client, message.ClientMessage{
+		Action:   message.ActionRollDice,
+		GameCode: g.Code,
+		PlayerID: alice.ID,
+	})
+
+	moved, ok := res.Reply.(message.PlayerMovedMessage)
+	if !ok {
+		t.Fatalf("Expected a playerMoved reply, got %T", res.Reply)
+	}
+	if moved.PlayerID != bob.ID {
+		t.Errorf("Expected the roll to be Bob's, got %s", moved.PlayerID)
+	}
+	if pos := playerPosition(g, alice.ID); pos != before {
+		t.Errorf("Alice should not have moved, got position %d", pos)
+	}
+}
+
+func TestDispatchErrors(t *testing.T) {
+	d, _, h := newTestDispatcher()
+	client := newDispatcherClient(h, "c1")
+
+	tests := []struct {
+		name string
+		msg  message.ClientMessage
+		code string
+	}{
+		{"unknown action", message.ClientMessage{Action: "fly"}, message.ErrInvalidMessage},
+		{"join missing game", message.ClientMessage{Action: message.ActionJoinGame, GameCode: "NOPE00", Name: "Bob"}, message.ErrGameNotFound},
+		{"roll without joining", message.ClientMessage{Action: message.ActionRollDice}, message.ErrGameNotFound},
+		{"start without joining", message.ClientMessage{Action: message.ActionStartGame}, message.ErrGameNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := d.Dispatch(client, tt.msg)
+			errMsg, ok := res.Reply.(message.ErrorMessage)
+			if !ok {
+				t.Fatalf("Expected an error reply, got %T", res.Reply)
+			}
+			if errMsg.Code != tt.code {
+				t.Errorf("Expected code %s, got %s", tt.code, errMsg.Code)
+			}
+			if len(res.Broadcasts) != 0 {
+				t.Errorf("Errors should not broadcast, got %d", len(res.Broadcasts))
+			}
+		})
+	}
+}
+
+func TestDispatchJSONInvalid(t *testing.T) {
+	d, _, h := newTestDispatcher()
+	client := newDispatcherClient(h, "c1")
+
+	d.DispatchJSON(client, []byte("not json"))
+
+	if msg := string(<-client.Send); !containsType(msg, message.TypeError) {
+		t.Errorf("Expected an error message, got %s", msg)
+	}
+}
+
+func TestDispatchEchoesRequestID(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+
+	client := newDispatcherClient(h, "c1")
+	h.JoinGame(client, g.Code, alice.ID)
+	other := newDispatcherClient(h, "c2")
+	h.JoinGame(other, g.Code, bob.ID)
+
+	tests := []struct {
+		name   string
+		msg    message.ClientMessage
+		want   string
+		wantID string
+	}{
+		{"reply", message.ClientMessage{Action: message.ActionRollDice, RequestID: "r1"}, message.TypePlayerMoved, "r1"},
+		{"error", message.ClientMessage{Action: message.ActionStartGame, RequestID: "r2"}, message.TypeError, "r2"},
+		{"unknown action", message.ClientMessage{Action: "fly", RequestID: "r3"}, message.TypeError, "r3"},
+		{"too long", message.ClientMessage{Action: message.ActionPing, RequestID: strings.Repeat("r", maxRequestIDLength+1)}, message.TypeError, ""},
+		{"no request ID", message.ClientMessage{Action: message.ActionPing}, message.TypePong, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.DispatchToClient(client, tt.msg)
+
+			var reply struct {
+				Type      string `json:"type"`
+				RequestID string `json:"requestId"`
+			}
+			json.Unmarshal(<-client.Send, &reply)
+			if reply.Type != tt.want || reply.RequestID != tt.wantID {
+				t.Errorf("Expected %s with requestId %q, got %+v", tt.want, tt.wantID, reply)
+			}
+		})
+	}
+
+	// The roll's broadcast isn't a reply
+	if msg := string(<-other.Send); !containsType(msg, message.TypePlayerMoved) || strings.Contains(msg, "requestId") {
+		t.Errorf("Expected playerMoved without a requestId, got %s", msg)
+	}
+}
+
+// --- Handshake tests ---
+
+func TestDispatchHello(t *testing.T) {
+	d, _, h := newTestDispatcher()
+
+	tests := []struct {
+		name     string
+		version  int
+		features []string
+		want     []string
+		wantErr  bool
+	}{
+		{"current version", message.ProtocolVersion,
+			[]string{message.FeatureBinary, message.FeatureDeltas, "teleport", message.FeatureSequencing, message.FeatureDeltas},
+			[]string{message.FeatureDeltas, message.FeatureSequencing}, false},
+		{"no features", message.ProtocolVersion, nil, []string{}, false},
+		{"missing version", 0, nil, nil, true},
+		{"too new", message.ProtocolVersion + 1, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newDispatcherClient(h, tt.name)
+			res := d.Dispatch(client, message.ClientMessage{
+				Action:          message.ActionHello,
+				ProtocolVersion: tt.version,
+				Features:        tt.features,
+			})
+
+			if tt.wantErr {
+				errMsg, ok := res.Reply.(message.ErrorMessage)
+				if !ok || errMsg.Code != message.ErrUnsupportedVersion {
+					t.Errorf("Expected %s, got %+v", message.ErrUnsupportedVersion, res.Reply)
+				}
+				if _, negotiated := client.Features(); negotiated {
+					t.Error("A rejected hello should not change the connection")
+				}
+				return
+			}
+
+			welcome, ok := res.Reply.(message.WelcomeMessage)
+			if !ok {
+				t.Fatalf("Expected a welcome reply, got %T", res.Reply)
+			}
+			if !reflect.DeepEqual(welcome.Features, tt.want) {
+				t.Errorf("Expected features %v, got %v", tt.want, welcome.Features)
+			}
+			if client.Sequenced() != containsString(tt.want, message.FeatureSequencing) {
+				t.Errorf("Expected sequencing to follow the agreed features")
+			}
+			if (welcome.Epoch != "") != client.Sequenced() {
+				t.Errorf("Expected an epoch only with sequencing, got %q", welcome.Epoch)
+			}
+		})
+	}
+}
+
+func TestRejoinResumesOnlyInSameEpoch(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	h.BroadcastToGame(g.Code, message.NewPongMessage())
+
+	tests := []struct {
+		name       string
+		epoch      string
+		wantResume bool
+	}{
+		{"same instance", h.Epoch(), true},
+		{"another instance", hub.NewHub().Epoch(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newDispatcherClient(h, tt.name)
+			d.Dispatch(client, message.ClientMessage{
+				Action:          message.ActionHello,
+				ProtocolVersion: message.ProtocolVersion,
+				Features:        []string{message.FeatureSequencing},
+			})
+			lastSeq := uint64(1)
+
+			res := d.DispatchToClient(client, message.ClientMessage{
+				Action:   message.ActionRejoinGame,
+				GameCode: g.Code,
+				PlayerID: alice.ID,
+				LastSeq:  &lastSeq,
+				Epoch:    tt.epoch,
+			})
+
+			resumed, ok := res.Reply.(message.ResumedMessage)
+			if ok != tt.wantResume {
+				t.Fatalf("Expected resume %v, got %T", tt.wantResume, res.Reply)
+			}
+			if ok && resumed.Epoch != h.Epoch() {
+				t.Errorf("Expected epoch %s, got %s", h.Epoch(), resumed.Epoch)
+			}
+		})
+	}
+}
+
+func TestHelloWithoutFeaturesGetsFullState(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	known := g.Version()
+	g.AddPlayer("Bob")
+	watcher := newDispatcherClient(h, "watcher")
+	h.JoinGame(watcher, g.Code, "")
+	h.BroadcastToGame(g.Code, message.NewPongMessage())
+	<-watcher.Send
+
+	client := newDispatcherClient(h, "c1")
+	d.Dispatch(client, message.ClientMessage{Action: message.ActionHello, ProtocolVersion: message.ProtocolVersion})
+
+	res := d.DispatchToClient(client, message.ClientMessage{
+		Action:   message.ActionRejoinGame,
+		GameCode: g.Code,
+		PlayerID: alice.ID,
+		LastSeq:  new(uint64),
+		Version:  &known,
+	})
+
+	joined, ok := res.Reply.(message.JoinedGameMessage)
+	if !ok {
+		t.Fatalf("Expected joinedGame rather than a resume, got %T", res.Reply)
+	}
+	if joined.Delta != nil || len(joined.Players) != 2 {
+		t.Errorf("Expected the full player list, got %+v", joined)
+	}
+	if joined.Seq != 0 {
+		t.Errorf("Expected no seq, got %d", joined.Seq)
+	}
+	<-client.Send
+	h.BroadcastToGame(g.Code, message.NewPongMessage())
+	if msg := string(<-client.Send); strings.Contains(msg, `"seq"`) {
+		t.Errorf("Expected broadcasts without seq, got %s", msg)
+	}
+}
+
+// --- Disconnect tests ---
+
+func TestDisconnectMarksPlayerDisconnected(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	res := d.Disconnect(client)
+
+	for _, p := range g.GetPlayers() {
+		if p.ID == alice.ID && p.IsConnected {
+			t.Error("Alice should be disconnected")
+		}
+	}
+	if len(res.Broadcasts) != 1 {
+		t.Fatalf("Expected one playerLeft broadcast, got %d", len(res.Broadcasts))
+	}
+	if _, ok := res.Broadcasts[0].Message.(message.PlayerLeftMessage); !ok {
+		t.Errorf("Expected playerLeft, got %T", res.Broadcasts[0].Message)
+	}
+
+	// A connection that never joined has nothing to do
+	if res := d.Disconnect(newDispatcherClient(h, "c2")); len(res.Broadcasts) != 0 {
+		t.Errorf("Expected no broadcasts, got %d", len(res.Broadcasts))
+	}
+}
+
+func containsType(data, msgType string) bool {
+	return messageType([]byte(data)) == msgType
+}
+
+func playerPosition(g *game.Game, playerID string) int {
+	for _, p := range g.GetPlayers() {
+		if p.ID == playerID {
+			return p.Position
+		}
+	}
+	return -1
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// NewExpiryNotifier returns a callback for game.Store.ExpireGames that stops
+// the game's actor, tells its clients the game is about to be removed and
+// detaches them from it.
+func NewExpiryNotifier(h *hub.Hub, commands *Dispatcher, polls *PollHandler) func(*game.Game) {
+	return func(g *game.Game) {
+		// Let commands already under way finish and broadcast first
+		commands.StopGame(g.Code)
+
+		msg := message.GameExpiredMessage{
+			Type:     message.TypeGameExpired,
+			GameCode: g.Code,
+			Status:   g.GetStatus(),
+		}
+
+		h.BroadcastToGame(g.Code, msg)
+		h.RemoveGame(g.Code)
+		polls.pollStore.ExpireGame(g.Code)
+	}
+}
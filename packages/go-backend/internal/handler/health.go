@@ -11,12 +11,12 @@ import (
 
 // HealthHandler handles health check requests.
 type HealthHandler struct {
-	store     *game.Store
+	store     game.Store
 	startTime time.Time
 }
 
 // NewHealthHandler creates a new health handler.
-func NewHealthHandler(store *game.Store) *HealthHandler {
+func NewHealthHandler(store game.Store) *HealthHandler {
 	return &HealthHandler{
 		store:     store,
 		startTime: time.Now(),
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -12,11 +14,11 @@ import (
 
 // HTTPHandler handles HTTP API requests.
 type HTTPHandler struct {
-	store *game.Store
+	store game.Store
 }
 
 // NewHTTPHandler creates a new HTTP handler.
-func NewHTTPHandler(store *game.Store) *HTTPHandler {
+func NewHTTPHandler(store game.Store) *HTTPHandler {
 	return &HTTPHandler{store: store}
 }
 
@@ -37,11 +39,21 @@ type GetGameResponse struct {
 	Players []message.PlayerInfo `json:"players"`
 }
 
+// ReplayResponse represents a game's full event timeline.
+type ReplayResponse struct {
+	GameCode string       `json:"gameCode"`
+	Events   []game.Event `json:"events"`
+}
+
 // ErrorResponse represents an error response.
 type ErrorResponse struct {
 	Type    string `json:"type"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// RequestID echoes the requestId of the client message that failed.
+	RequestID string `json:"requestId,omitempty"`
+	// RetryAfterMs is how long to wait before trying again, for RATE_LIMITED.
+	RetryAfterMs int `json:"retryAfterMs,omitempty"`
 }
 
 // HandleCreateGame handles POST /games requests.
@@ -62,7 +74,16 @@ func (h *HTTPHandler) HandleCreateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	g, player := h.store.Create(req.CreatorName)
+	g, player, err := h.store.Create(req.CreatorName)
+	if err != nil {
+		log.Printf("Error creating game: %v", err)
+		if errors.Is(err, game.ErrNoFreeCode) {
+			h.writeError(w, http.StatusServiceUnavailable, message.ErrInternalError, "No game codes available, please try again")
+		} else {
+			h.writeError(w, http.StatusInternalServerError, message.ErrInternalError, "Failed to create game")
+		}
+		return
+	}
 
 	response := CreateGameResponse{
 		Game:     gameToInfo(g),
@@ -111,14 +132,97 @@ func (h *HTTPHandler) HandleGetGame(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// HandleGetReplay handles GET /games/{code}/replay requests.
+func (h *HTTPHandler) HandleGetReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract game code from path
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/games/"), "/replay")
+	code := strings.ToUpper(strings.TrimSpace(path))
+
+	if code == "" {
+		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Game code is required")
+		return
+	}
+
+	if h.store.Get(code) == nil {
+		h.writeError(w, http.StatusNotFound, message.ErrGameNotFound, "Game not found")
+		return
+	}
+
+	// The game only keeps its recent events; the store has the rest.
+	events, err := h.store.History(code)
+	if err != nil {
+		log.Printf("Error reading history of game %s: %v", code, err)
+		h.writeError(w, http.StatusInternalServerError, message.ErrInternalError, "Failed to read replay")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReplayResponse{GameCode: code, Events: events})
+}
+
 func (h *HTTPHandler) writeError(w http.ResponseWriter, status int, code, msg string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: code, Message: msg})
 }
 
+// persistGame saves a mutated game. The in-memory game stays authoritative,
+// so a failed write is logged rather than reported to the client.
+func persistGame(store game.Store, g *game.Game) {
+	if err := store.Save(g); err != nil {
+		log.Printf("Error saving game %s: %v", g.Code, err)
+	}
+}
+
 // Helper functions to convert game types to message types
 
+// gameStateMessage builds the state of a game for a client to resync to: a
+// delta if the client says which state version it holds, otherwise a full
+// snapshot.
+func gameStateMessage(g *game.Game, known *uint64) message.GameStateMessage {
+	players, delta, version := playerState(g, known)
+
+	return message.GameStateMessage{
+		Type:          message.TypeGameState,
+		Game:          gameToInfo(g),
+		Players:       players,
+		Delta:         delta,
+		CurrentTurnID: g.GetCurrentTurnPlayerID(),
+		Version:       version,
+	}
+}
+
+// playerState returns the players of a game for a client holding state
+// version known, which may be nil. It is a delta against that version if the
+// game can still build one, and the full list otherwise.
+func playerState(g *game.Game, known *uint64) ([]message.PlayerInfo, *message.GameDelta, uint64) {
+	if known != nil {
+		if d, ok := g.ChangesSince(*known); ok {
+			delta := &message.GameDelta{
+				FromVersion: d.From,
+				Positions:   d.Positions,
+				Connected:   d.Connected,
+			}
+			for i := range d.Added {
+				delta.Added = append(delta.Added, playerToInfo(&d.Added[i], g.Code))
+			}
+			return nil, delta, d.To
+		}
+	}
+
+	players, version := g.PlayersAt()
+	playerInfos := make([]message.PlayerInfo, len(players))
+	for i, p := range players {
+		playerInfos[i] = playerToInfo(p, g.Code)
+	}
+	return playerInfos, nil, version
+}
+
 func gameToInfo(g *game.Game) message.GameInfo {
 	code, status, creatorID, winnerID, board, createdAt, updatedAt := g.GetInfo()
 
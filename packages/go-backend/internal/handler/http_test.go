@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestGetReplayReturnsTimeline(t *testing.T) {
+	store := game.NewMemoryStore()
+	h := NewHTTPHandler(store)
+
+	g, alice, _ := store.Create("Alice")
+	g.AddPlayer("Bob")
+	g.Start(alice.ID)
+	g.RollDice(alice.ID)
+
+	req := httptest.NewRequest(http.MethodGet, "/games/"+strings.ToLower(g.Code)+"/replay", nil)
+	w := httptest.NewRecorder()
+	h.HandleGetReplay(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		GameCode string `json:"gameCode"`
+		Events   []struct {
+			Seq  uint64 `json:"seq"`
+			Type string `json:"type"`
+		} `json:"events"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if resp.GameCode != g.Code {
+		t.Errorf("Expected game code %s, got %s", g.Code, resp.GameCode)
+	}
+
+	want := []string{game.EventGameCreated, game.EventPlayerAdded, game.EventGameStarted, game.EventDiceRolled}
+	if len(resp.Events) < len(want) {
+		t.Fatalf("Expected at least %d events, got %d", len(want), len(resp.Events))
+	}
+	for i, typ := range want {
+		if resp.Events[i].Type != typ {
+			t.Errorf("Event %d: expected %s, got %s", i, typ, resp.Events[i].Type)
+		}
+		if resp.Events[i].Seq != uint64(i+1) {
+			t.Errorf("Event %d: expected seq %d, got %d", i, i+1, resp.Events[i].Seq)
+		}
+	}
+}
+
+func TestGetReplayReturnsWholeGame(t *testing.T) {
+	store := game.NewMemoryStore()
+	h := NewHTTPHandler(store)
+
+	g, _, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	for i := 0; i < 3*game.MaxDeltaEvents; i++ {
+		g.SetPlayerConnected(bob.ID, i%2 == 1)
+		persistGame(store, g)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/games/"+g.Code+"/replay", nil)
+	w := httptest.NewRecorder()
+	h.HandleGetReplay(w, req)
+
+	var resp ReplayResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if uint64(len(resp.Events)) != g.Version() || resp.Events[0].Seq != 1 {
+		t.Errorf("Expected all %d events from seq 1, got %d", g.Version(), len(resp.Events))
+	}
+}
+
+func TestGetReplayGameNotFound(t *testing.T) {
+	h := NewHTTPHandler(game.NewMemoryStore())
+
+	req := httptest.NewRequest(http.MethodGet, "/games/XXXXXX/replay", nil)
+	w := httptest.NewRecorder()
+	h.HandleGetReplay(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != message.ErrGameNotFound {
+		t.Errorf("Expected GAME_NOT_FOUND, got %s", resp.Code)
+	}
+}
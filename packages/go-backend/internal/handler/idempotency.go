@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+const (
+	// idempotencyTTL is how long the reply to a keyed action is kept for
+	// retries of it.
+	idempotencyTTL = 5 * time.Minute
+	// maxIdempotencyKeys is how many recent keys are kept per player, or per
+	// game for joins.
+	maxIdempotencyKeys = 32
+	// maxIdempotencyKeyLength is the longest idempotency key a client may send.
+	maxIdempotencyKeyLength = 128
+)
+
+// idempotentResults remembers the replies to recent keyed actions, by game
+// and then by scope, so a retried action gets its first reply back instead
+// of being applied again.
+type idempotentResults struct {
+	mu    sync.Mutex
+	games map[string]map[string][]keyedReply
+}
+
+// keyedReply is the reply to an action sent with an idempotency key.
+type keyedReply struct {
+	key   string
+	reply message.Reply
+	at    time.Time
+}
+
+func newIdempotentResults() *idempotentResults {
+	return &idempotentResults{games: make(map[string]map[string][]keyedReply)}
+}
+
+// lookup returns the reply remembered for key, if it hasn't expired.
+func (r *idempotentResults) lookup(code, scope, key string) (message.Reply, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.games[code][scope] {
+		if k.key == key && time.Since(k.at) < idempotencyTTL {
+			return k.reply, true
+		}
+	}
+	return nil, false
+}
+
+// store remembers the reply for key, forgetting the oldest keys in the
+// scope beyond maxIdempotencyKeys and any that have expired.
+func (r *idempotentResults) store(code, scope, key string, reply message.Reply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scopes, ok := r.games[code]
+	if !ok {
+		scopes = make(map[string][]keyedReply)
+		r.games[code] = scopes
+	}
+
+	now := time.Now()
+	recent := scopes[scope]
+	for len(recent) > 0 && (len(recent) >= maxIdempotencyKeys || now.Sub(recent[0].at) >= idempotencyTTL) {
+		recent = recent[1:]
+	}
+	scopes[scope] = append(recent, keyedReply{key: key, reply: reply, at: now})
+}
+
+// forget drops everything remembered for a game.
+func (r *idempotentResults) forget(code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.games, code)
+}
+
+// run runs a command on the game with the given code, or for a retried
+// mutating action returns the reply it got the first time without applying it
+// again. It runs on the game's actor, so a retry racing the original waits
+// for it.
+func (d *Dispatcher) run(cmd command, code string, client *hub.Client, msg message.ClientMessage) Result {
+	if msg.IdempotencyKey == "" || !cmd.mutates || code == "" {
+		return cmd.run(client, msg)
+	}
+
+	// Joins are scoped to the game, as the player doesn't exist yet and a
+	// retry may come over a new connection
+	scope := "join"
+	if !cmd.joins {
+		_, playerID := d.hub.GameOf(client)
+		if playerID == "" {
+			return cmd.run(client, msg)
+		}
+		scope = "player:" + playerID
+	}
+
+	if reply, ok := d.results.lookup(code, scope, msg.IdempotencyKey); ok {
+		// A retry from another connection takes over the player the first
+		// attempt created
+		if joined, ok := reply.(message.JoinedGameMessage); ok && cmd.joins {
+			if _, playerID := d.hub.GameOf(client); playerID != joined.PlayerID {
+				return d.rejoinGame(client, message.ClientMessage{
+					Action:   message.ActionRejoinGame,
+					GameCode: code,
+					PlayerID: joined.PlayerID,
+				})
+			}
+		}
+		return Result{Reply: reply}
+	}
+	res := cmd.run(client, msg)
+	if res.Reply != nil {
+		d.results.store(code, scope, msg.IdempotencyKey, res.Reply)
+	}
+	return res
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestRetriedRollAppliedOnce(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	g.Start(alice.ID)
+
+	client := newDispatcherClient(h, "c1")
+	h.JoinGame(client, g.Code, alice.ID)
+	other := newDispatcherClient(h, "c2")
+	h.JoinGame(other, g.Code, bob.ID)
+
+	roll := message.ClientMessage{Action: message.ActionRollDice, IdempotencyKey: "roll-1"}
+	first := d.Dispatch(client, roll)
+	position := playerPosition(g, alice.ID)
+	retry := d.Dispatch(client, roll)
+
+	firstMove, _ := first.Reply.(message.PlayerMovedMessage)
+	retryMove, ok := retry.Reply.(message.PlayerMovedMessage)
+	if !ok || retryMove != firstMove {
+		t.Errorf("Expected the first reply again, got %+v", retry.Reply)
+	}
+	if len(retry.Broadcasts) != 0 {
+		t.Error("A retry should not broadcast again")
+	}
+	if pos := playerPosition(g, alice.ID); pos != position {
+		t.Errorf("Expected Alice to stay at %d, got %d", position, pos)
+	}
+	if len(other.Send) != 1 {
+		t.Errorf("Expected 1 move broadcast, got %d", len(other.Send))
+	}
+
+	// The key belongs to the player, so it holds on a new connection too
+	reconnected := newDispatcherClient(h, "c3")
+	h.JoinGame(reconnected, g.Code, alice.ID)
+	if res := d.Dispatch(reconnected, roll); res.Reply != first.Reply {
+		t.Errorf("Expected the first reply on a new connection, got %+v", res.Reply)
+	}
+
+	roll.IdempotencyKey = "roll-2"
+	d.Dispatch(client, roll)
+	if len(other.Send) != 2 {
+		t.Error("A new key should roll again")
+	}
+}
+
+func TestRetriedJoinAppliedOnce(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, _, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+
+	join := message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob", IdempotencyKey: "join-1"}
+	first := d.Dispatch(client, join)
+	retry := d.Dispatch(client, join)
+
+	if len(g.GetPlayers()) != 2 {
+		t.Errorf("Expected Bob to join once, got %d players", len(g.GetPlayers()))
+	}
+	firstJoin, _ := first.Reply.(message.JoinedGameMessage)
+	retryJoin, ok := retry.Reply.(message.JoinedGameMessage)
+	if !ok || retryJoin.PlayerID != firstJoin.PlayerID {
+		t.Errorf("Expected the first join's player, got %+v", retry.Reply)
+	}
+}
+
+func TestRetriedJoinOnNewConnectionAppliedOnce(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, _, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+
+	join := message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob", IdempotencyKey: "join-1"}
+	first := d.Dispatch(client, join)
+	// The first connection dropped before the reply arrived
+	h.Unregister(client)
+	reconnected := newDispatcherClient(h, "c2")
+	retry := d.Dispatch(reconnected, join)
+
+	if len(g.GetPlayers()) != 2 {
+		t.Errorf("Expected Bob to join once, got %d players", len(g.GetPlayers()))
+	}
+	firstJoin, _ := first.Reply.(message.JoinedGameMessage)
+	retryJoin, ok := retry.Reply.(message.JoinedGameMessage)
+	if !ok || retryJoin.PlayerID != firstJoin.PlayerID {
+		t.Errorf("Expected the first join's player, got %+v", retry.Reply)
+	}
+	if code, playerID := h.GameOf(reconnected); code != g.Code || playerID != firstJoin.PlayerID {
+		t.Errorf("Expected the new connection to be in the game as %s, got %s/%s", firstJoin.PlayerID, code, playerID)
+	}
+}
+
+func TestStopGameForgetsIdempotencyKeys(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "c1")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	d.Dispatch(client, message.ClientMessage{Action: message.ActionStartGame, IdempotencyKey: "start"})
+	d.StopGame(g.Code)
+
+	if _, ok := d.results.lookup(g.Code, "player:"+alice.ID, "start"); ok {
+		t.Error("Expected the game's keys to be forgotten")
+	}
+}
+
+func TestIdempotentResultsForgetOldKeys(t *testing.T) {
+	r := newIdempotentResults()
+	for i := 0; i <= maxIdempotencyKeys; i++ {
+		r.store("GAME01", "player:p1", fmt.Sprintf("k%d", i), message.ErrorMessage{Message: fmt.Sprintf("reply %d", i)})
+	}
+
+	if _, ok := r.lookup("GAME01", "player:p1", "k0"); ok {
+		t.Error("Expected the oldest key to be forgotten")
+	}
+	if reply, ok := r.lookup("GAME01", "player:p1", fmt.Sprintf("k%d", maxIdempotencyKeys)); !ok || reply.(message.ErrorMessage).Message != fmt.Sprintf("reply %d", maxIdempotencyKeys) {
+		t.Errorf("Expected the newest key to be kept, got %v", reply)
+	}
+	if _, ok := r.lookup("GAME01", "player:p2", "k1"); ok {
+		t.Error("Keys should be per player")
+	}
+
+	// Expired keys are not returned
+	r.games["GAME01"]["player:p1"][maxIdempotencyKeys-1].at = time.Now().Add(-idempotencyTTL)
+	if _, ok := r.lookup("GAME01", "player:p1", fmt.Sprintf("k%d", maxIdempotencyKeys)); ok {
+		t.Error("Expected an expired key to be ignored")
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"strings"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,13 +16,41 @@ import (
 	"github.com/snakes-and-ladders/go-backend/internal/message"
 )
 
+const (
+	// DefaultPollTimeout is how long GET /poll/messages waits for a message
+	// when the request doesn't say.
+	DefaultPollTimeout = 25 * time.Second
+	// MaxPollTimeout caps the timeout a request may ask for.
+	MaxPollTimeout = 60 * time.Second
+
+	// pollQueueSize bounds the messages queued for a poll connection between
+	// polls; beyond it the hub's slow consumer policy applies.
+	pollQueueSize = 256
+	// pollWriteWait is added to the poll timeout for writing the response.
+	pollWriteWait = 10 * time.Second
+)
+
 // PollConnection represents a long-polling client connection.
 type PollConnection struct {
-	ID           string
+	ID string
+	// GameCode, PlayerID and LastPollTime are guarded by the PollStore's mu.
 	GameCode     string
 	PlayerID     string
 	LastPollTime time.Time
 	CreatedAt    time.Time
+
+	// client receives the connection's game broadcasts from the hub.
+	client *hub.Client
+
+	// pollMu serializes polls so messages are returned in order.
+	pollMu sync.Mutex
+	// cursor is the seq of the last message returned, and unacked the batch
+	// it ended, kept until the client polls again with that cursor.
+	cursor  uint64
+	unacked []json.RawMessage
+	// version is the state version the client last said it holds, so a
+	// resync can send a delta against it.
+	version *uint64
 }
 
 // PollStore provides thread-safe in-memory storage for poll connections.
@@ -67,6 +96,13 @@ func (s *PollStore) UpdateLastPoll(id string) {
 	}
 }
 
+// GameOf returns the game and player a connection is linked to.
+func (s *PollStore) GameOf(conn *PollConnection) (gameCode, playerID string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return conn.GameCode, conn.PlayerID
+}
+
 // UpdateGame links a connection to a game and player.
 func (s *PollStore) UpdateGame(id, gameCode, playerID string) {
 	s.mu.Lock()
@@ -77,6 +113,18 @@ func (s *PollStore) UpdateGame(id, gameCode, playerID string) {
 	}
 }
 
+// ExpireGame unlinks every connection from a game.
+func (s *PollStore) ExpireGame(gameCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		if conn.GameCode == gameCode {
+			conn.GameCode = ""
+			conn.PlayerID = ""
+		}
+	}
+}
+
 // CleanupStale removes connections inactive longer than maxInactivity and returns them.
 func (s *PollStore) CleanupStale(maxInactivity time.Duration) []*PollConnection {
 	s.mu.Lock()
@@ -97,16 +145,18 @@ func (s *PollStore) CleanupStale(maxInactivity time.Duration) []*PollConnection
 
 // PollHandler handles long-polling HTTP endpoints.
 type PollHandler struct {
-	store     *game.Store
+	store     game.Store
 	hub       *hub.Hub
+	commands  *Dispatcher
 	pollStore *PollStore
 }
 
 // NewPollHandler creates a new PollHandler.
-func NewPollHandler(store *game.Store, h *hub.Hub) *PollHandler {
+func NewPollHandler(store game.Store, h *hub.Hub, commands *Dispatcher) *PollHandler {
 	return &PollHandler{
 		store:     store,
 		hub:       h,
+		commands:  commands,
 		pollStore: NewPollStore(),
 	}
 }
@@ -124,14 +174,29 @@ func (h *PollHandler) HandleConnect(w http.ResponseWriter, r *http.Request) {
 		ID:           id,
 		LastPollTime: now,
 		CreatedAt:    now,
+		client: &hub.Client{
+			ID:       id,
+			Send:     make(chan []byte, pollQueueSize),
+			RemoteIP: h.commands.clientIP(r),
+		},
 	}
+	h.hub.Register(conn.client)
 	h.pollStore.Add(conn)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"connectionId": id})
 }
 
-// HandleMessages handles GET /poll/messages — returns current game state snapshot.
+// HandleMessages handles GET /poll/messages — waits for the connection's next
+// game events and returns them with a cursor.
+//
+// The request waits up to ?timeout= seconds (DefaultPollTimeout if unset) for
+// a message, returning an empty list if none arrives. The response's cursor
+// is the seq of the last event returned. Passing it back as ?cursor=
+// acknowledges the batch; passing an older cursor gets the unacknowledged
+// events of the last batch again, for when a response was lost. ?version=
+// is the state version the client holds; a resync after dropped messages is
+// sent as a delta against it.
 func (h *PollHandler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -150,36 +215,167 @@ func (h *PollHandler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	timeout, err := parsePollTimeout(r.URL.Query().Get("timeout"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Invalid timeout")
+		return
+	}
+	var cursor *uint64
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		v, err := strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Invalid cursor")
+			return
+		}
+		cursor = &v
+	}
+	var version *uint64
+	if s := r.URL.Query().Get("version"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Invalid version")
+			return
+		}
+		version = &v
+	}
+
 	h.pollStore.UpdateLastPoll(connID)
+	// A long poll counts as activity for as long as it waits
+	defer h.pollStore.UpdateLastPoll(connID)
 
-	if conn.GameCode == "" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"messages": []interface{}{}})
-		return
+	// The server's write timeout is shorter than a long poll
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + pollWriteWait))
+
+	conn.pollMu.Lock()
+	defer conn.pollMu.Unlock()
+
+	if version != nil {
+		conn.version = version
+	}
+	messages := conn.resend(cursor)
+	if len(messages) > 0 {
+		messages = append(messages, h.takeQueued(conn)...)
+	} else {
+		messages = h.waitForMessages(r, conn, timeout)
 	}
+	conn.ack(messages)
 
-	g := h.store.Get(conn.GameCode)
-	if g == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"messages": []interface{}{}})
-		return
+	if messages == nil {
+		messages = []json.RawMessage{}
 	}
 
-	players := g.GetPlayers()
-	playerInfos := make([]message.PlayerInfo, len(players))
-	for i, p := range players {
-		playerInfos[i] = playerToInfo(p, conn.GameCode)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+		"cursor":   conn.cursor,
+	})
+}
+
+// waitForMessages returns the connection's queued messages, waiting up to
+// timeout for the first one if there are none.
+func (h *PollHandler) waitForMessages(r *http.Request, conn *PollConnection, timeout time.Duration) []json.RawMessage {
+	if messages := h.takeQueued(conn); len(messages) > 0 || timeout <= 0 || conn.client == nil {
+		return messages
 	}
 
-	gameState := message.GameStateMessage{
-		Type:          message.TypeGameState,
-		Game:          gameToInfo(g),
-		Players:       playerInfos,
-		CurrentTurnID: g.GetCurrentTurnPlayerID(),
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case data, ok := <-conn.client.Send:
+		if !ok {
+			return nil
+		}
+		return append([]json.RawMessage{data}, h.takeQueued(conn)...)
+	case <-timer.C:
+		return nil
+	case <-r.Context().Done():
+		return nil
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"messages": []interface{}{gameState}})
+// takeQueued returns the messages queued for a connection without waiting,
+// including any the slow consumer policy held back. Callers must hold pollMu.
+func (h *PollHandler) takeQueued(conn *PollConnection) []json.RawMessage {
+	if conn.client == nil {
+		return nil
+	}
+
+	var messages []json.RawMessage
+	drained := false
+	for len(messages) < pollQueueSize {
+		select {
+		case data, ok := <-conn.client.Send:
+			if !ok {
+				return messages
+			}
+			messages = append(messages, data)
+			continue
+		default:
+		}
+		if drained {
+			break
+		}
+		drainClient(h.hub, h.store, conn.client, conn.version)
+		drained = true
+	}
+	return messages
+}
+
+// resend returns the events of the last batch after cursor if the client has
+// not acknowledged it. Callers must hold pollMu.
+func (c *PollConnection) resend(cursor *uint64) []json.RawMessage {
+	if cursor == nil || *cursor >= c.cursor {
+		c.unacked = nil
+		return nil
+	}
+
+	var messages []json.RawMessage
+	for _, data := range c.unacked {
+		if seq := messageSeq(data); seq == 0 || seq > *cursor {
+			messages = append(messages, data)
+		}
+	}
+	return messages
+}
+
+// ack records the batch being returned and moves the cursor to its last
+// event. Callers must hold pollMu.
+func (c *PollConnection) ack(messages []json.RawMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	c.unacked = messages
+	for _, data := range messages {
+		if seq := messageSeq(data); seq != 0 {
+			c.cursor = seq
+		}
+	}
+}
+
+// messageSeq returns the seq the hub stamped on a message, or zero.
+func messageSeq(data []byte) uint64 {
+	var msg struct {
+		Seq uint64 `json:"seq"`
+	}
+	json.Unmarshal(data, &msg)
+	return msg.Seq
+}
+
+// parsePollTimeout parses a poll timeout in seconds.
+func parsePollTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultPollTimeout, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, errors.New("invalid timeout")
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > MaxPollTimeout {
+		timeout = MaxPollTimeout
+	}
+	return timeout, nil
 }
 
 // HandleSend handles POST /poll/send — processes a client message.
@@ -205,25 +401,74 @@ func (h *PollHandler) HandleSend(w http.ResponseWriter, r *http.Request) {
 
 	var msg message.ClientMessage
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		if h.limitRejected(w, conn) {
+			return
+		}
 		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Invalid message format")
 		return
 	}
 
-	switch msg.Action {
-	case message.ActionJoinGame:
-		h.handlePollJoinGame(w, conn, msg)
-	case message.ActionRejoinGame:
-		h.handlePollRejoinGame(w, conn, msg)
-	case message.ActionRollDice:
-		h.handlePollRollDice(w, conn)
-	case message.ActionStartGame:
-		h.handlePollStartGame(w, conn)
-	case message.ActionPing:
+	if !h.commands.Handles(msg.Action) {
+		if h.limitRejected(w, conn) {
+			return
+		}
+		if len(msg.RequestID) > maxRequestIDLength {
+			msg.RequestID = ""
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"type": "pong"})
-	default:
-		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Unknown action: "+msg.Action)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Type:      "error",
+			Code:      message.ErrInvalidMessage,
+			Message:   "Unknown action: " + msg.Action,
+			RequestID: msg.RequestID,
+		})
+		return
+	}
+
+	// The reply is the response; broadcasts reach other clients through the hub
+	res := h.commands.Dispatch(conn.client, msg)
+	code, playerID := h.hub.GameOf(conn.client)
+	h.pollStore.UpdateGame(conn.ID, code, playerID)
+
+	if res.Disconnect {
+		h.closeConnection(conn)
+	}
+	if errMsg, ok := res.Reply.(message.ErrorMessage); ok && errMsg.Code == message.ErrRateLimited {
+		writeRateLimitedReply(w, errMsg)
+		return
 	}
+	if res.Reply == nil {
+		// Actions such as react have no reply
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res.Reply)
+}
+
+// limitRejected charges a message rejected before dispatch to the
+// connection's limits, as the WebSocket read loop does for garbage. If the
+// connection is over them it writes the 429 and reports true.
+func (h *PollHandler) limitRejected(w http.ResponseWriter, conn *PollConnection) bool {
+	res := h.commands.limit(conn.client, "")
+	errMsg, ok := res.Reply.(message.ErrorMessage)
+	if !ok {
+		return false
+	}
+	if res.Disconnect {
+		h.closeConnection(conn)
+	}
+	writeRateLimitedReply(w, errMsg)
+	return true
+}
+
+// writeRateLimitedReply writes a rate limited reply as a 429 response.
+func writeRateLimitedReply(w http.ResponseWriter, errMsg message.ErrorMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa((errMsg.RetryAfterMs+999)/1000))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(errMsg)
 }
 
 // HandleDisconnect handles POST /poll/disconnect — cleans up a poll connection.
@@ -235,9 +480,8 @@ func (h *PollHandler) HandleDisconnect(w http.ResponseWriter, r *http.Request) {
 
 	connID := r.Header.Get("X-Connection-Id")
 	if connID != "" {
-		conn := h.pollStore.Get(connID)
-		if conn != nil && conn.GameCode != "" && conn.PlayerID != "" {
-			h.disconnectPlayer(conn)
+		if conn := h.pollStore.Get(connID); conn != nil {
+			h.closeConnection(conn)
 		}
 		h.pollStore.Delete(connID)
 	}
@@ -256,9 +500,12 @@ func (h *PollHandler) StartCleanup(interval, maxInactivity time.Duration, stop <
 		case <-ticker.C:
 			removed := h.pollStore.CleanupStale(maxInactivity)
 			for _, conn := range removed {
-				if conn.GameCode != "" && conn.PlayerID != "" {
+				if code, playerID := h.pollStore.GameOf(conn); code != "" && playerID != "" {
 					h.disconnectPlayer(conn)
 				}
+				if conn.client != nil {
+					h.hub.Unregister(conn.client)
+				}
 			}
 			if len(removed) > 0 {
 				log.Printf("Cleaned up %d stale poll connections", len(removed))
@@ -269,221 +516,21 @@ func (h *PollHandler) StartCleanup(interval, maxInactivity time.Duration, stop <
 	}
 }
 
-func (h *PollHandler) handlePollJoinGame(w http.ResponseWriter, conn *PollConnection, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player, err := g.AddPlayer(msg.Name)
-	if err != nil {
-		switch err {
-		case game.ErrGameFull:
-			h.writeError(w, http.StatusOK, message.ErrGameFull, "Game is full")
-		case game.ErrGameAlreadyStarted:
-			h.writeError(w, http.StatusOK, message.ErrGameAlreadyStarted, "Game has already started")
-		case game.ErrInvalidName:
-			h.writeError(w, http.StatusOK, message.ErrInvalidMessage, "Player name is required")
-		default:
-			h.writeError(w, http.StatusOK, message.ErrInternalError, "Failed to join game")
-		}
-		return
-	}
-
-	h.pollStore.UpdateGame(conn.ID, code, player.ID)
-
-	// Broadcast playerJoined to WebSocket clients
-	playerJoinedMsg := message.PlayerJoinedMessage{
-		Type:   message.TypePlayerJoined,
-		Player: playerToInfo(player, code),
+// closeConnection disconnects a poll connection's player and removes it.
+func (h *PollHandler) closeConnection(conn *PollConnection) {
+	if code, playerID := h.pollStore.GameOf(conn); code != "" && playerID != "" {
+		h.disconnectPlayer(conn)
 	}
-	h.hub.BroadcastToGame(code, playerJoinedMsg)
-
-	// Send joinedGame response to the poll client
-	players := g.GetPlayers()
-	playerInfos := make([]message.PlayerInfo, len(players))
-	for i, p := range players {
-		playerInfos[i] = playerToInfo(p, code)
-	}
-
-	joinedMsg := message.JoinedGameMessage{
-		Type:     message.TypeJoinedGame,
-		PlayerID: player.ID,
-		Game:     gameToInfo(g),
-		Players:  playerInfos,
+	if conn.client != nil {
+		h.hub.Unregister(conn.client)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(joinedMsg)
+	h.pollStore.Delete(conn.ID)
 }
 
-func (h *PollHandler) handlePollRejoinGame(w http.ResponseWriter, conn *PollConnection, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player := g.GetPlayer(msg.PlayerID)
-	if player == nil {
-		h.writeError(w, http.StatusOK, message.ErrPlayerNotFound, "Player not found in game")
-		return
-	}
-
-	g.SetPlayerConnected(msg.PlayerID, true)
-	h.pollStore.UpdateGame(conn.ID, code, msg.PlayerID)
-
-	players := g.GetPlayers()
-	playerInfos := make([]message.PlayerInfo, len(players))
-	for i, p := range players {
-		playerInfos[i] = playerToInfo(p, code)
-	}
-
-	joinedMsg := message.JoinedGameMessage{
-		Type:     message.TypeJoinedGame,
-		PlayerID: msg.PlayerID,
-		Game:     gameToInfo(g),
-		Players:  playerInfos,
-	}
-
-	// Notify WebSocket clients that this player reconnected
-	playerJoinedMsg := message.PlayerJoinedMessage{
-		Type:   message.TypePlayerJoined,
-		Player: playerToInfo(player, code),
-	}
-	h.hub.BroadcastToGame(code, playerJoinedMsg)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(joinedMsg)
-}
-
-func (h *PollHandler) handlePollRollDice(w http.ResponseWriter, conn *PollConnection) {
-	if conn.GameCode == "" || conn.PlayerID == "" {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Not in a game")
-		return
-	}
-
-	g := h.store.Get(conn.GameCode)
-	if g == nil {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player := g.GetPlayer(conn.PlayerID)
-	if player == nil {
-		h.writeError(w, http.StatusOK, message.ErrPlayerNotFound, "Player not found")
-		return
-	}
-
-	diceRoll, prevPos, newPos, effect, isWinner, err := g.RollDice(conn.PlayerID)
-	if err != nil {
-		switch err {
-		case game.ErrGameNotStarted:
-			h.writeError(w, http.StatusOK, message.ErrGameNotStarted, "Game has not started")
-		default:
-			h.writeError(w, http.StatusOK, message.ErrInternalError, "Failed to roll dice")
-		}
-		return
-	}
-
-	var moveEffect *message.MoveEffect
-	if effect != nil {
-		moveEffect = &message.MoveEffect{
-			Type: effect.Type,
-			From: effect.From,
-			To:   effect.To,
-		}
-	}
-
-	moveMsg := message.PlayerMovedMessage{
-		Type:             message.TypePlayerMoved,
-		PlayerID:         conn.PlayerID,
-		PlayerName:       player.Name,
-		DiceRoll:         diceRoll,
-		PreviousPosition: prevPos,
-		NewPosition:      newPos,
-		Effect:           moveEffect,
-	}
-
-	// Broadcast to WebSocket clients
-	h.hub.BroadcastToGame(conn.GameCode, moveMsg)
-
-	if isWinner {
-		endMsg := message.GameEndedMessage{
-			Type:       message.TypeGameEnded,
-			WinnerID:   conn.PlayerID,
-			WinnerName: player.Name,
-		}
-		h.hub.BroadcastToGame(conn.GameCode, endMsg)
-	}
-
-	// Send response to poll client
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(moveMsg)
-}
-
-func (h *PollHandler) handlePollStartGame(w http.ResponseWriter, conn *PollConnection) {
-	if conn.GameCode == "" || conn.PlayerID == "" {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Not in a game")
-		return
-	}
-
-	g := h.store.Get(conn.GameCode)
-	if g == nil {
-		h.writeError(w, http.StatusOK, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	err := g.Start(conn.PlayerID)
-	if err != nil {
-		switch err {
-		case game.ErrGameAlreadyStarted:
-			h.writeError(w, http.StatusOK, message.ErrGameAlreadyStarted, "Game has already started")
-		case game.ErrNotGameCreator:
-			h.writeError(w, http.StatusOK, message.ErrNotGameCreator, "Only the game creator can start the game")
-		default:
-			h.writeError(w, http.StatusOK, message.ErrInternalError, "Failed to start game")
-		}
-		return
-	}
-
-	startMsg := message.GameStartedMessage{
-		Type:          message.TypeGameStarted,
-		Game:          gameToInfo(g),
-		FirstPlayerID: g.GetCurrentTurnPlayerID(),
-	}
-
-	// Broadcast to WebSocket clients
-	h.hub.BroadcastToGame(conn.GameCode, startMsg)
-
-	// Send response to poll client
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(startMsg)
-}
-
-// disconnectPlayer marks a player as disconnected and broadcasts PlayerLeft.
+// disconnectPlayer marks a connection's player as disconnected and tells the
+// other players.
 func (h *PollHandler) disconnectPlayer(conn *PollConnection) {
-	g := h.store.Get(conn.GameCode)
-	if g == nil {
-		return
-	}
-
-	player := g.GetPlayer(conn.PlayerID)
-	if player == nil {
-		return
-	}
-
-	g.SetPlayerConnected(conn.PlayerID, false)
-
-	leftMsg := message.PlayerLeftMessage{
-		Type:       message.TypePlayerLeft,
-		PlayerID:   conn.PlayerID,
-		PlayerName: player.Name,
-	}
-	h.hub.BroadcastToGame(conn.GameCode, leftMsg)
+	h.commands.Disconnect(conn.client)
 }
 
 func (h *PollHandler) writeError(w http.ResponseWriter, status int, code, msg string) {
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -15,9 +16,9 @@ import (
 )
 
 func newTestPollHandler() *PollHandler {
-	store := game.NewStore()
+	store := game.NewMemoryStore()
 	h := hub.NewHub()
-	return NewPollHandler(store, h)
+	return NewPollHandler(store, h, NewDispatcher(store, h))
 }
 
 func connectPoll(t *testing.T, handler *PollHandler) string {
@@ -49,6 +50,35 @@ func sendMessage(t *testing.T, handler *PollHandler, connID string, msg message.
 	return w
 }
 
+// pollResponse is the body of GET /poll/messages.
+type pollResponse struct {
+	Messages []json.RawMessage `json:"messages"`
+	Cursor   uint64            `json:"cursor"`
+}
+
+func pollMessages(t *testing.T, handler *PollHandler, connID, query string) pollResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/poll/messages?"+query, nil)
+	req.Header.Set("X-Connection-Id", connID)
+	w := httptest.NewRecorder()
+	handler.HandleMessages(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("HandleMessages returned status %d", w.Code)
+	}
+	var resp pollResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	return resp
+}
+
+func messageType(data json.RawMessage) string {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &msg)
+	return msg.Type
+}
+
 // --- Connect tests ---
 
 func TestPollConnect(t *testing.T) {
@@ -103,64 +133,185 @@ func TestPollMessagesEmptyWhenNoGame(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	req := httptest.NewRequest(http.MethodGet, "/poll/messages", nil)
-	req.Header.Set("X-Connection-Id", connID)
-	w := httptest.NewRecorder()
-	h.HandleMessages(w, req)
+	resp := pollMessages(t, h, connID, "timeout=0")
+	if resp.Messages == nil || len(resp.Messages) != 0 {
+		t.Errorf("Expected an empty message list, got %v", resp.Messages)
+	}
+	if resp.Cursor != 0 {
+		t.Errorf("Expected cursor 0, got %d", resp.Cursor)
+	}
+}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected 200, got %d", w.Code)
+func TestPollMessagesReturnsGameEvents(t *testing.T) {
+	h := newTestPollHandler()
+	bobConn := connectPoll(t, h)
+	carolConn := connectPoll(t, h)
+
+	g, alice, _ := h.store.Create("Alice")
+	code := g.Code
+
+	sendMessage(t, h, bobConn, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: code,
+		Name:     "Bob",
+	})
+	sendMessage(t, h, carolConn, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: code,
+		Name:     "Carol",
+	})
+	g.Start(alice.ID)
+	alice.Position = 99
+	g.RollDice(alice.ID)
+	h.hub.BroadcastToGame(code, message.GameEndedMessage{
+		Type:       message.TypeGameEnded,
+		WinnerID:   alice.ID,
+		WinnerName: "Alice",
+	})
+
+	resp := pollMessages(t, h, bobConn, "timeout=0")
+
+	var types []string
+	for _, data := range resp.Messages {
+		types = append(types, messageType(data))
+	}
+	want := []string{message.TypePlayerJoined, message.TypeGameEnded}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected %v, got %v", want, types)
+	}
+	if resp.Cursor != 3 {
+		t.Errorf("Expected cursor 3, got %d", resp.Cursor)
 	}
 
-	var resp map[string][]interface{}
-	json.NewDecoder(w.Body).Decode(&resp)
-	if len(resp["messages"]) != 0 {
-		t.Errorf("Expected 0 messages, got %d", len(resp["messages"]))
+	// Carol's own join isn't echoed back to her
+	resp = pollMessages(t, h, carolConn, "timeout=0")
+	if len(resp.Messages) != 1 || messageType(resp.Messages[0]) != message.TypeGameEnded {
+		t.Errorf("Expected only gameEnded for Carol, got %d messages", len(resp.Messages))
 	}
 }
 
-func TestPollMessagesReturnsGameState(t *testing.T) {
+func TestPollMessagesWaitsForEvent(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	// Create a game and join via poll
-	g, _ := h.store.Create("Alice")
-	code := g.Code
+	g, _, _ := h.store.Create("Alice")
+	sendMessage(t, h, connID, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: g.Code,
+		Name:     "Bob",
+	})
+
+	done := make(chan pollResponse)
+	go func() {
+		done <- pollMessages(t, h, connID, "timeout=5")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	h.hub.BroadcastToGame(g.Code, map[string]string{"type": message.TypePlayerLeft})
+
+	select {
+	case resp := <-done:
+		if len(resp.Messages) != 1 || messageType(resp.Messages[0]) != message.TypePlayerLeft {
+			t.Errorf("Expected the playerLeft event, got %d messages", len(resp.Messages))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Poll should return as soon as an event arrives")
+	}
+}
+
+func TestPollMessagesTimesOut(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	start := time.Now()
+	resp := pollMessages(t, h, connID, "timeout=1")
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Poll returned after %v, expected it to wait for the timeout", elapsed)
+	}
+	if len(resp.Messages) != 0 {
+		t.Errorf("Expected 0 messages, got %d", len(resp.Messages))
+	}
+}
+
+func TestPollMessagesInvalidParams(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	for _, query := range []string{"timeout=-1", "timeout=soon", "cursor=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "/poll/messages?"+query, nil)
+		req.Header.Set("X-Connection-Id", connID)
+		w := httptest.NewRecorder()
+		h.HandleMessages(w, req)
 
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestPollMessagesResendsUnacknowledgedBatch(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	g, _, _ := h.store.Create("Alice")
 	sendMessage(t, h, connID, message.ClientMessage{
 		Action:   message.ActionJoinGame,
-		GameCode: code,
+		GameCode: g.Code,
 		Name:     "Bob",
 	})
 
-	// Poll messages
-	req := httptest.NewRequest(http.MethodGet, "/poll/messages", nil)
-	req.Header.Set("X-Connection-Id", connID)
-	w := httptest.NewRecorder()
-	h.HandleMessages(w, req)
+	// Bob's own playerJoined was seq 1
+	h.hub.BroadcastToGame(g.Code, map[string]int{"n": 2})
+	h.hub.BroadcastToGame(g.Code, map[string]int{"n": 3})
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected 200, got %d", w.Code)
+	first := pollMessages(t, h, connID, "timeout=0&cursor=1")
+	if len(first.Messages) != 2 || first.Cursor != 3 {
+		t.Fatalf("Expected 2 messages up to cursor 3, got %d up to %d", len(first.Messages), first.Cursor)
 	}
 
-	var resp map[string][]json.RawMessage
-	json.NewDecoder(w.Body).Decode(&resp)
+	// The response was lost, so the client polls again with its old cursor
+	h.hub.BroadcastToGame(g.Code, map[string]int{"n": 4})
+	retry := pollMessages(t, h, connID, "timeout=0&cursor=1")
+	if len(retry.Messages) != 3 || retry.Cursor != 4 {
+		t.Fatalf("Expected the lost batch and the new event, got %d up to %d", len(retry.Messages), retry.Cursor)
+	}
 
-	if len(resp["messages"]) != 1 {
-		t.Fatalf("Expected 1 message, got %d", len(resp["messages"]))
+	// Acknowledging the cursor drops the batch
+	acked := pollMessages(t, h, connID, "timeout=0&cursor=4")
+	if len(acked.Messages) != 0 || acked.Cursor != 4 {
+		t.Errorf("Expected nothing new at cursor 4, got %d up to %d", len(acked.Messages), acked.Cursor)
 	}
+}
+
+func TestPollMessagesResyncsOverflowingQueue(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	g, _, _ := h.store.Create("Alice")
+	sendMessage(t, h, connID, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: g.Code,
+		Name:     "Bob",
+	})
 
-	var gameState message.GameStateMessage
-	json.Unmarshal(resp["messages"][0], &gameState)
+	for i := 0; i < pollQueueSize+10; i++ {
+		h.hub.BroadcastToGame(g.Code, map[string]int{"n": i})
+	}
 
-	if gameState.Type != message.TypeGameState {
-		t.Errorf("Expected gameState type, got %s", gameState.Type)
+	resp := pollMessages(t, h, connID, "timeout=0")
+	if len(resp.Messages) != pollQueueSize {
+		t.Fatalf("Expected the full queue, got %d messages", len(resp.Messages))
 	}
-	if gameState.Game.Code != code {
-		t.Errorf("Expected game code %s, got %s", code, gameState.Game.Code)
+
+	// The dropped events are replaced by the current state
+	resp = pollMessages(t, h, connID, "timeout=0&cursor="+strconv.FormatUint(resp.Cursor, 10))
+	if len(resp.Messages) != 1 || messageType(resp.Messages[0]) != message.TypeGameState {
+		t.Fatalf("Expected a gameState resync, got %d messages", len(resp.Messages))
 	}
-	if len(gameState.Players) != 2 { // Alice + Bob
-		t.Errorf("Expected 2 players, got %d", len(gameState.Players))
+	// The broadcasts come after Bob's own playerJoined
+	if want := uint64(pollQueueSize + 11); resp.Cursor != want {
+		t.Errorf("Expected the resync to move the cursor to %d, got %d", want, resp.Cursor)
 	}
 }
 
@@ -175,10 +326,7 @@ func TestPollMessagesRefreshesLastPollTime(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 
 	// Poll messages
-	req := httptest.NewRequest(http.MethodGet, "/poll/messages", nil)
-	req.Header.Set("X-Connection-Id", connID)
-	w := httptest.NewRecorder()
-	h.HandleMessages(w, req)
+	pollMessages(t, h, connID, "timeout=0")
 
 	conn = h.pollStore.Get(connID)
 	if !conn.LastPollTime.After(initialTime) {
@@ -192,7 +340,7 @@ func TestPollJoinGameSuccess(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 	code := g.Code
 
 	w := sendMessage(t, h, connID, message.ClientMessage{
@@ -252,7 +400,7 @@ func TestPollJoinGameAlreadyStarted(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, creator := h.store.Create("Alice")
+	g, creator, _ := h.store.Create("Alice")
 	g.Start(creator.ID)
 
 	w := sendMessage(t, h, connID, message.ClientMessage{
@@ -274,7 +422,7 @@ func TestPollRejoinGameSuccess(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, creator := h.store.Create("Alice")
+	g, creator, _ := h.store.Create("Alice")
 	code := g.Code
 
 	// Mark creator as disconnected
@@ -317,7 +465,7 @@ func TestPollRejoinGamePlayerNotFound(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 
 	w := sendMessage(t, h, connID, message.ClientMessage{
 		Action:   message.ActionRejoinGame,
@@ -339,7 +487,7 @@ func TestPollRollDiceSuccess(t *testing.T) {
 	connID := connectPoll(t, h)
 
 	// Create game, join, start
-	g, creator := h.store.Create("Alice")
+	g, creator, _ := h.store.Create("Alice")
 	code := g.Code
 
 	// Join via poll to set connection state
@@ -384,7 +532,7 @@ func TestPollRollDiceGameNotStarted(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 
 	// Join game
 	sendMessage(t, h, connID, message.ClientMessage{
@@ -427,7 +575,7 @@ func TestPollStartGameSuccess(t *testing.T) {
 	connID := connectPoll(t, h)
 
 	// Create game via store, then rejoin as the creator via poll
-	g, creator := h.store.Create("Alice")
+	g, creator, _ := h.store.Create("Alice")
 	code := g.Code
 
 	// Rejoin as creator to set connection state
@@ -461,7 +609,7 @@ func TestPollStartGameNotCreator(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 
 	// Join as different player
 	sendMessage(t, h, connID, message.ClientMessage{
@@ -503,6 +651,39 @@ func TestPollPing(t *testing.T) {
 	}
 }
 
+// --- Send - request ID tests ---
+
+func TestPollSendEchoesRequestID(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	tests := []struct {
+		name   string
+		action string
+		status int
+		want   string
+	}{
+		{"reply", message.ActionPing, http.StatusOK, message.TypePong},
+		{"error", message.ActionRollDice, http.StatusOK, message.TypeError},
+		{"unknown action", "unknownAction", http.StatusBadRequest, message.TypeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sendMessage(t, h, connID, message.ClientMessage{Action: tt.action, RequestID: "req-" + tt.name})
+			if w.Code != tt.status {
+				t.Errorf("Expected %d, got %d", tt.status, w.Code)
+			}
+
+			var resp map[string]string
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp["type"] != tt.want || resp["requestId"] != "req-"+tt.name {
+				t.Errorf("Expected %s for req-%s, got %v", tt.want, tt.name, resp)
+			}
+		})
+	}
+}
+
 // --- Send - missing header tests ---
 
 func TestPollSendMissingHeader(t *testing.T) {
@@ -536,7 +717,7 @@ func TestPollDisconnect(t *testing.T) {
 	h := newTestPollHandler()
 	connID := connectPoll(t, h)
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 	code := g.Code
 
 	// Join game
@@ -642,7 +823,7 @@ func TestPollCleanupRemovesStaleConnections(t *testing.T) {
 func TestPollCleanupDisconnectsPlayers(t *testing.T) {
 	h := newTestPollHandler()
 
-	g, _ := h.store.Create("Alice")
+	g, _, _ := h.store.Create("Alice")
 	code := g.Code
 	bob, _ := g.AddPlayer("Bob")
 
@@ -653,7 +834,10 @@ func TestPollCleanupDisconnectsPlayers(t *testing.T) {
 		PlayerID:     bob.ID,
 		LastPollTime: time.Now().Add(-10 * time.Minute),
 		CreatedAt:    time.Now().Add(-10 * time.Minute),
+		client:       &hub.Client{ID: "poll_stale_bob", Send: make(chan []byte, pollQueueSize)},
 	}
+	h.hub.Register(conn.client)
+	h.hub.JoinGame(conn.client, code, bob.ID)
 	h.pollStore.Add(conn)
 
 	removed := h.pollStore.CleanupStale(5 * time.Minute)
@@ -672,6 +856,48 @@ func TestPollCleanupDisconnectsPlayers(t *testing.T) {
 	}
 }
 
+// --- Expiry tests ---
+
+func TestPollExpiryNotifiesConnection(t *testing.T) {
+	h := newTestPollHandler()
+	connID := connectPoll(t, h)
+
+	g, _, _ := h.store.Create("Alice")
+	sendMessage(t, h, connID, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: g.Code,
+		Name:     "Bob",
+	})
+
+	NewExpiryNotifier(h.hub, h.commands, h)(g)
+	h.store.Delete(g.Code)
+
+	resp := pollMessages(t, h, connID, "timeout=0")
+	if len(resp.Messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(resp.Messages))
+	}
+
+	var expired message.GameExpiredMessage
+	json.Unmarshal(resp.Messages[0], &expired)
+	if expired.Type != message.TypeGameExpired {
+		t.Errorf("Expected gameExpired type, got %s", expired.Type)
+	}
+	if expired.GameCode != g.Code {
+		t.Errorf("Expected game code %s, got %s", g.Code, expired.GameCode)
+	}
+
+	conn := h.pollStore.Get(connID)
+	if conn.GameCode != "" || conn.PlayerID != "" {
+		t.Error("Connection should be unlinked from the expired game")
+	}
+
+	// The notification is only delivered once
+	resp = pollMessages(t, h, connID, "timeout=0")
+	if len(resp.Messages) != 0 {
+		t.Errorf("Expected 0 messages, got %d", len(resp.Messages))
+	}
+}
+
 // --- Send - unknown action test ---
 
 func TestPollSendUnknownAction(t *testing.T) {
@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/snakes-and-ladders/go-backend/internal/config"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// Action classes, each with its own rate limit.
+const (
+	ClassCreate = "create"
+	ClassJoin   = "join"
+	ClassRoll   = "roll"
+	ClassChat   = "chat"
+	ClassReact  = "react"
+)
+
+// idleSourceTTL is how long a source's buckets are kept after its last
+// request. By then they have refilled, so forgetting them changes nothing.
+const idleSourceTTL = 10 * time.Minute
+
+// RateLimiter limits how fast connections and source IPs may act, with a
+// token bucket per action class for each connection and one for everything
+// from each source IP.
+type RateLimiter struct {
+	limits config.RateLimitConfig
+
+	mu        sync.Mutex
+	sources   map[string]*rateSource
+	lastSweep time.Time
+}
+
+// rateSource is a connection's or source IP's buckets by action class, and
+// how many of its requests in a row were limited.
+type rateSource struct {
+	buckets    map[string]*tokenBucket
+	violations int
+	seen       time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter with the given limits.
+func NewRateLimiter(limits config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{limits: limits, sources: make(map[string]*rateSource)}
+}
+
+// actionClass returns the class a client action is limited as, or "" for
+// actions only the per-IP limit applies to.
+func actionClass(action string) string {
+	switch action {
+	case message.ActionJoinGame, message.ActionRejoinGame:
+		return ClassJoin
+	case message.ActionRollDice:
+		return ClassRoll
+	case message.ActionSendChat:
+		return ClassChat
+	case message.ActionReact:
+		return ClassReact
+	}
+	return ""
+}
+
+func (l *RateLimiter) limit(class string) config.RateLimit {
+	switch class {
+	case ClassCreate:
+		return l.limits.Create
+	case ClassJoin:
+		return l.limits.Join
+	case ClassRoll:
+		return l.limits.Roll
+	case ClassChat:
+		return l.limits.Chat
+	case ClassReact:
+		return l.limits.React
+	}
+	return config.RateLimit{}
+}
+
+// Allow charges a request of the given class to source and to ip, either of
+// which may be empty. If either is over its limit nothing is charged, and it
+// returns how long to wait and how many requests in a row source has had
+// limited.
+func (l *RateLimiter) Allow(source, ip, class string) (time.Duration, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= idleSourceTTL {
+		l.sweepLocked(now)
+	}
+
+	type charge struct {
+		bucket *tokenBucket
+		limit  config.RateLimit
+	}
+	var charges []charge
+	if source != "" {
+		if limit := l.limit(class); limit.PerSecond > 0 {
+			charges = append(charges, charge{l.bucketLocked(source, class, limit, now), limit})
+		}
+	}
+	if ip != "" && l.limits.PerIP.PerSecond > 0 {
+		charges = append(charges, charge{l.bucketLocked("ip:"+ip, "", l.limits.PerIP, now), l.limits.PerIP})
+	}
+
+	var wait time.Duration
+	for _, c := range charges {
+		if w := c.bucket.wait(c.limit, now); w > wait {
+			wait = w
+		}
+	}
+
+	var src *rateSource
+	if source != "" {
+		src = l.sourceLocked(source, now)
+	}
+	if wait > 0 {
+		if src == nil {
+			return wait, 0
+		}
+		src.violations++
+		return wait, src.violations
+	}
+
+	for _, c := range charges {
+		c.bucket.tokens--
+	}
+	if src != nil {
+		src.violations = 0
+	}
+	return 0, 0
+}
+
+// sourceLocked returns a source's buckets, creating them if needed. Callers
+// must hold mu.
+func (l *RateLimiter) sourceLocked(source string, now time.Time) *rateSource {
+	src, ok := l.sources[source]
+	if !ok {
+		src = &rateSource{buckets: make(map[string]*tokenBucket)}
+		l.sources[source] = src
+	}
+	src.seen = now
+	return src
+}
+
+// bucketLocked returns a source's bucket for a class, full if it is new.
+// Callers must hold mu.
+func (l *RateLimiter) bucketLocked(source, class string, limit config.RateLimit, now time.Time) *tokenBucket {
+	src := l.sourceLocked(source, now)
+	b, ok := src.buckets[class]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		src.buckets[class] = b
+	}
+	return b
+}
+
+// sweepLocked forgets sources that have been idle for idleSourceTTL.
+// Callers must hold mu.
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	for source, src := range l.sources {
+		if now.Sub(src.seen) >= idleSourceTTL {
+			delete(l.sources, source)
+		}
+	}
+	l.lastSweep = now
+}
+
+// wait refills the bucket and returns how long until it has a token, or
+// zero if it has one now.
+func (b *tokenBucket) wait(limit config.RateLimit, now time.Time) time.Duration {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.PerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / limit.PerSecond * float64(time.Second))
+}
+
+// Middleware limits requests to next by source IP, as the given action class
+// or, if class is empty, against the per-IP limit only. Limited requests get
+// 429 Too Many Requests with a Retry-After header.
+func (l *RateLimiter) Middleware(class string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.ClientIP(r)
+		source := ""
+		if class != "" {
+			source = "ip:" + ip + ":" + class
+		}
+		if wait, _ := l.Allow(source, ip, class); wait > 0 {
+			writeRateLimited(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the source IP of a request.
+func (l *RateLimiter) ClientIP(r *http.Request) string {
+	if l.limits.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// The last entry is the one the load balancer added
+			entries := strings.Split(forwarded, ",")
+			return strings.TrimSpace(entries[len(entries)-1])
+		}
+	}
+	return remoteHost(r)
+}
+
+// remoteHost returns the host of a request's remote address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimited is the error for a request over its limit.
+func rateLimited(wait time.Duration) message.ErrorMessage {
+	errMsg := message.NewErrorMessage(message.ErrRateLimited, "Too many requests, slow down")
+	errMsg.RetryAfterMs = int(math.Ceil(float64(wait) / float64(time.Millisecond)))
+	return errMsg
+}
+
+// writeRateLimited writes a 429 response for a request over its limit.
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	errMsg := rateLimited(wait)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Type:         "error",
+		Code:         errMsg.Code,
+		Message:      errMsg.Message,
+		RetryAfterMs: errMsg.RetryAfterMs,
+	})
+}
+
+// SetRateLimiter sets the limits client actions are checked against. Nil
+// turns them off.
+func (d *Dispatcher) SetRateLimiter(limiter *RateLimiter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.limiter = limiter
+}
+
+// clientIP returns the source IP of a request as the rate limits see it, to
+// record on the connection's hub client.
+func (d *Dispatcher) clientIP(r *http.Request) string {
+	d.mu.Lock()
+	limiter := d.limiter
+	d.mu.Unlock()
+	if limiter == nil {
+		return remoteHost(r)
+	}
+	return limiter.ClientIP(r)
+}
+
+// limit charges an action to its client's rate limits. If it is over them
+// it returns a RATE_LIMITED result, marked to disconnect the client once it
+// has had too many limited in a row.
+func (d *Dispatcher) limit(client *hub.Client, action string) Result {
+	d.mu.Lock()
+	limiter := d.limiter
+	d.mu.Unlock()
+	if limiter == nil {
+		return Result{}
+	}
+
+	wait, violations := limiter.Allow(client.ID, client.RemoteIP, actionClass(action))
+	if wait == 0 {
+		return Result{}
+	}
+	res := Result{Reply: rateLimited(wait)}
+	if max := limiter.limits.MaxViolations; max > 0 && violations >= max {
+		log.Printf("Disconnecting client %s (%s) after %d rate limited requests", client.ID, client.RemoteIP, violations)
+		res.Disconnect = true
+	}
+	return res
+}
+
+// refuse sends a client the reply to a request it was refused, closing the
+// client if the result says so.
+func (d *Dispatcher) refuse(client *hub.Client, res Result, sendReply bool) {
+	if sendReply {
+		d.hub.SendToClient(client, res.Reply)
+	}
+	if res.Disconnect {
+		client.CloseWithReason(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+}
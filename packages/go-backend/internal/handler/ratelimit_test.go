@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/config"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitConfig{Roll: config.RateLimit{PerSecond: 1, Burst: 2}})
+
+	for i := 0; i < 2; i++ {
+		if wait, _ := l.Allow("c1", "", ClassRoll); wait != 0 {
+			t.Fatalf("Expected roll %d within the burst, waited %v", i+1, wait)
+		}
+	}
+	wait, violations := l.Allow("c1", "", ClassRoll)
+	if wait <= 0 || wait > time.Second || violations != 1 {
+		t.Errorf("Expected to wait up to 1s with 1 violation, got %v and %d", wait, violations)
+	}
+	if _, violations = l.Allow("c1", "", ClassRoll); violations != 2 {
+		t.Errorf("Expected violations in a row to add up, got %d", violations)
+	}
+
+	// Other classes and connections have their own buckets
+	if wait, _ := l.Allow("c1", "", ClassJoin); wait != 0 {
+		t.Error("Join has no limit here")
+	}
+	if wait, _ := l.Allow("c2", "", ClassRoll); wait != 0 {
+		t.Error("Another connection should have its own bucket")
+	}
+
+	// The bucket refills
+	l.sources["c1"].buckets[ClassRoll].last = time.Now().Add(-time.Second)
+	if wait, violations := l.Allow("c1", "", ClassRoll); wait != 0 || violations != 0 {
+		t.Errorf("Expected a refilled token to reset violations, got %v and %d", wait, violations)
+	}
+}
+
+func TestRateLimiterPerIP(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitConfig{PerIP: config.RateLimit{PerSecond: 1, Burst: 2}})
+
+	l.Allow("c1", "10.0.0.1", "")
+	l.Allow("c2", "10.0.0.1", "")
+
+	if wait, _ := l.Allow("c3", "10.0.0.1", ""); wait == 0 {
+		t.Error("Expected connections from one IP to share its limit")
+	}
+	if wait, _ := l.Allow("c4", "10.0.0.2", ""); wait != 0 {
+		t.Error("Another IP should have its own limit")
+	}
+}
+
+func TestDispatchRateLimited(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetRateLimiter(NewRateLimiter(config.RateLimitConfig{
+		Roll:          config.RateLimit{PerSecond: 0.01, Burst: 1},
+		MaxViolations: 2,
+	}))
+	g, alice, _ := store.Create("Alice")
+	g.Start(alice.ID)
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice})
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionRollDice, RequestID: "r2"})
+
+	errMsg, ok := res.Reply.(message.ErrorMessage)
+	if !ok || errMsg.Code != message.ErrRateLimited || errMsg.RetryAfterMs <= 0 || errMsg.RequestID != "r2" {
+		t.Fatalf("Expected RATE_LIMITED with a retry-after, got %+v", res.Reply)
+	}
+	if res.Disconnect {
+		t.Error("One violation should not disconnect")
+	}
+
+	res = d.DispatchToClient(client, message.ClientMessage{Action: message.ActionRollDice})
+	if !res.Disconnect {
+		t.Fatal("Expected the client to be disconnected after repeated violations")
+	}
+	for range client.Send {
+	}
+	if len(client.CloseMessage()) == 0 {
+		t.Error("Expected a close frame with a reason")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := NewRateLimiter(config.RateLimitConfig{Create: config.RateLimit{PerSecond: 0.5, Burst: 1}})
+	handler := l.Middleware(ClassCreate, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/games", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+
+		if w.Code == http.StatusTooManyRequests {
+			if w.Header().Get("Retry-After") != "2" {
+				t.Errorf("Expected Retry-After 2, got %q", w.Header().Get("Retry-After"))
+			}
+			var resp ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Code != message.ErrRateLimited || resp.RetryAfterMs <= 1000 {
+				t.Errorf("Expected RATE_LIMITED with retryAfterMs, got %+v", resp)
+			}
+		}
+	}
+
+	if codes[0] != http.StatusCreated || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected 201 then 429, got %v", codes)
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  string
+		want       string
+	}{
+		{"remote address", false, "", "10.0.0.1"},
+		{"untrusted header", false, "1.2.3.4", "10.0.0.1"},
+		{"trusted header", true, "1.2.3.4, 5.6.7.8", "5.6.7.8"},
+		{"trusted without header", true, "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(config.RateLimitConfig{TrustProxy: tt.trustProxy})
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := l.ClientIP(req); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPollSendRateLimited(t *testing.T) {
+	h := newTestPollHandler()
+	h.commands.SetRateLimiter(NewRateLimiter(config.RateLimitConfig{
+		Join:          config.RateLimit{PerSecond: 0.01, Burst: 1},
+		MaxViolations: 2,
+	}))
+	connID := connectPoll(t, h)
+
+	join := message.ClientMessage{Action: message.ActionJoinGame, GameCode: "NOPE00", Name: "Bob"}
+	sendMessage(t, h, connID, join)
+	w := sendMessage(t, h, connID, join)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", w.Code)
+	}
+
+	sendMessage(t, h, connID, join)
+	if h.pollStore.Get(connID) != nil {
+		t.Error("Expected the connection to be removed after repeated violations")
+	}
+}
+
+func TestPollSendRejectedMessagesCountAgainstLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed JSON", `{"action":`},
+		{"unknown action", `{"action":"teleport"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestPollHandler()
+			h.commands.SetRateLimiter(NewRateLimiter(config.RateLimitConfig{
+				PerIP:         config.RateLimit{PerSecond: 0.01, Burst: 1},
+				MaxViolations: 2,
+			}))
+			connID := connectPoll(t, h)
+
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/poll/send", strings.NewReader(tt.body))
+				req.Header.Set("X-Connection-Id", connID)
+				w := httptest.NewRecorder()
+				h.HandleSend(w, req)
+				return w
+			}
+
+			if w := send(); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", w.Code)
+			}
+			if w := send(); w.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected 429, got %d", w.Code)
+			}
+			send()
+			if h.pollStore.Get(connID) != nil {
+				t.Error("Expected the connection to be removed after repeated violations")
+			}
+		})
+	}
+}
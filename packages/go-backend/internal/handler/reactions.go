@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// SetReactionWindow sets how long reactions are tallied before they are
+// broadcast.
+func (d *Dispatcher) SetReactionWindow(window time.Duration) {
+	d.hub.SetReactions(window, reactionMessage)
+}
+
+// reactionMessage is the broadcast for a reaction count players sent.
+func reactionMessage(reaction string, count int) interface{} {
+	return message.ReactionMessage{
+		Type:     message.TypeReaction,
+		Reaction: reaction,
+		Emoji:    message.Reactions[reaction],
+		Count:    count,
+	}
+}
+
+// react adds a player's reaction to the game's tally in the hub. There is no
+// reply unless the reaction isn't in the catalogue; the player sees it counted
+// in the tally like everyone else.
+func (d *Dispatcher) react(client *hub.Client, msg message.ClientMessage) Result {
+	g, playerID, res := d.currentGame(client)
+	if g == nil {
+		return res
+	}
+
+	if _, ok := message.Reactions[msg.Reaction]; !ok {
+		return errorResult(message.ErrInvalidMessage, "Unknown reaction: "+msg.Reaction)
+	}
+
+	d.hub.React(g.Code, msg.Reaction, playerID)
+	return Result{}
+}
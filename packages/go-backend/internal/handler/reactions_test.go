@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestReactBroadcastsTally(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetReactionWindow(10 * time.Millisecond)
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	aliceClient := newDispatcherClient(h, "alice")
+	h.JoinGame(aliceClient, g.Code, alice.ID)
+	bobClient := newDispatcherClient(h, "bob")
+	h.JoinGame(bobClient, g.Code, bob.ID)
+
+	if res := d.Dispatch(aliceClient, message.ClientMessage{Action: message.ActionReact, Reaction: "party"}); res.Reply != nil {
+		t.Errorf("Expected no reply, got %+v", res.Reply)
+	}
+	d.Dispatch(bobClient, message.ClientMessage{Action: message.ActionReact, Reaction: "party"})
+	d.Dispatch(bobClient, message.ClientMessage{Action: message.ActionReact, Reaction: "party"})
+
+	select {
+	case data := <-aliceClient.Send:
+		var reaction message.ReactionMessage
+		json.Unmarshal(data, &reaction)
+		if reaction.Type != message.TypeReaction || reaction.Emoji != message.Reactions["party"] || reaction.Count != 2 {
+			t.Errorf("Expected 2 players reacting with party, got %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the reaction to be broadcast")
+	}
+}
+
+func TestReactUnknownReaction(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	client := newDispatcherClient(h, "alice")
+	h.JoinGame(client, g.Code, alice.ID)
+
+	res := d.Dispatch(client, message.ClientMessage{Action: message.ActionReact, Reaction: "rocket"})
+
+	if errMsg, ok := res.Reply.(message.ErrorMessage); !ok || errMsg.Message != "Unknown reaction: rocket" {
+		t.Errorf("Expected an unknown reaction error, got %+v", res.Reply)
+	}
+}
+
+func TestPollReactHasNoContent(t *testing.T) {
+	h := newTestPollHandler()
+	g, _, _ := h.store.Create("Alice")
+	connID := connectPoll(t, h)
+	sendMessage(t, h, connID, message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob"})
+
+	w := sendMessage(t, h, connID, message.ClientMessage{Action: message.ActionReact, Reaction: "wave"})
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+}
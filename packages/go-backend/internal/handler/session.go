@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// SessionPolicy decides what happens when a player joins a game they are
+// already connected to, e.g. from a second browser tab.
+type SessionPolicy string
+
+const (
+	// SessionsShared keeps every session. The player stays connected until
+	// the last one closes.
+	SessionsShared SessionPolicy = "shared"
+	// SessionLastWins sends the older sessions sessionReplaced and closes
+	// them with CloseSessionReplaced.
+	SessionLastWins SessionPolicy = "last-wins"
+)
+
+// CloseSessionReplaced is the WebSocket close code sent to sessions closed by
+// SessionLastWins.
+const CloseSessionReplaced = 4009
+
+// ParseSessionPolicy validates a policy name from configuration.
+func ParseSessionPolicy(name string) (SessionPolicy, error) {
+	switch p := SessionPolicy(name); p {
+	case SessionsShared, SessionLastWins:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown session policy %q", name)
+	}
+}
+
+// SetSessionPolicy sets what happens to a player's other sessions when they
+// join again.
+func (d *Dispatcher) SetSessionPolicy(policy SessionPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessionPolicy = policy
+}
+
+// otherSessions returns the clients other than client joined to a game as
+// the same player.
+func (d *Dispatcher) otherSessions(client *hub.Client, code, playerID string) []*hub.Client {
+	var others []*hub.Client
+	for _, c := range d.hub.PlayerClients(code, playerID) {
+		if c != client {
+			others = append(others, c)
+		}
+	}
+	return others
+}
+
+// replaceSessions closes a player's older sessions in a game under
+// SessionLastWins, now that client has joined as them. The older sessions
+// leave the game first, so closing them doesn't mark the player
+// disconnected.
+func (d *Dispatcher) replaceSessions(client *hub.Client, code, playerID string) {
+	d.mu.Lock()
+	policy := d.sessionPolicy
+	d.mu.Unlock()
+	if policy != SessionLastWins {
+		return
+	}
+
+	for _, old := range d.otherSessions(client, code, playerID) {
+		d.hub.LeaveGame(old)
+		d.hub.SendToClient(old, message.SessionReplacedMessage{
+			Type:     message.TypeSessionReplaced,
+			GameCode: code,
+			PlayerID: playerID,
+		})
+		old.CloseWithReason(CloseSessionReplaced, "session replaced")
+	}
+}
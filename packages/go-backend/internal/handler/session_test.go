@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func TestDisconnectKeepsPlayerWithAnotherSession(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	g, alice, _ := store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+	bobClient := newDispatcherClient(h, "bob")
+	h.JoinGame(bobClient, g.Code, bob.ID)
+
+	rejoin := message.ClientMessage{Action: message.ActionRejoinGame, GameCode: g.Code, PlayerID: alice.ID}
+	tab1 := newDispatcherClient(h, "tab1")
+	d.Dispatch(tab1, rejoin)
+	tab2 := newDispatcherClient(h, "tab2")
+	d.Dispatch(tab2, rejoin)
+	for len(bobClient.Send) > 0 {
+		<-bobClient.Send
+	}
+
+	if res := d.Disconnect(tab1); len(res.Broadcasts) != 0 {
+		t.Error("Closing one tab should not announce the player left")
+	}
+	h.Unregister(tab1)
+	if !g.GetPlayer(alice.ID).IsConnected {
+		t.Error("Expected Alice to stay connected from her other tab")
+	}
+
+	d.Disconnect(tab2)
+	if g.GetPlayer(alice.ID).IsConnected {
+		t.Error("Expected Alice to be disconnected once her last tab closed")
+	}
+	if len(bobClient.Send) != 1 || !containsType(string(<-bobClient.Send), message.TypePlayerLeft) {
+		t.Error("Expected playerLeft once the last tab closed")
+	}
+}
+
+func TestPollDisconnectKeepsPlayerWithWebSocketSession(t *testing.T) {
+	h := newTestPollHandler()
+	g, alice, _ := h.store.Create("Alice")
+	connID := connectPoll(t, h)
+	sendMessage(t, h, connID, message.ClientMessage{Action: message.ActionRejoinGame, GameCode: g.Code, PlayerID: alice.ID})
+
+	ws := newDispatcherClient(h.hub, "ws")
+	h.commands.Dispatch(ws, message.ClientMessage{Action: message.ActionRejoinGame, GameCode: g.Code, PlayerID: alice.ID})
+
+	req := httptest.NewRequest(http.MethodPost, "/poll/disconnect", nil)
+	req.Header.Set("X-Connection-Id", connID)
+	h.HandleDisconnect(httptest.NewRecorder(), req)
+
+	if !g.GetPlayer(alice.ID).IsConnected {
+		t.Error("Expected Alice to stay connected over WebSocket")
+	}
+}
+
+func TestLastSessionWins(t *testing.T) {
+	d, store, h := newTestDispatcher()
+	d.SetSessionPolicy(SessionLastWins)
+	g, alice, _ := store.Create("Alice")
+
+	rejoin := message.ClientMessage{Action: message.ActionRejoinGame, GameCode: g.Code, PlayerID: alice.ID}
+	oldTab := newDispatcherClient(h, "old")
+	d.DispatchToClient(oldTab, rejoin)
+	<-oldTab.Send
+	newTab := newDispatcherClient(h, "new")
+	d.DispatchToClient(newTab, rejoin)
+
+	var replaced message.SessionReplacedMessage
+	json.Unmarshal(<-oldTab.Send, &replaced)
+	if replaced.Type != message.TypeSessionReplaced || replaced.PlayerID != alice.ID || replaced.GameCode != g.Code {
+		t.Errorf("Expected sessionReplaced, got %+v", replaced)
+	}
+	if _, ok := <-oldTab.Send; ok {
+		t.Error("Expected the old session to be closed")
+	}
+	want := websocket.FormatCloseMessage(CloseSessionReplaced, "session replaced")
+	if string(oldTab.CloseMessage()) != string(want) {
+		t.Errorf("Unexpected close frame %q", oldTab.CloseMessage())
+	}
+
+	// The old session's connection closing leaves the new one connected
+	d.Disconnect(oldTab)
+	if !g.GetPlayer(alice.ID).IsConnected {
+		t.Error("Expected Alice to stay connected from the new session")
+	}
+	if clients := h.PlayerClients(g.Code, alice.ID); len(clients) != 1 || clients[0] != newTab {
+		t.Errorf("Expected only the new session in the game, got %d", len(clients))
+	}
+}
+
+func TestParseSessionPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    SessionPolicy
+		wantErr bool
+	}{
+		{"shared", SessionsShared, false},
+		{"last-wins", SessionLastWins, false},
+		{"first-wins", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSessionPolicy(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Expected %q (error %v), got %q (%v)", tt.want, tt.wantErr, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+const (
+	// sseKeepalive is how often an idle stream gets a comment so proxies
+	// don't time it out.
+	sseKeepalive = 15 * time.Second
+	// sseRetry is the reconnect delay suggested to EventSource clients.
+	sseRetry = 2 * time.Second
+	// sseWriteWait is how long writing an event may take.
+	sseWriteWait = 10 * time.Second
+	// maxSSESendSize is the largest action accepted on /sse/send.
+	maxSSESendSize = 4096
+)
+
+// SSEHandler streams server messages over Server-Sent Events, for clients
+// that can't keep a WebSocket open. Each stream is a hub client, so it gets
+// the same messages as a WebSocket; client actions are posted to
+// /sse/send and their replies arrive on the stream.
+type SSEHandler struct {
+	store    game.Store
+	hub      *hub.Hub
+	commands *Dispatcher
+
+	mu      sync.RWMutex
+	streams map[string]*hub.Client
+}
+
+// NewSSEHandler creates a new SSE handler.
+func NewSSEHandler(store game.Store, h *hub.Hub, commands *Dispatcher) *SSEHandler {
+	return &SSEHandler{
+		store:    store,
+		hub:      h,
+		commands: commands,
+		streams:  make(map[string]*hub.Client),
+	}
+}
+
+// HandleStream handles GET /sse — opens an event stream.
+//
+// The first event, named "connection", carries the connectionId to send
+// actions with. With ?gameCode= the stream joins that game straight away:
+// as the player in ?playerId= if given (like rejoinGame), otherwise as a
+// spectator. Events stamped with a seq carry "<epoch>:<seq>" as their event
+// ID, so a reconnecting EventSource resumes from Last-Event-ID if it comes
+// back to the same instance (see Hub.Epoch). A client that can't
+// resume but holds the players at state ?version= gets a delta against it.
+func (h *SSEHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	code := strings.ToUpper(query.Get("gameCode"))
+	playerID := query.Get("playerId")
+	if code != "" && h.store.Get(code) == nil {
+		h.writeError(w, http.StatusNotFound, message.ErrGameNotFound, "Game not found")
+		return
+	}
+
+	var version *uint64
+	if v := query.Get("version"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Invalid version")
+			return
+		}
+		version = &parsed
+	}
+
+	var lastSeq *uint64
+	var epoch string
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		e, s, _ := strings.Cut(id, ":")
+		if seq, err := strconv.ParseUint(s, 10, 64); err == nil {
+			epoch, lastSeq = e, &seq
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	client := &hub.Client{
+		ID:       generateSSEID(),
+		Send:     make(chan []byte, 256),
+		RemoteIP: h.commands.clientIP(r),
+	}
+	h.hub.Register(client)
+	h.mu.Lock()
+	h.streams[client.ID] = client
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.streams, client.ID)
+		h.mu.Unlock()
+		h.commands.Disconnect(client)
+		h.hub.Unregister(client)
+	}()
+
+	connected, _ := json.Marshal(map[string]string{"connectionId": client.ID})
+	fmt.Fprintf(w, "retry: %d\nevent: connection\ndata: %s\n\n", sseRetry.Milliseconds(), connected)
+	if err := rc.Flush(); err != nil {
+		log.Printf("SSE streaming unsupported: %v", err)
+		return
+	}
+
+	if code != "" {
+		h.join(client, code, playerID, epoch, lastSeq, version)
+	}
+
+	ticker := time.NewTicker(sseKeepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-client.Send:
+			if !ok {
+				// Closed by the hub, e.g. on shutdown
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			if err := writeEvent(w, h.hub.Epoch(), data); err != nil {
+				return
+			}
+
+			// Caught up: flush anything the slow consumer policy held back
+			if len(client.Send) == 0 {
+				if err := rc.Flush(); err != nil {
+					return
+				}
+				drainClient(h.hub, h.store, client, nil)
+			}
+
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			io.WriteString(w, ": keepalive\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// HandleSend handles POST /sse/send — processes a client message for the
+// stream in X-Connection-Id. Replies are sent on the stream.
+func (h *SSEHandler) HandleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	connID := r.Header.Get("X-Connection-Id")
+	if connID == "" {
+		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "X-Connection-Id header is required")
+		return
+	}
+
+	h.mu.RLock()
+	client := h.streams[connID]
+	h.mu.RUnlock()
+	if client == nil {
+		h.writeError(w, http.StatusNotFound, message.ErrInvalidMessage, "Connection not found")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSSESendSize))
+	if err != nil {
+		// Counts against the stream's limits like any other rejected message
+		if res := h.commands.limit(client, ""); res.Reply != nil {
+			h.commands.refuse(client, res, true)
+		}
+		h.writeError(w, http.StatusBadRequest, message.ErrInvalidMessage, "Message too large")
+		return
+	}
+
+	h.commands.DispatchJSON(client, data)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// join subscribes a new stream to a game, resuming from lastSeq if the hub
+// numbered it in epoch and still has everything after it.
+func (h *SSEHandler) join(client *hub.Client, code, playerID, epoch string, lastSeq, version *uint64) {
+	if playerID != "" {
+		h.commands.DispatchToClient(client, message.ClientMessage{
+			Action:   message.ActionRejoinGame,
+			GameCode: code,
+			PlayerID: playerID,
+			LastSeq:  lastSeq,
+			Epoch:    epoch,
+			Version:  version,
+		})
+		return
+	}
+
+	// Spectators get the current state unless they can resume
+	if lastSeq != nil && client.Sequenced() {
+		if _, ok := h.hub.Resume(client, code, "", epoch, *lastSeq); ok {
+			return
+		}
+	} else {
+		h.hub.JoinGame(client, code, "")
+	}
+
+	// Read before the state is built, so the state is at least this recent
+	seq := h.hub.GameSeq(code)
+	g := h.store.Get(code)
+	if g == nil {
+		h.hub.SendToClient(client, message.NewErrorMessage(message.ErrGameNotFound, "Game not found"))
+		return
+	}
+	state := gameStateMessage(g, knownVersion(client, version))
+	if client.Sequenced() {
+		state.Seq = seq
+	}
+	h.hub.SendToClient(client, state)
+}
+
+func (h *SSEHandler) writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Type: "error", Code: code, Message: msg})
+}
+
+// writeEvent writes a message as an SSE event, using the epoch and its seq as
+// the event ID. Encoded messages are single-line JSON, so one data field is
+// enough.
+func writeEvent(w io.Writer, epoch string, data []byte) error {
+	if seq := messageSeq(data); seq != 0 {
+		if _, err := fmt.Fprintf(w, "id: %s:%d\n", epoch, seq); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// generateSSEID creates a unique SSE connection ID.
+func generateSSEID() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return "sse_" + hex.EncodeToString(bytes)
+}
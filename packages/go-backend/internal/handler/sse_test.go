@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+// sseEvent is one event read from a stream.
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// sseStream is an open event stream.
+type sseStream struct {
+	resp   *http.Response
+	r      *bufio.Reader
+	connID string
+}
+
+func newTestSSEServer(t *testing.T) (*SSEHandler, *httptest.Server) {
+	t.Helper()
+	store := game.NewMemoryStore()
+	h := hub.NewHub()
+	sse := NewSSEHandler(store, h, NewDispatcher(store, h))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", sse.HandleStream)
+	mux.HandleFunc("/sse/send", sse.HandleSend)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return sse, srv
+}
+
+func openStream(t *testing.T, srv *httptest.Server, query, lastEventID string) *sseStream {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/sse?"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /sse failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /sse returned status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	s := &sseStream{resp: resp, r: bufio.NewReader(resp.Body)}
+	ev := s.next(t)
+	if ev.Event != "connection" {
+		t.Fatalf("Expected a connection event first, got %q", ev.Event)
+	}
+	var conn map[string]string
+	json.Unmarshal([]byte(ev.Data), &conn)
+	s.connID = conn["connectionId"]
+	if !strings.HasPrefix(s.connID, "sse_") {
+		t.Errorf("connectionId should start with 'sse_', got %s", s.connID)
+	}
+	return s
+}
+
+// next reads the next event, skipping keepalive comments.
+func (s *sseStream) next(t *testing.T) sseEvent {
+	t.Helper()
+	done := make(chan sseEvent, 1)
+	go func() {
+		var ev sseEvent
+		for {
+			line, err := s.r.ReadString('\n')
+			if err != nil {
+				close(done)
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				if ev.Data != "" {
+					done <- ev
+					return
+				}
+			case strings.HasPrefix(line, "id: "):
+				ev.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	select {
+	case ev, ok := <-done:
+		if !ok {
+			t.Fatal("Stream ended")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("No event received")
+		return sseEvent{}
+	}
+}
+
+func (s *sseStream) send(t *testing.T, srv *httptest.Server, msg message.ClientMessage) {
+	t.Helper()
+	body, _ := json.Marshal(msg)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/sse/send", bytes.NewReader(body))
+	req.Header.Set("X-Connection-Id", s.connID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /sse/send failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /sse/send returned status %d", resp.StatusCode)
+	}
+}
+
+func eventType(ev sseEvent) string {
+	return messageType(json.RawMessage(ev.Data))
+}
+
+// --- Stream tests ---
+
+func TestSSESpectatorReceivesStateAndBroadcasts(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	g, _, _ := sse.store.Create("Alice")
+
+	s := openStream(t, srv, "gameCode="+strings.ToLower(g.Code), "")
+
+	if ev := s.next(t); eventType(ev) != message.TypeGameState {
+		t.Errorf("Expected gameState, got %s", eventType(ev))
+	}
+
+	sse.hub.BroadcastToGame(g.Code, map[string]string{"type": message.TypePlayerMoved})
+	ev := s.next(t)
+	if eventType(ev) != message.TypePlayerMoved {
+		t.Errorf("Expected playerMoved, got %s", eventType(ev))
+	}
+	if want := sse.hub.Epoch() + ":1"; ev.ID != want {
+		t.Errorf("Expected event ID %s, got %q", want, ev.ID)
+	}
+}
+
+func TestSSEUnknownGame(t *testing.T) {
+	_, srv := newTestSSEServer(t)
+
+	resp, err := http.Get(srv.URL + "/sse?gameCode=NOPE00")
+	if err != nil {
+		t.Fatalf("GET /sse failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestSSEResumesFromLastEventID(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	g, _, _ := sse.store.Create("Alice")
+
+	for i := 1; i <= 3; i++ {
+		sse.hub.BroadcastToGame(g.Code, map[string]int{"n": i})
+	}
+
+	epoch := sse.hub.Epoch()
+	s := openStream(t, srv, "gameCode="+g.Code, epoch+":1")
+
+	// The missed events replace the snapshot
+	for _, want := range []string{epoch + ":2", epoch + ":3"} {
+		if ev := s.next(t); ev.ID != want {
+			t.Errorf("Expected event ID %s, got %q (%s)", want, ev.ID, ev.Data)
+		}
+	}
+}
+
+func TestSSEIgnoresLastEventIDFromAnotherInstance(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	g, _, _ := sse.store.Create("Alice")
+
+	for i := 1; i <= 3; i++ {
+		sse.hub.BroadcastToGame(g.Code, map[string]int{"n": i})
+	}
+
+	// Seq 1 elsewhere says nothing about seq 1 here
+	s := openStream(t, srv, "gameCode="+g.Code, hub.NewHub().Epoch()+":1")
+
+	if ev := s.next(t); eventType(ev) != message.TypeGameState {
+		t.Errorf("Expected a full snapshot, got %s", ev.Data)
+	}
+}
+
+// --- Send tests ---
+
+func TestSSESendJoinGame(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	g, _, _ := sse.store.Create("Alice")
+
+	watcher := openStream(t, srv, "gameCode="+g.Code, "")
+	watcher.next(t) // gameState
+
+	s := openStream(t, srv, "", "")
+	s.send(t, srv, message.ClientMessage{
+		Action:   message.ActionJoinGame,
+		GameCode: g.Code,
+		Name:     "Bob",
+	})
+
+	ev := s.next(t)
+	if eventType(ev) != message.TypeJoinedGame {
+		t.Fatalf("Expected joinedGame on the stream, got %s", eventType(ev))
+	}
+	if ev := watcher.next(t); eventType(ev) != message.TypePlayerJoined {
+		t.Errorf("Expected playerJoined for the watcher, got %s", eventType(ev))
+	}
+}
+
+func TestSSESendErrors(t *testing.T) {
+	_, srv := newTestSSEServer(t)
+
+	tests := []struct {
+		name   string
+		connID string
+		want   int
+	}{
+		{"missing header", "", http.StatusBadRequest},
+		{"unknown connection", "sse_nonexistent", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/sse/send", strings.NewReader(`{"action":"ping"}`))
+			if tt.connID != "" {
+				req.Header.Set("X-Connection-Id", tt.connID)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST /sse/send failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// --- Cleanup tests ---
+
+func TestSSECloseDisconnectsPlayer(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	g, _, _ := sse.store.Create("Alice")
+	bob, _ := g.AddPlayer("Bob")
+
+	s := openStream(t, srv, "gameCode="+g.Code+"&playerId="+bob.ID, "")
+	if ev := s.next(t); eventType(ev) != message.TypeJoinedGame {
+		t.Fatalf("Expected joinedGame, got %s", eventType(ev))
+	}
+	// GetPlayers copies under the game lock, which the stream's cleanup races with
+	connected := func() bool {
+		for _, p := range g.GetPlayers() {
+			if p.ID == bob.ID {
+				return p.IsConnected
+			}
+		}
+		return false
+	}
+	if !connected() {
+		t.Fatal("Bob should be connected while streaming")
+	}
+
+	s.resp.Body.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("Bob should be disconnected once the stream closes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sse.mu.RLock()
+	defer sse.mu.RUnlock()
+	if len(sse.streams) != 0 {
+		t.Errorf("Expected 0 streams, got %d", len(sse.streams))
+	}
+}
+
+func TestSSEHubShutdownEndsStream(t *testing.T) {
+	sse, srv := newTestSSEServer(t)
+	s := openStream(t, srv, "", "")
+
+	sse.hub.Shutdown(map[string]string{"type": message.TypeServerRestarting})
+
+	if ev := s.next(t); eventType(ev) != message.TypeServerRestarting {
+		t.Errorf("Expected serverRestarting, got %s", eventType(ev))
+	}
+	if _, err := s.r.ReadString('\n'); err == nil {
+		t.Error("Stream should end after the hub closes the client")
+	}
+}
@@ -1,10 +1,11 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,68 +15,110 @@ import (
 	"github.com/snakes-and-ladders/go-backend/internal/message"
 )
 
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 4096
-)
-
 // WebSocketHandler handles WebSocket connections.
 type WebSocketHandler struct {
-	store    *game.Store
+	store    game.Store
 	hub      *hub.Hub
+	commands *Dispatcher
 	upgrader websocket.Upgrader
+	settings config.WebSocketConfig
+
+	// pumps tracks running write pumps so shutdown can wait for them to flush.
+	pumps sync.WaitGroup
+	stats wsCounters
+}
+
+// wsConnection is what the pumps of one connection share.
+type wsConnection struct {
+	client *hub.Client
+	codec  message.Codec
+	// compress is set if the client negotiated permessage-deflate.
+	compress bool
+	// wire counts the bytes written to the network.
+	wire *countingConn
 }
 
 // NewWebSocketHandler creates a new WebSocket handler.
-func NewWebSocketHandler(store *game.Store, h *hub.Hub, cfg *config.Config) *WebSocketHandler {
+func NewWebSocketHandler(store game.Store, h *hub.Hub, commands *Dispatcher, cfg *config.Config) *WebSocketHandler {
 	return &WebSocketHandler{
-		store: store,
-		hub:   h,
+		store:    store,
+		hub:      h,
+		commands: commands,
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:    cfg.WebSocket.ReadBufferSize,
+			WriteBufferSize:   cfg.WebSocket.WriteBufferSize,
+			Subprotocols:      message.Subprotocols(),
+			EnableCompression: cfg.WebSocket.Compression,
 			CheckOrigin: func(r *http.Request) bool {
 				origin := r.Header.Get("Origin")
 				return cfg.IsOriginAllowed(origin)
 			},
 		},
+		settings: cfg.WebSocket,
 	}
 }
 
 // ServeHTTP handles WebSocket upgrade requests.
 func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	cw := &countingResponseWriter{ResponseWriter: w}
+	conn, err := h.upgrader.Upgrade(cw, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
+	compress := h.settings.Compression && offersDeflate(r)
+	if compress {
+		conn.SetCompressionLevel(h.settings.CompressionLevel)
+	}
+
+	// Negotiated from Sec-WebSocket-Protocol; JSON if the client offered none
+	codec := message.CodecFor(conn.Subprotocol())
+
 	clientID := generateClientID()
 	client := &hub.Client{
-		ID:   clientID,
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		ID:       clientID,
+		Conn:     conn,
+		Send:     make(chan []byte, 256),
+		Encoding: codec,
+		RemoteIP: h.commands.clientIP(r),
 	}
 
 	h.hub.Register(client)
+	h.stats.opened(compress)
+
+	c := &wsConnection{client: client, codec: codec, compress: compress, wire: cw.conn}
+	h.pumps.Add(1)
+	go h.writePump(c)
+	go h.readPump(c)
+}
 
-	go h.writePump(client)
-	go h.readPump(client)
+// WaitForClosed blocks until every write pump has exited or ctx is done.
+func (h *WebSocketHandler) WaitForClosed(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
 }
 
-func (h *WebSocketHandler) readPump(client *hub.Client) {
+func (h *WebSocketHandler) readPump(c *wsConnection) {
+	client := c.client
 	defer func() {
-		h.handleDisconnect(client)
+		h.commands.Disconnect(client)
 		h.hub.Unregister(client)
 		client.Conn.Close()
 	}()
 
-	client.Conn.SetReadLimit(maxMessageSize)
-	client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.Conn.SetReadLimit(h.settings.MaxMessageSize)
+	client.Conn.SetReadDeadline(time.Now().Add(h.settings.PongWait))
 	client.Conn.SetPongHandler(func(string) error {
-		client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		client.Conn.SetReadDeadline(time.Now().Add(h.settings.PongWait))
 		return nil
 	})
 
@@ -88,38 +131,57 @@ func (h *WebSocketHandler) readPump(client *hub.Client) {
 			break
 		}
 
-		h.handleMessage(client, data)
+		h.commands.DispatchEncoded(client, c.codec, data)
 	}
 }
 
-func (h *WebSocketHandler) writePump(client *hub.Client) {
-	ticker := time.NewTicker(pingPeriod)
+func (h *WebSocketHandler) writePump(c *wsConnection) {
+	client := c.client
+	frameType := websocket.TextMessage
+	if c.codec.Binary() {
+		frameType = websocket.BinaryMessage
+	}
+
+	ticker := time.NewTicker(h.settings.PingPeriod)
 	defer func() {
 		ticker.Stop()
 		client.Conn.Close()
+		h.stats.closed(c.compress)
+		h.pumps.Done()
 	}()
 
 	for {
 		select {
-		case message, ok := <-client.Send:
-			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case data, ok := <-client.Send:
+			client.Conn.SetWriteDeadline(time.Now().Add(h.settings.WriteWait))
 			if !ok {
-				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				client.Conn.WriteMessage(websocket.CloseMessage, client.CloseMessage())
 				return
 			}
 
-			w, err := client.Conn.NextWriter(websocket.TextMessage)
+			// Small messages cost more to compress than they save
+			compress := c.compress && len(data) >= h.settings.CompressionThreshold
+			client.Conn.EnableWriteCompression(compress)
+
+			before := c.wire.Written()
+			w, err := client.Conn.NextWriter(frameType)
 			if err != nil {
 				return
 			}
-			w.Write(message)
+			w.Write(data)
 
 			if err := w.Close(); err != nil {
 				return
 			}
+			h.stats.sent(len(data), c.wire.Written()-before, compress)
+
+			// Caught up: flush anything the slow consumer policy held back
+			if len(client.Send) == 0 {
+				drainClient(h.hub, h.store, client, nil)
+			}
 
 		case <-ticker.C:
-			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			client.Conn.SetWriteDeadline(time.Now().Add(h.settings.WriteWait))
 			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -127,229 +189,31 @@ func (h *WebSocketHandler) writePump(client *hub.Client) {
 	}
 }
 
-func (h *WebSocketHandler) handleMessage(client *hub.Client, data []byte) {
-	var msg message.ClientMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
-		h.sendError(client, message.ErrInvalidMessage, "Invalid message format")
-		return
-	}
-
-	switch msg.Action {
-	case message.ActionJoinGame:
-		h.handleJoinGame(client, msg)
-	case message.ActionRejoinGame:
-		h.handleRejoinGame(client, msg)
-	case message.ActionRollDice:
-		h.handleRollDice(client, msg)
-	case message.ActionStartGame:
-		h.handleStartGame(client, msg)
-	case message.ActionPing:
-		h.hub.SendToClient(client, message.NewPongMessage())
-	default:
-		h.sendError(client, message.ErrInvalidMessage, "Unknown action: "+msg.Action)
-	}
-}
-
-func (h *WebSocketHandler) handleJoinGame(client *hub.Client, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.sendError(client, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player, err := g.AddPlayer(msg.Name)
-	if err != nil {
-		switch err {
-		case game.ErrGameFull:
-			h.sendError(client, message.ErrGameFull, "Game is full")
-		case game.ErrGameAlreadyStarted:
-			h.sendError(client, message.ErrGameAlreadyStarted, "Game has already started")
-		case game.ErrInvalidName:
-			h.sendError(client, message.ErrInvalidMessage, "Player name is required")
-		default:
-			h.sendError(client, message.ErrInternalError, "Failed to join game")
-		}
-		return
-	}
-
-	h.hub.JoinGame(client, code, player.ID)
-
-	// Send joinedGame to the new player
-	players := g.GetPlayers()
-	playerInfos := make([]message.PlayerInfo, len(players))
-	for i, p := range players {
-		playerInfos[i] = playerToInfo(p, code)
-	}
-
-	joinedMsg := message.JoinedGameMessage{
-		Type:     message.TypeJoinedGame,
-		PlayerID: player.ID,
-		Game:     gameToInfo(g),
-		Players:  playerInfos,
-	}
-	h.hub.SendToClient(client, joinedMsg)
-
-	// Broadcast playerJoined to other players
-	playerJoinedMsg := message.PlayerJoinedMessage{
-		Type:   message.TypePlayerJoined,
-		Player: playerToInfo(player, code),
-	}
-	h.hub.BroadcastToGameExcept(code, client.ID, playerJoinedMsg)
-}
-
-func (h *WebSocketHandler) handleRejoinGame(client *hub.Client, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.sendError(client, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player := g.GetPlayer(msg.PlayerID)
-	if player == nil {
-		h.sendError(client, message.ErrPlayerNotFound, "Player not found in game")
-		return
-	}
-
-	// Mark player as connected
-	g.SetPlayerConnected(msg.PlayerID, true)
-	h.hub.JoinGame(client, code, msg.PlayerID)
-
-	// Send joinedGame message (same as join, so frontend handles it consistently)
-	players := g.GetPlayers()
-	playerInfos := make([]message.PlayerInfo, len(players))
-	for i, p := range players {
-		playerInfos[i] = playerToInfo(p, code)
-	}
-
-	joinedMsg := message.JoinedGameMessage{
-		Type:     message.TypeJoinedGame,
-		PlayerID: msg.PlayerID,
-		Game:     gameToInfo(g),
-		Players:  playerInfos,
-	}
-	h.hub.SendToClient(client, joinedMsg)
-
-	// Notify other players that this player reconnected
-	playerJoinedMsg := message.PlayerJoinedMessage{
-		Type:   message.TypePlayerJoined,
-		Player: playerToInfo(player, code),
-	}
-	h.hub.BroadcastToGameExcept(code, client.ID, playerJoinedMsg)
-}
-
-func (h *WebSocketHandler) handleRollDice(client *hub.Client, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.sendError(client, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	player := g.GetPlayer(msg.PlayerID)
-	if player == nil {
-		h.sendError(client, message.ErrPlayerNotFound, "Player not found")
-		return
-	}
-
-	diceRoll, prevPos, newPos, effect, isWinner, err := g.RollDice(msg.PlayerID)
-	if err != nil {
-		switch err {
-		case game.ErrGameNotStarted:
-			h.sendError(client, message.ErrGameNotStarted, "Game has not started")
-		default:
-			h.sendError(client, message.ErrInternalError, "Failed to roll dice")
+// drainClient completes a client's pending slow-consumer work, resyncing it
+// with the current state of its game if messages were dropped. known is the
+// state version the client has acknowledged, if any.
+func drainClient(hb *hub.Hub, store game.Store, client *hub.Client, known *uint64) {
+	code, _ := hb.GameOf(client)
+	// Read before the state is built, so the state is at least this recent
+	seq := hb.GameSeq(code)
+	// Drain holds the client's lock while building the state
+	known = knownVersion(client, known)
+	if !client.Sequenced() {
+		seq = 0
+	}
+	client.Drain(func() []byte {
+		g := store.Get(code)
+		if g == nil {
+			return nil
 		}
-		return
-	}
-
-	var moveEffect *message.MoveEffect
-	if effect != nil {
-		moveEffect = &message.MoveEffect{
-			Type: effect.Type,
-			From: effect.From,
-			To:   effect.To,
-		}
-	}
-
-	moveMsg := message.PlayerMovedMessage{
-		Type:             message.TypePlayerMoved,
-		PlayerID:         msg.PlayerID,
-		PlayerName:       player.Name,
-		DiceRoll:         diceRoll,
-		PreviousPosition: prevPos,
-		NewPosition:      newPos,
-		Effect:           moveEffect,
-	}
-	h.hub.BroadcastToGame(code, moveMsg)
-
-	if isWinner {
-		endMsg := message.GameEndedMessage{
-			Type:       message.TypeGameEnded,
-			WinnerID:   msg.PlayerID,
-			WinnerName: player.Name,
-		}
-		h.hub.BroadcastToGame(code, endMsg)
-	}
-}
-
-func (h *WebSocketHandler) handleStartGame(client *hub.Client, msg message.ClientMessage) {
-	code := strings.ToUpper(msg.GameCode)
-	g := h.store.Get(code)
-	if g == nil {
-		h.sendError(client, message.ErrGameNotFound, "Game not found")
-		return
-	}
-
-	err := g.Start(msg.PlayerID)
-	if err != nil {
-		switch err {
-		case game.ErrGameAlreadyStarted:
-			h.sendError(client, message.ErrGameAlreadyStarted, "Game has already started")
-		case game.ErrNotGameCreator:
-			h.sendError(client, message.ErrNotGameCreator, "Only the game creator can start the game")
-		default:
-			h.sendError(client, message.ErrInternalError, "Failed to start game")
+		state := gameStateMessage(g, known)
+		state.Seq = seq
+		data, err := json.Marshal(state)
+		if err != nil {
+			return nil
 		}
-		return
-	}
-
-	startMsg := message.GameStartedMessage{
-		Type:          message.TypeGameStarted,
-		Game:          gameToInfo(g),
-		FirstPlayerID: g.GetCurrentTurnPlayerID(),
-	}
-	h.hub.BroadcastToGame(code, startMsg)
-}
-
-func (h *WebSocketHandler) handleDisconnect(client *hub.Client) {
-	if client.GameCode == "" || client.PlayerID == "" {
-		return
-	}
-
-	g := h.store.Get(client.GameCode)
-	if g == nil {
-		return
-	}
-
-	player := g.GetPlayer(client.PlayerID)
-	if player == nil {
-		return
-	}
-
-	g.SetPlayerConnected(client.PlayerID, false)
-
-	leftMsg := message.PlayerLeftMessage{
-		Type:       message.TypePlayerLeft,
-		PlayerID:   client.PlayerID,
-		PlayerName: player.Name,
-	}
-	h.hub.BroadcastToGameExcept(client.GameCode, client.ID, leftMsg)
-}
-
-func (h *WebSocketHandler) sendError(client *hub.Client, code, msg string) {
-	h.hub.SendToClient(client, message.NewErrorMessage(code, msg))
+		return data
+	})
 }
 
 func generateClientID() string {
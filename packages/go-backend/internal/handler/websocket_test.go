@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/snakes-and-ladders/go-backend/internal/config"
+	"github.com/snakes-and-ladders/go-backend/internal/game"
+	"github.com/snakes-and-ladders/go-backend/internal/hub"
+	"github.com/snakes-and-ladders/go-backend/internal/message"
+)
+
+func newTestWebSocketServer(t *testing.T, settings config.WebSocketConfig) (*WebSocketHandler, *httptest.Server) {
+	t.Helper()
+	store := game.NewMemoryStore()
+	h := hub.NewHub()
+	cfg := &config.Config{AllowedOrigins: []string{"*"}, WebSocket: settings}
+	ws := NewWebSocketHandler(store, h, NewDispatcher(store, h), cfg)
+	srv := httptest.NewServer(ws)
+	t.Cleanup(srv.Close)
+	return ws, srv
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, subprotocols ...string) *websocket.Conn {
+	t.Helper()
+	return dialWith(t, srv, websocket.Dialer{Subprotocols: subprotocols})
+}
+
+func dialWith(t *testing.T, srv *httptest.Server, dialer websocket.Dialer) *websocket.Conn {
+	t.Helper()
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	return conn
+}
+
+// --- Encoding tests ---
+
+func TestWebSocketDefaultsToJSON(t *testing.T) {
+	_, srv := newTestWebSocketServer(t, config.DefaultWebSocketConfig())
+	conn := dialWebSocket(t, srv)
+
+	if conn.Subprotocol() != "" {
+		t.Errorf("Expected no subprotocol, got %q", conn.Subprotocol())
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"ping"}`))
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if frameType != websocket.TextMessage {
+		t.Errorf("Expected a text frame, got %d", frameType)
+	}
+	if messageType(data) != message.TypePong {
+		t.Errorf("Expected pong, got %s", data)
+	}
+}
+
+func TestWebSocketNegotiatesMsgpack(t *testing.T) {
+	_, srv := newTestWebSocketServer(t, config.DefaultWebSocketConfig())
+	conn := dialWebSocket(t, srv, "unknown", message.SubprotocolMsgpack)
+
+	if conn.Subprotocol() != message.SubprotocolMsgpack {
+		t.Fatalf("Expected %s, got %q", message.SubprotocolMsgpack, conn.Subprotocol())
+	}
+
+	ping, _ := message.MarshalMsgpack(message.ClientMessage{Action: message.ActionPing})
+	conn.WriteMessage(websocket.BinaryMessage, ping)
+
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if frameType != websocket.BinaryMessage {
+		t.Errorf("Expected a binary frame, got %d", frameType)
+	}
+	var pong message.PongMessage
+	if err := message.UnmarshalMsgpack(data, &pong); err != nil {
+		t.Fatalf("Reply is not MessagePack: %v", err)
+	}
+	if pong.Type != message.TypePong {
+		t.Errorf("Expected pong, got %q", pong.Type)
+	}
+}
+
+func TestWebSocketHelloAgreesBinaryForMsgpack(t *testing.T) {
+	_, srv := newTestWebSocketServer(t, config.DefaultWebSocketConfig())
+	hello := message.ClientMessage{
+		Action:          message.ActionHello,
+		ProtocolVersion: message.ProtocolVersion,
+		Features:        []string{message.FeatureBinary},
+	}
+
+	tests := []struct {
+		subprotocol string
+		want        []string
+	}{
+		{message.SubprotocolMsgpack, []string{message.FeatureBinary}},
+		{message.SubprotocolJSON, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subprotocol, func(t *testing.T) {
+			conn := dialWebSocket(t, srv, tt.subprotocol)
+			codec := message.CodecFor(tt.subprotocol)
+			data, _ := codec.Marshal(hello)
+			frameType := websocket.TextMessage
+			if codec.Binary() {
+				frameType = websocket.BinaryMessage
+			}
+			conn.WriteMessage(frameType, data)
+
+			_, reply, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage failed: %v", err)
+			}
+			var welcome message.WelcomeMessage
+			if err := codec.Unmarshal(reply, &welcome); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if welcome.Type != message.TypeWelcome || !reflect.DeepEqual(welcome.Features, tt.want) {
+				t.Errorf("Expected a welcome with %v, got %+v", tt.want, welcome)
+			}
+		})
+	}
+}
+
+func TestWebSocketMsgpackInvalidMessage(t *testing.T) {
+	_, srv := newTestWebSocketServer(t, config.DefaultWebSocketConfig())
+	conn := dialWebSocket(t, srv, message.SubprotocolMsgpack)
+
+	// JSON is not accepted once MessagePack was negotiated
+	conn.WriteMessage(websocket.BinaryMessage, []byte(`{"action":"ping"}`))
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	var errMsg message.ErrorMessage
+	message.UnmarshalMsgpack(data, &errMsg)
+	if errMsg.Code != message.ErrInvalidMessage {
+		t.Errorf("Expected %s, got %+v", message.ErrInvalidMessage, errMsg)
+	}
+}
+
+// --- Compression tests ---
+
+// waitForSent waits for the handler to count n messages sent, as the
+// counters are updated after the client may already have read them.
+func waitForSent(t *testing.T, ws *WebSocketHandler, n uint64) WebSocketStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := ws.Stats()
+		if stats.MessagesSent >= n {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d messages sent, got %d", n, stats.MessagesSent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketCompressesLargeMessages(t *testing.T) {
+	settings := config.DefaultWebSocketConfig()
+	settings.CompressionThreshold = 128
+	ws, srv := newTestWebSocketServer(t, settings)
+	g, _, _ := ws.store.Create("Alice")
+
+	conn := dialWith(t, srv, websocket.Dialer{EnableCompression: true})
+	conn.WriteJSON(message.ClientMessage{Action: message.ActionPing})
+	conn.WriteJSON(message.ClientMessage{Action: message.ActionJoinGame, GameCode: g.Code, Name: "Bob"})
+
+	for _, want := range []string{message.TypePong, message.TypeJoinedGame} {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage failed: %v", err)
+		}
+		if messageType(data) != want {
+			t.Errorf("Expected %s, got %s", want, data)
+		}
+	}
+
+	stats := waitForSent(t, ws, 2)
+	if stats.CompressedConnections != 1 {
+		t.Errorf("Expected 1 compressed connection, got %d", stats.CompressedConnections)
+	}
+	// The pong is under the threshold, the joinedGame isn't
+	if stats.MessagesCompressed != 1 {
+		t.Errorf("Expected 1 compressed message, got %d", stats.MessagesCompressed)
+	}
+	if stats.WireBytes >= stats.RawBytes {
+		t.Errorf("Expected fewer bytes on the wire than raw, got %d wire and %d raw", stats.WireBytes, stats.RawBytes)
+	}
+}
+
+func TestWebSocketCompressionDisabled(t *testing.T) {
+	settings := config.DefaultWebSocketConfig()
+	settings.Compression = false
+	settings.CompressionThreshold = 1
+	ws, srv := newTestWebSocketServer(t, settings)
+
+	conn := dialWith(t, srv, websocket.Dialer{EnableCompression: true})
+	conn.WriteJSON(message.ClientMessage{Action: message.ActionPing})
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+
+	stats := waitForSent(t, ws, 1)
+	if stats.CompressedConnections != 0 || stats.MessagesCompressed != 0 {
+		t.Errorf("Nothing should be compressed, got %+v", stats)
+	}
+	if stats.WireBytes <= stats.RawBytes {
+		t.Errorf("Uncompressed frames should add headers, got %d wire and %d raw", stats.WireBytes, stats.RawBytes)
+	}
+}
+
+// --- Settings tests ---
+
+func TestWebSocketReadLimit(t *testing.T) {
+	settings := config.DefaultWebSocketConfig()
+	settings.MaxMessageSize = 64
+	_, srv := newTestWebSocketServer(t, settings)
+
+	conn := dialWebSocket(t, srv)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"ping","playerName":"`+strings.Repeat("x", 64)+`"}`))
+
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected the connection to close with message too big, got %v", err)
+	}
+}
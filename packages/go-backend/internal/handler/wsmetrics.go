@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// WebSocketStats counts what the WebSocket handler has sent, to show what
+// compression saves.
+type WebSocketStats struct {
+	// Connections is the number of open connections, of which
+	// CompressedConnections negotiated permessage-deflate.
+	Connections           int64 `json:"connections"`
+	CompressedConnections int64 `json:"compressedConnections"`
+	// MessagesSent is the number of messages written, of which
+	// MessagesCompressed were compressed.
+	MessagesSent       uint64 `json:"messagesSent"`
+	MessagesCompressed uint64 `json:"messagesCompressed"`
+	// RawBytes is the size of the messages before compression, and WireBytes
+	// what was written to the network for them, frame headers included.
+	RawBytes  uint64 `json:"rawBytes"`
+	WireBytes uint64 `json:"wireBytes"`
+}
+
+// wsCounters accumulates WebSocketStats.
+type wsCounters struct {
+	connections           atomic.Int64
+	compressedConnections atomic.Int64
+	messagesSent          atomic.Uint64
+	messagesCompressed    atomic.Uint64
+	rawBytes              atomic.Uint64
+	wireBytes             atomic.Uint64
+}
+
+func (c *wsCounters) opened(compress bool) {
+	c.connections.Add(1)
+	if compress {
+		c.compressedConnections.Add(1)
+	}
+}
+
+func (c *wsCounters) closed(compress bool) {
+	c.connections.Add(-1)
+	if compress {
+		c.compressedConnections.Add(-1)
+	}
+}
+
+func (c *wsCounters) sent(raw int, wire uint64, compressed bool) {
+	c.messagesSent.Add(1)
+	if compressed {
+		c.messagesCompressed.Add(1)
+	}
+	c.rawBytes.Add(uint64(raw))
+	c.wireBytes.Add(wire)
+}
+
+// Stats returns the handler's counters.
+func (h *WebSocketHandler) Stats() WebSocketStats {
+	return WebSocketStats{
+		Connections:           h.stats.connections.Load(),
+		CompressedConnections: h.stats.compressedConnections.Load(),
+		MessagesSent:          h.stats.messagesSent.Load(),
+		MessagesCompressed:    h.stats.messagesCompressed.Load(),
+		RawBytes:              h.stats.rawBytes.Load(),
+		WireBytes:             h.stats.wireBytes.Load(),
+	}
+}
+
+// countingConn counts the bytes written to a connection.
+type countingConn struct {
+	net.Conn
+	written atomic.Uint64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+// Written returns the number of bytes written so far.
+func (c *countingConn) Written() uint64 {
+	return c.written.Load()
+}
+
+// countingResponseWriter hands the upgrader a countingConn when it hijacks
+// the connection, since the WebSocket library doesn't report what it writes.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	conn *countingConn
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &countingConn{Conn: conn}
+	return w.conn, rw, nil
+}
+
+// offersDeflate reports whether a WebSocket handshake offers
+// permessage-deflate.
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
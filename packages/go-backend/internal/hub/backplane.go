@@ -0,0 +1,111 @@
+package hub
+
+import "sync"
+
+// Broadcast is a message addressed to every client in a game, wherever they
+// are connected.
+type Broadcast struct {
+	// Origin is the ID of the hub that published the broadcast.
+	Origin string
+	// GameCode is the game whose clients receive the broadcast.
+	GameCode string
+	// ExcludeClientID, if set, is a client on the origin hub that is skipped.
+	ExcludeClientID string
+	// CoalesceKey, if set, lets a slow client keep only the latest broadcast
+	// with the same key.
+	CoalesceKey string
+	// Data is the encoded message.
+	Data []byte
+}
+
+// Backplane carries game broadcasts between hubs so that clients of the same
+// game can be connected to different server instances.
+//
+// A Backplane must deliver broadcasts for the same game to every subscriber
+// in the order they were published. Publishers receive their own broadcasts
+// too, so every instance sees the same order.
+//
+// Each hub stamps broadcasts with its own per-game seq as they are delivered.
+// Seqs are not shared between instances: a broadcast one instance delivered
+// locally while its backplane was down, or one another instance missed while
+// reconnecting, puts their seqs out of step for good. Resume therefore only
+// holds for a client reconnecting to the instance that gave it its last seq,
+// which it tells by the hub's Epoch; elsewhere the client must be sent a full
+// snapshot.
+type Backplane interface {
+	// Publish sends a broadcast to every subscribed hub.
+	Publish(b Broadcast) error
+	// Subscribe registers a function that delivers broadcasts to local clients.
+	// It returns once the subscription is active.
+	Subscribe(deliver func(Broadcast)) error
+	// Close stops delivery and releases any connections.
+	Close() error
+}
+
+// localBackplaneLocks is how many locks LocalBackplane spreads games over.
+const localBackplaneLocks = 64
+
+// LocalBackplane is an in-process Backplane. Broadcasts are delivered
+// synchronously to every subscriber, so a single instance behaves exactly as
+// if there were no backplane. Several hubs can share one to simulate multiple
+// instances in tests.
+type LocalBackplane struct {
+	// games serializes publishes per game, keyed by a hash of the game code,
+	// so every subscriber sees one game's broadcasts in the same order while
+	// other games publish in parallel.
+	games [localBackplaneLocks]sync.Mutex
+
+	// mu guards subscribers.
+	mu          sync.RWMutex
+	subscribers []func(Broadcast)
+}
+
+// NewLocalBackplane creates an in-process backplane.
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{}
+}
+
+// Publish delivers a broadcast to every subscriber before returning.
+func (b *LocalBackplane) Publish(broadcast Broadcast) error {
+	lock := b.gameLock(broadcast.GameCode)
+	lock.Lock()
+	defer lock.Unlock()
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, deliver := range subscribers {
+		deliver(broadcast)
+	}
+	return nil
+}
+
+// gameLock returns the lock that orders a game's publishes. The code is
+// hashed with 32-bit FNV-1a.
+func (b *LocalBackplane) gameLock(gameCode string) *sync.Mutex {
+	h := uint32(2166136261)
+	for i := 0; i < len(gameCode); i++ {
+		h ^= uint32(gameCode[i])
+		h *= 16777619
+	}
+	return &b.games[h%localBackplaneLocks]
+}
+
+// Subscribe registers a subscriber.
+func (b *LocalBackplane) Subscribe(deliver func(Broadcast)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, deliver)
+	return nil
+}
+
+// Close removes every subscriber.
+func (b *LocalBackplane) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = nil
+	return nil
+}
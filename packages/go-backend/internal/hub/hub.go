@@ -1,6 +1,8 @@
 package hub
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"sync"
@@ -15,25 +17,89 @@ type Client struct {
 	PlayerID string
 	Conn     *websocket.Conn
 	Send     chan []byte
+	// Encoding is the client's wire format, or nil for JSON. It must be set
+	// before the client is registered.
+	Encoding Encoding
+	// RemoteIP is the address the connection came from, for per-IP limits.
+	RemoteIP string
 
 	mu     sync.Mutex
 	closed bool
+
+	// closeCode and closeText are sent in the WebSocket close frame.
+	closeCode int
+	closeText string
+
+	// policy decides what happens when Send is full.
+	policy SlowConsumerPolicy
+	// resync is set when messages were dropped and the client needs a full
+	// game state before anything else.
+	resync bool
+	// overflow holds coalesced messages waiting for room in Send.
+	overflow []queuedMessage
+	stats    ClientCounters
+
+	// features are the protocol features the client agreed to in a
+	// handshake, and negotiated whether it made one.
+	features   []string
+	negotiated bool
+	// unsequenced clients get broadcasts without their seq.
+	unsequenced bool
 }
 
-// SafeSend sends data to the client's Send channel without panicking if closed.
-// Returns true if the message was sent, false if the client is closed or buffer full.
-func (c *Client) SafeSend(data []byte) bool {
+// SetFeatures records the protocol features a client agreed to in a
+// handshake. The hub only keeps them for the client's transport.
+func (c *Client) SetFeatures(features []string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.closed {
-		return false
-	}
-	select {
-	case c.Send <- data:
-		return true
-	default:
-		return false
+	c.features = features
+	c.negotiated = true
+}
+
+// Features returns the protocol features a client agreed to, and false if it
+// never made a handshake.
+func (c *Client) Features() ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.features, c.negotiated
+}
+
+// SetSequenced sets whether broadcasts reach the client stamped with their
+// seq. Clients are sequenced unless they opt out, and only sequenced clients
+// can resume.
+func (c *Client) SetSequenced(sequenced bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unsequenced = !sequenced
+}
+
+// Sequenced reports whether the client gets broadcasts with their seq.
+func (c *Client) Sequenced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.unsequenced
+}
+
+// Encoding converts messages to a client's wire format. The hub works in
+// JSON, so broadcasts are converted once for all clients sharing an encoding.
+type Encoding interface {
+	Marshal(v interface{}) ([]byte, error)
+	FromJSON(data []byte) ([]byte, error)
+}
+
+// encode converts JSON to the client's encoding.
+func (c *Client) encode(data []byte) ([]byte, error) {
+	if c.Encoding == nil {
+		return data, nil
 	}
+	return c.Encoding.FromJSON(data)
+}
+
+// SafeSend sends data to the client's Send channel without panicking if closed.
+// Returns false if the client is closed or the message could not be queued;
+// what happens to a full client depends on its SlowConsumerPolicy.
+func (c *Client) SafeSend(data []byte) bool {
+	return c.send(data, "")
 }
 
 // Close marks the client as closed and closes the Send channel.
@@ -47,8 +113,39 @@ func (c *Client) Close() {
 	}
 }
 
+// CloseWithReason closes the client and records the close code and reason to
+// send once the messages already queued have been written.
+func (c *Client) CloseWithReason(code int, text string) {
+	c.mu.Lock()
+	if !c.closed {
+		c.closeCode = code
+		c.closeText = text
+	}
+	c.mu.Unlock()
+	c.Close()
+}
+
+// CloseMessage returns the payload of the close frame for this client.
+func (c *Client) CloseMessage() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeCode == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeText)
+}
+
 // Hub maintains the set of active clients and broadcasts messages.
+//
+// Game broadcasts go through a Backplane, which hands them back to every hub
+// (including this one) for delivery to local clients.
 type Hub struct {
+	// id identifies this hub on the backplane.
+	id        string
+	backplane Backplane
+	// slowPolicy is applied to clients as they register.
+	slowPolicy SlowConsumerPolicy
+
 	mu sync.RWMutex
 
 	// Registered clients by connection ID
@@ -56,14 +153,38 @@ type Hub struct {
 
 	// Clients grouped by game code
 	gameClients map[string]map[string]*Client
+
+	// streams numbers each game's broadcasts for resuming clients.
+	streams    map[string]*gameStream
+	replaySize int
+
+	// reactions tallies reactions between broadcasts.
+	reactions reactions
 }
 
-// NewHub creates a new Hub.
+// NewHub creates a new Hub for a single instance.
 func NewHub() *Hub {
-	return &Hub{
+	h, _ := NewHubWithBackplane(NewLocalBackplane())
+	return h
+}
+
+// NewHubWithBackplane creates a Hub that shares game broadcasts with other
+// instances through backplane.
+func NewHubWithBackplane(backplane Backplane) (*Hub, error) {
+	h := &Hub{
+		id:          generateHubID(),
+		backplane:   backplane,
+		slowPolicy:  PolicyResync,
 		clients:     make(map[string]*Client),
 		gameClients: make(map[string]map[string]*Client),
+		streams:     make(map[string]*gameStream),
+		replaySize:  DefaultReplayBufferSize,
+		reactions:   reactions{games: make(map[string]*reactionTally)},
 	}
+	if err := backplane.Subscribe(h.deliver); err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
 // Register adds a client to the hub.
@@ -71,9 +192,25 @@ func (h *Hub) Register(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	// The client isn't shared yet, so its lock isn't needed
+	client.policy = h.slowPolicy
 	h.clients[client.ID] = client
 }
 
+// SetSlowConsumerPolicy sets the policy for clients registered from now on.
+func (h *Hub) SetSlowConsumerPolicy(policy SlowConsumerPolicy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.slowPolicy = policy
+}
+
+// GameOf returns the game and player a client is currently joined as.
+func (h *Hub) GameOf(client *Client) (gameCode, playerID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return client.GameCode, client.PlayerID
+}
+
 // Unregister removes a client from the hub.
 func (h *Hub) Unregister(client *Client) {
 	h.mu.Lock()
@@ -84,30 +221,21 @@ func (h *Hub) Unregister(client *Client) {
 		client.Close()
 	}
 
-	// Remove from game clients
-	if client.GameCode != "" {
-		if gameClients, ok := h.gameClients[client.GameCode]; ok {
-			delete(gameClients, client.ID)
-			if len(gameClients) == 0 {
-				delete(h.gameClients, client.GameCode)
-			}
-		}
-	}
+	h.leaveGameLocked(client)
 }
 
 // JoinGame associates a client with a game.
 func (h *Hub) JoinGame(client *Client, gameCode, playerID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.joinGameLocked(client, gameCode, playerID)
+}
 
+// joinGameLocked associates a client with a game. Callers must hold mu.
+func (h *Hub) joinGameLocked(client *Client, gameCode, playerID string) {
 	// Remove from previous game if any
-	if client.GameCode != "" && client.GameCode != gameCode {
-		if gameClients, ok := h.gameClients[client.GameCode]; ok {
-			delete(gameClients, client.ID)
-			if len(gameClients) == 0 {
-				delete(h.gameClients, client.GameCode)
-			}
-		}
+	if client.GameCode != gameCode {
+		h.leaveGameLocked(client)
 	}
 
 	client.GameCode = gameCode
@@ -120,64 +248,134 @@ func (h *Hub) JoinGame(client *Client, gameCode, playerID string) {
 	h.gameClients[gameCode][client.ID] = client
 }
 
-// BroadcastToGame sends a message to all clients in a game.
-func (h *Hub) BroadcastToGame(gameCode string, message interface{}) {
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
-		return
-	}
+// LeaveGame removes a client from its game, so nothing more is broadcast to
+// it for the game. The client stays registered.
+func (h *Hub) LeaveGame(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveGameLocked(client)
+	client.GameCode = ""
+	client.PlayerID = ""
+}
 
-	h.mu.RLock()
-	// Take a snapshot of clients under the lock
-	clients := make([]*Client, 0, len(h.gameClients[gameCode]))
-	for _, client := range h.gameClients[gameCode] {
-		clients = append(clients, client)
+// leaveGameLocked removes a client from its game's group. Callers must hold
+// mu.
+func (h *Hub) leaveGameLocked(client *Client) {
+	if client.GameCode == "" {
+		return
 	}
-	h.mu.RUnlock()
-
-	for _, client := range clients {
-		if !client.SafeSend(data) {
-			log.Printf("Client %s: send failed (closed or buffer full)", client.ID)
+	if gameClients, ok := h.gameClients[client.GameCode]; ok {
+		delete(gameClients, client.ID)
+		if len(gameClients) == 0 {
+			delete(h.gameClients, client.GameCode)
 		}
 	}
 }
 
+// BroadcastToGame sends a message to all clients in a game.
+func (h *Hub) BroadcastToGame(gameCode string, message interface{}) {
+	h.publish(gameCode, "", message)
+}
+
 // BroadcastToGameExcept sends a message to all clients in a game except one.
 func (h *Hub) BroadcastToGameExcept(gameCode, excludeClientID string, message interface{}) {
+	h.publish(gameCode, excludeClientID, message)
+}
+
+// publish encodes a message and sends it through the backplane. If the
+// backplane is unavailable the message still reaches local clients.
+func (h *Hub) publish(gameCode, excludeClientID string, message interface{}) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	h.mu.RLock()
-	clients := make([]*Client, 0, len(h.gameClients[gameCode]))
-	for _, client := range h.gameClients[gameCode] {
-		if client.ID != excludeClientID {
+	b := Broadcast{Origin: h.id, GameCode: gameCode, ExcludeClientID: excludeClientID, Data: data}
+	if c, ok := message.(Coalescer); ok {
+		b.CoalesceKey = c.CoalesceKey()
+	}
+	if err := h.backplane.Publish(b); err != nil {
+		log.Printf("Error publishing to backplane, delivering locally: %v", err)
+		h.deliver(b)
+	}
+}
+
+// deliver sends a broadcast from the backplane to this hub's clients,
+// stamping it with the game's next seq. Backplanes deliver one broadcast at a
+// time, so seqs follow the backplane order.
+func (h *Hub) deliver(b Broadcast) {
+	exclude := ""
+	if b.Origin == h.id {
+		exclude = b.ExcludeClientID
+	}
+
+	h.mu.Lock()
+	stream, ok := h.streams[b.GameCode]
+	if !ok {
+		stream = &gameStream{}
+		h.streams[b.GameCode] = stream
+	}
+	data := stream.append(b.Data, h.replaySize)
+
+	// Take a snapshot of clients under the lock
+	clients := make([]*Client, 0, len(h.gameClients[b.GameCode]))
+	for _, client := range h.gameClients[b.GameCode] {
+		if client.ID != exclude {
 			clients = append(clients, client)
 		}
 	}
-	h.mu.RUnlock()
+	h.mu.Unlock()
 
+	// Converted once per encoding rather than once per client
+	var encoded map[encodingKey][]byte
 	for _, client := range clients {
-		if !client.SafeSend(data) {
-			log.Printf("Client %s: send failed (closed or buffer full)", client.ID)
+		sequenced := client.Sequenced()
+		src := data
+		if !sequenced {
+			src = b.Data
 		}
+		out := src
+		if client.Encoding != nil {
+			key := encodingKey{client.Encoding, sequenced}
+			var ok bool
+			if out, ok = encoded[key]; !ok {
+				var err error
+				if out, err = client.encode(src); err != nil {
+					log.Printf("Error encoding message: %v", err)
+				}
+				if encoded == nil {
+					encoded = make(map[encodingKey][]byte)
+				}
+				encoded[key] = out
+			}
+			if out == nil {
+				continue
+			}
+		}
+		client.send(out, b.CoalesceKey)
 	}
 }
 
+// encodingKey identifies a converted broadcast in deliver.
+type encodingKey struct {
+	encoding  Encoding
+	sequenced bool
+}
+
 // SendToClient sends a message to a specific client.
 func (h *Hub) SendToClient(client *Client, message interface{}) {
-	data, err := json.Marshal(message)
+	marshal := json.Marshal
+	if client.Encoding != nil {
+		marshal = client.Encoding.Marshal
+	}
+	data, err := marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	if !client.SafeSend(data) {
-		log.Printf("Client %s: send failed (closed or buffer full)", client.ID)
-	}
+	client.SafeSend(data)
 }
 
 // GetGameClientCount returns the number of clients in a game.
@@ -191,6 +389,21 @@ func (h *Hub) GetGameClientCount(gameCode string) int {
 	return 0
 }
 
+// PlayerClients returns every client in a game joined as a player, e.g. one
+// per browser tab.
+func (h *Hub) PlayerClients(gameCode, playerID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var clients []*Client
+	for _, client := range h.gameClients[gameCode] {
+		if client.PlayerID == playerID {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
 // GetClientByPlayerID finds a client by player ID in a game.
 func (h *Hub) GetClientByPlayerID(gameCode, playerID string) *Client {
 	h.mu.RLock()
@@ -205,3 +418,51 @@ func (h *Hub) GetClientByPlayerID(gameCode, playerID string) *Client {
 	}
 	return nil
 }
+
+// RemoveGame drops every client from a game's group so nothing more is
+// broadcast to them for it, along with its untallied reactions. The clients
+// stay registered and can join another game.
+func (h *Hub) RemoveGame(gameCode string) {
+	h.dropReactions(gameCode)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, client := range h.gameClients[gameCode] {
+		client.GameCode = ""
+		client.PlayerID = ""
+	}
+	delete(h.gameClients, gameCode)
+	delete(h.streams, gameCode)
+}
+
+// Shutdown sends a final message to every client and then closes them all
+// with a service-restart close code.
+func (h *Hub) Shutdown(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+	}
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		if data != nil {
+			if out, err := client.encode(data); err == nil {
+				client.SafeSend(out)
+			}
+		}
+		client.CloseWithReason(websocket.CloseServiceRestart, "server restarting")
+	}
+}
+
+// generateHubID creates a random ID for a hub instance.
+func generateHubID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
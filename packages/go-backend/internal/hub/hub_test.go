@@ -0,0 +1,441 @@
+package hub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestClient(id string) *Client {
+	return &Client{ID: id, Send: make(chan []byte, 8)}
+}
+
+func TestShutdownNotifiesAndClosesClients(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a"), newTestClient("b")
+	h.Register(a)
+	h.Register(b)
+	h.JoinGame(a, "GAME01", "p1")
+
+	h.Shutdown(map[string]string{"type": "serverRestarting"})
+
+	for _, c := range []*Client{a, b} {
+		data, ok := <-c.Send
+		if !ok {
+			t.Fatalf("Client %s should receive the shutdown message before close", c.ID)
+		}
+		var msg map[string]string
+		json.Unmarshal(data, &msg)
+		if msg["type"] != "serverRestarting" {
+			t.Errorf("Expected serverRestarting, got %s", msg["type"])
+		}
+
+		if _, ok := <-c.Send; ok {
+			t.Errorf("Client %s Send channel should be closed", c.ID)
+		}
+
+		want := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+		if string(c.CloseMessage()) != string(want) {
+			t.Errorf("Client %s has unexpected close frame %q", c.ID, c.CloseMessage())
+		}
+	}
+}
+
+func TestRemoveGameClearsGroup(t *testing.T) {
+	h := NewHub()
+	a, b := newTestClient("a"), newTestClient("b")
+	h.Register(a)
+	h.Register(b)
+	h.JoinGame(a, "GAME01", "p1")
+	h.JoinGame(b, "GAME02", "p2")
+
+	h.RemoveGame("GAME01")
+
+	if n := h.GetGameClientCount("GAME01"); n != 0 {
+		t.Errorf("Expected 0 clients in removed game, got %d", n)
+	}
+	if n := h.GetGameClientCount("GAME02"); n != 1 {
+		t.Errorf("Expected other games to be untouched, got %d clients", n)
+	}
+	if code, playerID := h.GameOf(a); code != "" || playerID != "" {
+		t.Errorf("Client should no longer be in a game, got %s as %s", code, playerID)
+	}
+
+	h.BroadcastToGame("GAME01", map[string]string{"type": "playerMoved"})
+	if len(a.Send) != 0 {
+		t.Error("Removed game should no longer broadcast to its clients")
+	}
+}
+
+// --- Slow consumer tests ---
+
+// movedMessage is a coalescable test message.
+type movedMessage struct {
+	Type     string `json:"type"`
+	PlayerID string `json:"playerId"`
+	To       int    `json:"to"`
+}
+
+func (m movedMessage) CoalesceKey() string { return "moved:" + m.PlayerID }
+
+// newSlowClient registers a client with a two-slot buffer in GAME01.
+func newSlowClient(h *Hub, policy SlowConsumerPolicy) *Client {
+	h.SetSlowConsumerPolicy(policy)
+	c := &Client{ID: "slow", Send: make(chan []byte, 2)}
+	h.Register(c)
+	h.JoinGame(c, "GAME01", "p1")
+	return c
+}
+
+// drainAll empties a client's buffer, drains it and returns everything sent.
+func drainAll(c *Client, state func() []byte) []string {
+	var got []string
+	for {
+		select {
+		case data, ok := <-c.Send:
+			if !ok {
+				return got
+			}
+			got = append(got, string(data))
+			continue
+		default:
+		}
+		c.Drain(state)
+		if len(c.Send) == 0 {
+			return got
+		}
+	}
+}
+
+func TestSlowConsumerDisconnect(t *testing.T) {
+	h := NewHub()
+	c := newSlowClient(h, PolicyDisconnect)
+
+	for i := 0; i < 3; i++ {
+		h.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	want := websocket.FormatCloseMessage(CloseSlowConsumer, "slow consumer")
+	if string(c.CloseMessage()) != string(want) {
+		t.Errorf("Expected slow consumer close frame, got %q", c.CloseMessage())
+	}
+	if got := c.Stats().Dropped; got != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", got)
+	}
+}
+
+func TestSlowConsumerResync(t *testing.T) {
+	h := NewHub()
+	c := newSlowClient(h, PolicyResync)
+
+	for i := 0; i < 5; i++ {
+		h.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	stats := c.Stats()
+	if !stats.Resync || stats.Dropped != 3 || stats.Resyncs != 1 {
+		t.Errorf("Expected pending resync with 3 drops, got %+v", stats)
+	}
+
+	got := drainAll(c, func() []byte { return []byte(`{"type":"gameState"}`) })
+	want := []string{`{"seq":1,"n":0}`, `{"seq":2,"n":1}`, `{"type":"gameState"}`}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Message %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+	if c.Stats().Resync {
+		t.Error("Resync should be complete")
+	}
+}
+
+func TestSlowConsumerCoalesce(t *testing.T) {
+	h := NewHub()
+	c := newSlowClient(h, PolicyCoalesce)
+
+	h.BroadcastToGame("GAME01", movedMessage{"playerMoved", "a", 1})
+	h.BroadcastToGame("GAME01", movedMessage{"playerMoved", "b", 1})
+	// Buffer full from here on
+	h.BroadcastToGame("GAME01", movedMessage{"playerMoved", "a", 2})
+	h.BroadcastToGame("GAME01", movedMessage{"playerMoved", "b", 2})
+	h.BroadcastToGame("GAME01", movedMessage{"playerMoved", "a", 3})
+	h.BroadcastToGame("GAME01", map[string]string{"type": "gameEnded"})
+
+	if got := c.Stats().Coalesced; got != 1 {
+		t.Errorf("Expected 1 coalesced message, got %d", got)
+	}
+
+	got := drainAll(c, nil)
+	want := []string{
+		`{"seq":1,"type":"playerMoved","playerId":"a","to":1}`,
+		`{"seq":2,"type":"playerMoved","playerId":"b","to":1}`,
+		`{"seq":4,"type":"playerMoved","playerId":"b","to":2}`,
+		`{"seq":5,"type":"playerMoved","playerId":"a","to":3}`,
+		`{"seq":6,"type":"gameEnded"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d messages, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Message %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestClientStatsReportsDrops(t *testing.T) {
+	h := NewHub()
+	c := newSlowClient(h, PolicyResync)
+	h.Register(newTestClient("fast"))
+
+	for i := 0; i < 4; i++ {
+		h.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	stats := h.ClientStats()
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 clients, got %d", len(stats))
+	}
+	if stats[0].ID != c.ID || stats[0].Dropped != 2 || stats[0].GameCode != "GAME01" {
+		t.Errorf("Expected slow client first with 2 drops, got %+v", stats[0])
+	}
+}
+
+// --- Replay tests ---
+
+func TestBroadcastsCarrySeq(t *testing.T) {
+	h := NewHub()
+	c := newTestClient("a")
+	h.Register(c)
+	h.JoinGame(c, "GAME01", "p1")
+
+	h.BroadcastToGame("GAME01", map[string]string{"type": "playerMoved"})
+	h.BroadcastToGame("GAME01", struct{}{})
+	h.BroadcastToGame("GAME02", map[string]string{"type": "playerMoved"})
+
+	if got := string(<-c.Send); got != `{"seq":1,"type":"playerMoved"}` {
+		t.Errorf("Unexpected first message %s", got)
+	}
+	if got := string(<-c.Send); got != `{"seq":2}` {
+		t.Errorf("Unexpected second message %s", got)
+	}
+	if seq := h.GameSeq("GAME02"); seq != 1 {
+		t.Errorf("Each game should have its own seq, got %d", seq)
+	}
+}
+
+func TestUnsequencedClientGetsNoSeq(t *testing.T) {
+	h := NewHub()
+	enc := &prefixEncoding{}
+	plain, encoded, sequenced := newTestClient("plain"), newTestClient("encoded"), newTestClient("sequenced")
+	encoded.Encoding, sequenced.Encoding = enc, enc
+	for _, c := range []*Client{plain, encoded, sequenced} {
+		h.Register(c)
+		h.JoinGame(c, "GAME01", "")
+	}
+	plain.SetSequenced(false)
+	encoded.SetSequenced(false)
+
+	h.BroadcastToGame("GAME01", map[string]string{"type": "playerMoved"})
+
+	tests := []struct {
+		client *Client
+		want   string
+	}{
+		{plain, `{"type":"playerMoved"}`},
+		{encoded, `enc:{"type":"playerMoved"}`},
+		{sequenced, `enc:{"seq":1,"type":"playerMoved"}`},
+	}
+	for _, tt := range tests {
+		if got := string(<-tt.client.Send); got != tt.want {
+			t.Errorf("Client %s: expected %s, got %s", tt.client.ID, tt.want, got)
+		}
+	}
+	if h.GameSeq("GAME01") != 1 {
+		t.Errorf("The broadcast should still be numbered, got seq %d", h.GameSeq("GAME01"))
+	}
+}
+
+func TestResumeReplaysGap(t *testing.T) {
+	h := NewHub()
+	for i := 1; i <= 5; i++ {
+		h.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	c := newTestClient("a")
+	h.Register(c)
+	seq, ok := h.Resume(c, "GAME01", "p1", h.Epoch(), 3)
+	if !ok || seq != 5 {
+		t.Fatalf("Expected resume at seq 5, got %d, %v", seq, ok)
+	}
+
+	h.BroadcastToGame("GAME01", map[string]int{"n": 6})
+
+	for _, want := range []string{`{"seq":4,"n":4}`, `{"seq":5,"n":5}`, `{"seq":6,"n":6}`} {
+		if got := string(<-c.Send); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestResumeFallsBackWhenGapIsTooOld(t *testing.T) {
+	h := NewHub()
+	h.SetReplayBufferSize(3)
+	for i := 1; i <= 5; i++ {
+		h.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	tests := []struct {
+		name    string
+		epoch   string
+		lastSeq uint64
+		want    bool
+	}{
+		{"up to date", h.Epoch(), 5, true},
+		{"oldest buffered", h.Epoch(), 2, true},
+		{"evicted", h.Epoch(), 1, false},
+		{"from the future", h.Epoch(), 9, false},
+		{"from another instance", NewHub().Epoch(), 4, false},
+		{"without an epoch", "", 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient("a")
+			h.Register(c)
+			if _, ok := h.Resume(c, "GAME01", "p1", tt.epoch, tt.lastSeq); ok != tt.want {
+				t.Errorf("Expected resume %v, got %v", tt.want, ok)
+			}
+			if !tt.want && len(c.Send) != 0 {
+				t.Error("Nothing should be replayed when falling back to a snapshot")
+			}
+			if h.GetGameClientCount("GAME01") == 0 {
+				t.Error("Client should join the game either way")
+			}
+		})
+	}
+}
+
+// --- Encoding tests ---
+
+// prefixEncoding marks converted messages and counts conversions.
+type prefixEncoding struct {
+	conversions int
+}
+
+func (e *prefixEncoding) Marshal(v interface{}) ([]byte, error) {
+	data, _ := json.Marshal(v)
+	return e.FromJSON(data)
+}
+
+func (e *prefixEncoding) FromJSON(data []byte) ([]byte, error) {
+	e.conversions++
+	return append([]byte("enc:"), data...), nil
+}
+
+func TestBroadcastConvertsOncePerEncoding(t *testing.T) {
+	h := NewHub()
+	enc := &prefixEncoding{}
+	a, b, plain := newTestClient("a"), newTestClient("b"), newTestClient("plain")
+	a.Encoding, b.Encoding = enc, enc
+	for _, c := range []*Client{a, b, plain} {
+		h.Register(c)
+		h.JoinGame(c, "GAME01", "")
+	}
+
+	h.BroadcastToGame("GAME01", map[string]string{"type": "pong"})
+
+	for _, c := range []*Client{a, b} {
+		if got := string(<-c.Send); got != `enc:{"seq":1,"type":"pong"}` {
+			t.Errorf("Client %s: unexpected message %s", c.ID, got)
+		}
+	}
+	if got := string(<-plain.Send); got != `{"seq":1,"type":"pong"}` {
+		t.Errorf("JSON client: unexpected message %s", got)
+	}
+	if enc.conversions != 1 {
+		t.Errorf("Expected 1 conversion, got %d", enc.conversions)
+	}
+
+	h.SendToClient(a, map[string]string{"type": "pong"})
+	if got := string(<-a.Send); got != `enc:{"type":"pong"}` {
+		t.Errorf("Expected SendToClient to use the encoding, got %s", got)
+	}
+}
+
+func TestResumeConvertsReplay(t *testing.T) {
+	h := NewHub()
+	h.BroadcastToGame("GAME01", map[string]int{"n": 1})
+
+	c := newTestClient("c")
+	c.Encoding = &prefixEncoding{}
+	h.Register(c)
+	if _, ok := h.Resume(c, "GAME01", "", h.Epoch(), 0); !ok {
+		t.Fatal("Expected the gap to be replayed")
+	}
+	if got := string(<-c.Send); got != `enc:{"seq":1,"n":1}` {
+		t.Errorf("Unexpected replay %s", got)
+	}
+}
+
+// --- Reaction tests ---
+
+func TestReactionsTalliedPerWindow(t *testing.T) {
+	h := NewHub()
+	h.SetReactions(20*time.Millisecond, func(reaction string, count int) interface{} {
+		return map[string]interface{}{"reaction": reaction, "count": count}
+	})
+	a := newTestClient("a")
+	h.Register(a)
+	h.JoinGame(a, "GAME01", "p1")
+
+	for _, p := range []string{"p1", "p2", "p2", "p3"} {
+		h.React("GAME01", "party", p)
+	}
+	h.React("GAME01", "fire", "p1")
+
+	want := []struct {
+		reaction string
+		count    int
+	}{{"party", 3}, {"fire", 1}}
+	for _, w := range want {
+		select {
+		case data := <-a.Send:
+			var msg struct {
+				Reaction string `json:"reaction"`
+				Count    int    `json:"count"`
+			}
+			json.Unmarshal(data, &msg)
+			if msg.Reaction != w.reaction || msg.Count != w.count {
+				t.Errorf("Expected %d %s, got %s", w.count, w.reaction, data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected the %s tally", w.reaction)
+		}
+	}
+	if len(a.Send) != 0 {
+		t.Error("Expected one message per reaction per window")
+	}
+}
+
+func TestRemoveGameDropsReactions(t *testing.T) {
+	h := NewHub()
+	h.SetReactions(10*time.Millisecond, func(reaction string, count int) interface{} { return reaction })
+	a := newTestClient("a")
+	h.Register(a)
+	h.JoinGame(a, "GAME01", "p1")
+
+	h.React("GAME01", "party", "p1")
+	h.RemoveGame("GAME01")
+	h.JoinGame(a, "GAME01", "p1")
+	time.Sleep(30 * time.Millisecond)
+
+	if len(a.Send) != 0 {
+		t.Error("A removed game's reactions should not be broadcast")
+	}
+}
@@ -0,0 +1,98 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultReactionWindow is how long reactions are tallied before they are
+// broadcast.
+const DefaultReactionWindow = time.Second
+
+// ReactionBuilder builds the message broadcast for a reaction that count
+// players sent within a window.
+type ReactionBuilder func(reaction string, count int) interface{}
+
+// reactions tallies each game's reactions over a window, so a game gets at
+// most one message per reaction per window however many players send it.
+type reactions struct {
+	mu     sync.Mutex
+	window time.Duration
+	build  ReactionBuilder
+	games  map[string]*reactionTally
+}
+
+// reactionTally is the players who sent each reaction in a game's current
+// window.
+type reactionTally struct {
+	players map[string]map[string]bool
+	// order is the reactions in the order they were first sent.
+	order []string
+	timer *time.Timer
+}
+
+// SetReactions sets how reactions are tallied and the message each tally is
+// broadcast as. Until it is called, React does nothing.
+func (h *Hub) SetReactions(window time.Duration, build ReactionBuilder) {
+	h.reactions.mu.Lock()
+	defer h.reactions.mu.Unlock()
+	h.reactions.window = window
+	h.reactions.build = build
+}
+
+// React counts a player's reaction in a game's current window, starting the
+// window if it is the first. A player counts once per reaction per window.
+//
+// Each instance tallies the reactions sent to it, so with a backplane a
+// game's clients can get a message per reaction from each instance.
+func (h *Hub) React(gameCode, reaction, playerID string) {
+	r := &h.reactions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.build == nil {
+		return
+	}
+
+	tally, ok := r.games[gameCode]
+	if !ok {
+		tally = &reactionTally{players: make(map[string]map[string]bool)}
+		r.games[gameCode] = tally
+		tally.timer = time.AfterFunc(r.window, func() { h.flushReactions(gameCode, tally) })
+	}
+	players, ok := tally.players[reaction]
+	if !ok {
+		players = make(map[string]bool)
+		tally.players[reaction] = players
+		tally.order = append(tally.order, reaction)
+	}
+	players[playerID] = true
+}
+
+// flushReactions broadcasts a game's tally and ends its window.
+func (h *Hub) flushReactions(gameCode string, tally *reactionTally) {
+	r := &h.reactions
+	r.mu.Lock()
+	if r.games[gameCode] != tally {
+		// The game was removed
+		r.mu.Unlock()
+		return
+	}
+	delete(r.games, gameCode)
+	build := r.build
+	r.mu.Unlock()
+
+	for _, reaction := range tally.order {
+		h.BroadcastToGame(gameCode, build(reaction, len(tally.players[reaction])))
+	}
+}
+
+// dropReactions discards a game's tally without broadcasting it.
+func (h *Hub) dropReactions(gameCode string) {
+	r := &h.reactions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tally, ok := r.games[gameCode]; ok {
+		tally.timer.Stop()
+		delete(r.games, gameCode)
+	}
+}
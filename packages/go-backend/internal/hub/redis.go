@@ -0,0 +1,333 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisDialTimeout = 5 * time.Second
+
+// These are variables so tests can shorten them.
+var (
+	// redisIOTimeout bounds every command's write and the wait for its reply.
+	redisIOTimeout = 5 * time.Second
+	// redisReconnectDelay is how long a broken connection is left before it
+	// is redialed.
+	redisReconnectDelay = time.Second
+	// redisPingInterval is how often the subscriber pings Redis. A subscriber
+	// that hears nothing for two intervals reconnects.
+	redisPingInterval = 15 * time.Second
+)
+
+// RedisBackplane is a Backplane built on Redis pub/sub. Each game has its own
+// channel; every instance pattern-subscribes to all of them.
+//
+// Redis delivers the messages of a channel in publish order over a single
+// subscriber connection, and broadcasts are handed to the hub one at a time
+// in the order they arrive, so per-game ordering is preserved across
+// instances. Broadcasts published while the subscriber is reconnecting are
+// lost, as with any Redis pub/sub consumer.
+//
+// Every read and write has a deadline, so a stalled server holds up a
+// publish for at most redisIOTimeout. Publishes then fail fast until the
+// connection can be redialed, and the hub delivers them locally meanwhile.
+type RedisBackplane struct {
+	addr     string
+	password string
+	prefix   string
+
+	// pubMu serializes publishes on the shared publisher connection.
+	pubMu sync.Mutex
+	pub   *redisConn
+	// redialAt is when a broken publisher connection may next be redialed.
+	redialAt time.Time
+
+	// mu guards sub and closed.
+	mu     sync.Mutex
+	sub    *redisConn
+	closed bool
+}
+
+// NewRedisBackplane connects to the Redis server at addr. Channel names start
+// with prefix so several deployments can share one server.
+func NewRedisBackplane(addr, password, prefix string) (*RedisBackplane, error) {
+	b := &RedisBackplane{addr: addr, password: password, prefix: prefix}
+
+	pub, err := dialRedis(addr, password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pub.do("PING"); err != nil {
+		pub.close()
+		return nil, err
+	}
+	b.pub = pub
+	return b, nil
+}
+
+// Publish sends a broadcast to the game's channel. A broken or stalled
+// connection is dropped, and publishes fail without waiting until it is
+// redialed redisReconnectDelay later.
+func (b *RedisBackplane) Publish(broadcast Broadcast) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	if b.pub == nil {
+		if time.Now().Before(b.redialAt) {
+			return errors.New("redis: publisher reconnecting")
+		}
+		pub, err := dialRedis(b.addr, b.password)
+		if err != nil {
+			b.redialAt = time.Now().Add(redisReconnectDelay)
+			return err
+		}
+		b.pub = pub
+	}
+
+	_, err := b.pub.do("PUBLISH", b.channel(broadcast.GameCode), string(encodeBroadcast(broadcast)))
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			b.pub.close()
+			b.pub = nil
+			b.redialAt = time.Now().Add(redisReconnectDelay)
+		}
+		return err
+	}
+	return nil
+}
+
+// Subscribe starts delivering broadcasts from every game channel. It returns
+// once the first subscription is confirmed; after that the subscriber
+// reconnects on its own until Close is called.
+func (b *RedisBackplane) Subscribe(deliver func(Broadcast)) error {
+	sub, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+	go b.receive(sub, deliver)
+	return nil
+}
+
+// Close stops the subscriber and closes both connections.
+func (b *RedisBackplane) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	if b.sub != nil {
+		b.sub.close()
+	}
+	b.mu.Unlock()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub != nil {
+		b.pub.close()
+		b.pub = nil
+	}
+	return nil
+}
+
+// subscribe opens a subscriber connection and waits for Redis to confirm the
+// pattern subscription.
+func (b *RedisBackplane) subscribe() (*redisConn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errors.New("redis backplane closed")
+	}
+
+	sub, err := dialRedis(b.addr, b.password)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := sub.do("PSUBSCRIBE", b.channel("*"))
+	if err != nil {
+		sub.close()
+		return nil, err
+	}
+	if values, ok := reply.([]interface{}); !ok || len(values) == 0 || values[0] != "psubscribe" {
+		sub.close()
+		return nil, fmt.Errorf("redis: unexpected subscribe reply %v", reply)
+	}
+
+	b.sub = sub
+	return sub, nil
+}
+
+// receive reads published broadcasts until the backplane is closed,
+// reconnecting whenever the subscriber connection fails or goes quiet.
+func (b *RedisBackplane) receive(sub *redisConn, deliver func(Broadcast)) {
+	for {
+		done := make(chan struct{})
+		go keepAlive(sub, done)
+		err := b.readMessages(sub, deliver)
+		close(done)
+
+		b.mu.Lock()
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			return
+		}
+		log.Printf("Redis backplane subscriber disconnected: %v", err)
+		sub.close()
+
+		for {
+			time.Sleep(redisReconnectDelay)
+			if sub, err = b.subscribe(); err == nil {
+				log.Printf("Redis backplane subscriber reconnected")
+				break
+			}
+			b.mu.Lock()
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return
+			}
+			log.Printf("Error reconnecting Redis backplane: %v", err)
+		}
+	}
+}
+
+// keepAlive pings the subscriber connection until done is closed, so that
+// readMessages hears from a healthy server at least once per interval.
+func keepAlive(sub *redisConn, done <-chan struct{}) {
+	ticker := time.NewTicker(redisPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := sub.send("PING"); err != nil {
+				// The read fails too once the connection is closed
+				sub.close()
+				return
+			}
+		}
+	}
+}
+
+// readMessages delivers pmessage pushes in the order they arrive. It gives up
+// if nothing, not even a pong, arrives for two ping intervals.
+func (b *RedisBackplane) readMessages(sub *redisConn, deliver func(Broadcast)) error {
+	for {
+		sub.conn.SetReadDeadline(time.Now().Add(2 * redisPingInterval))
+		reply, err := readReply(sub.r)
+		if err != nil {
+			return err
+		}
+
+		// ["pmessage", pattern, channel, payload]
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 4 || values[0] != "pmessage" {
+			continue
+		}
+		channel, _ := values[2].(string)
+		payload, _ := values[3].(string)
+
+		broadcast, ok := decodeBroadcast([]byte(payload))
+		if !ok {
+			log.Printf("Skipping malformed backplane message on %s", channel)
+			continue
+		}
+		broadcast.GameCode = strings.TrimPrefix(channel, b.prefix+"game:")
+		deliver(broadcast)
+	}
+}
+
+func (b *RedisBackplane) channel(gameCode string) string {
+	return b.prefix + "game:" + gameCode
+}
+
+// encodeBroadcast frames a broadcast as "origin\nexclude\nkey\ndata". The
+// game code travels in the channel name.
+func encodeBroadcast(b Broadcast) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(b.Origin)
+	buf.WriteByte('\n')
+	buf.WriteString(b.ExcludeClientID)
+	buf.WriteByte('\n')
+	buf.WriteString(b.CoalesceKey)
+	buf.WriteByte('\n')
+	buf.Write(b.Data)
+	return buf.Bytes()
+}
+
+// decodeBroadcast parses a payload written by encodeBroadcast.
+func decodeBroadcast(payload []byte) (Broadcast, bool) {
+	parts := bytes.SplitN(payload, []byte("\n"), 4)
+	if len(parts) != 4 {
+		return Broadcast{}, false
+	}
+	return Broadcast{
+		Origin:          string(parts[0]),
+		ExcludeClientID: string(parts[1]),
+		CoalesceKey:     string(parts[2]),
+		Data:            parts[3],
+	}, true
+}
+
+// redisConn is a single connection to a Redis server.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// wmu serializes writes, which on a subscriber come from both
+	// PSUBSCRIBE and keepAlive.
+	wmu sync.Mutex
+	w   *bufio.Writer
+}
+
+// dialRedis connects to addr and authenticates if a password is set.
+func dialRedis(addr, password string) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// send writes a command without waiting for its reply.
+func (c *redisConn) send(args ...string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(redisIOTimeout))
+	return writeCommand(c.w, args...)
+}
+
+// do sends a command and returns its reply. Error replies are returned as err.
+// Both the write and the reply must complete within redisIOTimeout.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(redisIOTimeout))
+	reply, err := readReply(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+func (c *redisConn) close() {
+	c.conn.Close()
+}
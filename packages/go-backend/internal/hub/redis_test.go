@@ -0,0 +1,292 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory stand-in for the pub/sub subset of Redis.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	subs map[*fakeRedisConn]string // pattern per subscriber
+}
+
+type fakeRedisConn struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (c *fakeRedisConn) write(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, format, args...)
+	c.w.Flush()
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &fakeRedis{ln: ln, subs: make(map[*fakeRedisConn]string)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	c := &fakeRedisConn{w: bufio.NewWriter(conn)}
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		values, _ := reply.([]interface{})
+		args := make([]string, len(values))
+		for i, v := range values {
+			args[i], _ = v.(string)
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "PING":
+			c.write("+PONG\r\n")
+		case "PSUBSCRIBE":
+			s.mu.Lock()
+			s.subs[c] = args[1]
+			s.mu.Unlock()
+			c.write("*3\r\n$10\r\npsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case "PUBLISH":
+			channel, payload := args[1], args[2]
+			s.mu.Lock()
+			n := 0
+			for sub, pattern := range s.subs {
+				if ok, _ := path.Match(pattern, channel); ok {
+					sub.write("*4\r\n$8\r\npmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+						len(pattern), pattern, len(channel), channel, len(payload), payload)
+					n++
+				}
+			}
+			s.mu.Unlock()
+			c.write(":%d\r\n", n)
+		default:
+			c.write("-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+// redisAddr returns a real Redis server from REDIS_ADDR, or a fake one.
+func redisAddr(t *testing.T) string {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return startFakeRedis(t).ln.Addr().String()
+}
+
+func newRedisHub(t *testing.T, addr, prefix string) *Hub {
+	t.Helper()
+	bp, err := NewRedisBackplane(addr, "", prefix)
+	if err != nil {
+		t.Fatalf("NewRedisBackplane failed: %v", err)
+	}
+	t.Cleanup(func() { bp.Close() })
+
+	h, err := NewHubWithBackplane(bp)
+	if err != nil {
+		t.Fatalf("NewHubWithBackplane failed: %v", err)
+	}
+	return h
+}
+
+func receive(t *testing.T, c *Client) map[string]interface{} {
+	t.Helper()
+	select {
+	case data := <-c.Send:
+		var msg map[string]interface{}
+		json.Unmarshal(data, &msg)
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Client %s received nothing", c.ID)
+		return nil
+	}
+}
+
+func TestRedisBackplaneSharesGamesAcrossHubs(t *testing.T) {
+	addr := redisAddr(t)
+	prefix := fmt.Sprintf("test%d:", time.Now().UnixNano())
+	a, b := newRedisHub(t, addr, prefix), newRedisHub(t, addr, prefix)
+
+	alice, bob := newTestClient("alice"), newTestClient("bob")
+	a.Register(alice)
+	b.Register(bob)
+	a.JoinGame(alice, "GAME01", "p1")
+	b.JoinGame(bob, "GAME01", "p2")
+
+	a.BroadcastToGame("GAME01", map[string]string{"type": "playerMoved"})
+	if msg := receive(t, alice); msg["type"] != "playerMoved" {
+		t.Errorf("Expected playerMoved on the publishing hub, got %v", msg["type"])
+	}
+	if msg := receive(t, bob); msg["type"] != "playerMoved" {
+		t.Errorf("Expected playerMoved on the other hub, got %v", msg["type"])
+	}
+
+	// Excluding a client only applies on the hub it belongs to
+	b.BroadcastToGameExcept("GAME01", "bob", map[string]string{"type": "playerLeft"})
+	if msg := receive(t, alice); msg["type"] != "playerLeft" {
+		t.Errorf("Expected playerLeft, got %v", msg["type"])
+	}
+	select {
+	case <-bob.Send:
+		t.Error("Excluded client should not receive the broadcast")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRedisBackplanePreservesOrder(t *testing.T) {
+	addr := redisAddr(t)
+	prefix := fmt.Sprintf("test%d:", time.Now().UnixNano())
+	a, b := newRedisHub(t, addr, prefix), newRedisHub(t, addr, prefix)
+
+	const n = 200
+	watcher := &Client{ID: "watcher", Send: make(chan []byte, n)}
+	b.Register(watcher)
+	b.JoinGame(watcher, "GAME01", "p1")
+
+	for i := 0; i < n; i++ {
+		a.BroadcastToGame("GAME01", map[string]int{"n": i})
+	}
+
+	for i := 0; i < n; i++ {
+		msg := receive(t, watcher)
+		if got := int(msg["n"].(float64)); got != i {
+			t.Fatalf("Expected message %d, got %d", i, got)
+		}
+	}
+}
+
+func TestLocalBackplaneSharesGamesAcrossHubs(t *testing.T) {
+	bp := NewLocalBackplane()
+	a, _ := NewHubWithBackplane(bp)
+	b, _ := NewHubWithBackplane(bp)
+
+	alice, bob := newTestClient("alice"), newTestClient("bob")
+	a.Register(alice)
+	b.Register(bob)
+	a.JoinGame(alice, "GAME01", "p1")
+	b.JoinGame(bob, "GAME01", "p2")
+
+	a.BroadcastToGameExcept("GAME01", "alice", map[string]string{"type": "playerJoined"})
+
+	if len(alice.Send) != 0 {
+		t.Error("Excluded client should not receive the broadcast")
+	}
+	if msg := receive(t, bob); msg["type"] != "playerJoined" {
+		t.Errorf("Expected playerJoined on the other hub, got %v", msg["type"])
+	}
+}
+
+func TestRedisBackplanePublishTimesOut(t *testing.T) {
+	defer func(io, reconnect time.Duration) {
+		redisIOTimeout, redisReconnectDelay = io, reconnect
+	}(redisIOTimeout, redisReconnectDelay)
+	redisIOTimeout, redisReconnectDelay = 50*time.Millisecond, time.Minute
+
+	// A server that answers the first PING and then stalls
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		readReply(r)
+		conn.Write([]byte("+PONG\r\n"))
+		for {
+			if _, err := readReply(r); err != nil {
+				return
+			}
+		}
+	}()
+
+	bp, err := NewRedisBackplane(ln.Addr().String(), "", "test:")
+	if err != nil {
+		t.Fatalf("NewRedisBackplane failed: %v", err)
+	}
+	defer bp.Close()
+
+	start := time.Now()
+	if err := bp.Publish(Broadcast{GameCode: "GAME01", Data: []byte("{}")}); err == nil {
+		t.Error("Expected publishing to a stalled server to fail")
+	}
+	if err := bp.Publish(Broadcast{GameCode: "GAME01", Data: []byte("{}")}); err == nil {
+		t.Error("Expected publishing to fail while the connection is down")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected publishes to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestLocalBackplanePublishesGamesIndependently(t *testing.T) {
+	bp := NewLocalBackplane()
+	if bp.gameLock("GAME01") == bp.gameLock("GAME02") {
+		t.Fatal("Test codes should use different locks")
+	}
+
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	bp.Subscribe(func(b Broadcast) {
+		if b.GameCode == "GAME01" {
+			close(blocked)
+			<-release
+		}
+	})
+	go bp.Publish(Broadcast{GameCode: "GAME01"})
+	<-blocked
+	defer close(release)
+
+	done := make(chan struct{})
+	go func() {
+		bp.Publish(Broadcast{GameCode: "GAME02"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("A slow delivery for one game should not hold up another")
+	}
+}
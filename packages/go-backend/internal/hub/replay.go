@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+)
+
+// DefaultReplayBufferSize is how many recent broadcasts the hub keeps per game
+// for clients resuming after a reconnect.
+const DefaultReplayBufferSize = 256
+
+// gameStream numbers a game's broadcasts and keeps the most recent ones.
+type gameStream struct {
+	seq uint64
+	// recent is a ring of the last broadcasts; recent[i] has seq
+	// seq-len(recent)+1+i once rotated by start.
+	recent [][]byte
+	start  int
+}
+
+// append records the next broadcast and returns it stamped with its seq.
+func (s *gameStream) append(data []byte, size int) []byte {
+	s.seq++
+	data = withSeq(data, s.seq)
+
+	if size <= 0 {
+		return data
+	}
+	if len(s.recent) < size {
+		s.recent = append(s.recent, data)
+	} else {
+		s.recent[s.start] = data
+		s.start = (s.start + 1) % len(s.recent)
+	}
+	return data
+}
+
+// since returns the broadcasts after lastSeq, or false if some of them are no
+// longer buffered or lastSeq is from the future.
+func (s *gameStream) since(lastSeq uint64) ([][]byte, bool) {
+	if lastSeq > s.seq {
+		return nil, false
+	}
+	missed := int(s.seq - lastSeq)
+	if missed > len(s.recent) {
+		return nil, false
+	}
+
+	out := make([][]byte, 0, missed)
+	for i := len(s.recent) - missed; i < len(s.recent); i++ {
+		out = append(out, s.recent[(s.start+i)%len(s.recent)])
+	}
+	return out, true
+}
+
+// withSeq adds a "seq" field to an encoded JSON object. Anything else is
+// returned unchanged.
+func withSeq(data []byte, seq uint64) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 24)
+	buf.WriteString(`{"seq":`)
+	buf.WriteString(strconv.FormatUint(seq, 10))
+	if !bytes.Equal(bytes.TrimSpace(data[1:]), []byte("}")) {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+	return buf.Bytes()
+}
+
+// SetReplayBufferSize sets how many broadcasts are kept per game. Zero
+// disables resuming.
+func (h *Hub) SetReplayBufferSize(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.replaySize = n
+}
+
+// Epoch identifies this hub's seqs. Another instance, or this one after a
+// restart, numbers broadcasts differently, so a client must send the epoch
+// its lastSeq came with to resume.
+func (h *Hub) Epoch() string {
+	return h.id
+}
+
+// GameSeq returns the seq of the last broadcast delivered for a game.
+func (h *Hub) GameSeq(gameCode string) uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if s, ok := h.streams[gameCode]; ok {
+		return s.seq
+	}
+	return 0
+}
+
+// Resume joins a client to a game and, if every broadcast after lastSeq is
+// still buffered, queues them to the client before any newer broadcast. It
+// returns the game's current seq and whether the gap was replayed; if not,
+// the caller should send a full snapshot instead. Seqs are this hub's own, so
+// a lastSeq from any epoch but Epoch's is never replayed (see Backplane).
+func (h *Hub) Resume(client *Client, gameCode, playerID, epoch string, lastSeq uint64) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.joinGameLocked(client, gameCode, playerID)
+
+	s, ok := h.streams[gameCode]
+	if epoch != h.id {
+		if !ok {
+			return 0, false
+		}
+		return s.seq, false
+	}
+	if !ok {
+		// Nothing has been broadcast here; only a client that saw nothing is up to date.
+		return 0, lastSeq == 0
+	}
+
+	missed, ok := s.since(lastSeq)
+	if !ok {
+		return s.seq, false
+	}
+	// Queued under the hub lock so no live broadcast can overtake them
+	for _, data := range missed {
+		out, err := client.encode(data)
+		if err != nil {
+			log.Printf("Error encoding message: %v", err)
+			continue
+		}
+		client.SafeSend(out)
+	}
+	return s.seq, true
+}
@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// This file implements the small part of the Redis protocol (RESP) the
+// backplane needs: sending commands and reading replies.
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// writeCommand writes a command as a RESP array of bulk strings and flushes it.
+func writeCommand(w *bufio.Writer, args ...string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return w.Flush()
+}
+
+// readReply reads one RESP value. Simple and bulk strings are returned as
+// string, integers as int64, arrays as []interface{} and a nil bulk string or
+// array as nil. Error replies are returned as a redisError value, not as err.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// readLine reads a CRLF-terminated line without the terminator.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
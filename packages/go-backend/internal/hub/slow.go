@@ -0,0 +1,248 @@
+package hub
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// SlowConsumerPolicy decides what happens to a client whose Send buffer is
+// full, i.e. one that is not reading messages as fast as they are produced.
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDisconnect closes the client with CloseSlowConsumer. The client
+	// reconnects and rejoins to get the current state.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyResync drops messages until the buffer has drained and then sends
+	// a full game state in their place.
+	PolicyResync SlowConsumerPolicy = "resync"
+	// PolicyCoalesce holds messages back until there is room, keeping only
+	// the latest message per coalesce key (for example the latest move of
+	// each player). If too many build up it falls back to a resync.
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+)
+
+// CloseSlowConsumer is the WebSocket close code sent to clients disconnected
+// by PolicyDisconnect.
+const CloseSlowConsumer = 4008
+
+// maxOverflow bounds how many coalesced messages a client may hold back.
+const maxOverflow = 256
+
+// ParseSlowConsumerPolicy validates a policy name from configuration.
+func ParseSlowConsumerPolicy(name string) (SlowConsumerPolicy, error) {
+	switch p := SlowConsumerPolicy(name); p {
+	case PolicyDisconnect, PolicyResync, PolicyCoalesce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", name)
+	}
+}
+
+// Coalescer is implemented by messages that a newer message with the same key
+// makes obsolete.
+type Coalescer interface {
+	CoalesceKey() string
+}
+
+// ClientCounters counts what happened to messages a client was too slow for.
+type ClientCounters struct {
+	// Dropped is the number of messages discarded.
+	Dropped uint64 `json:"dropped"`
+	// Coalesced is the number of messages replaced by a newer one.
+	Coalesced uint64 `json:"coalesced"`
+	// Resyncs is the number of times the client was flagged for a full resync.
+	Resyncs uint64 `json:"resyncs"`
+}
+
+// ClientStats describes a registered client for the admin API.
+type ClientStats struct {
+	ID       string             `json:"id"`
+	GameCode string             `json:"gameCode"`
+	PlayerID string             `json:"playerId"`
+	Policy   SlowConsumerPolicy `json:"policy"`
+	Queued   int                `json:"queued"`
+	Overflow int                `json:"overflow"`
+	Resync   bool               `json:"pendingResync"`
+	ClientCounters
+}
+
+// queuedMessage is a message held back by PolicyCoalesce.
+type queuedMessage struct {
+	key  string
+	data []byte
+}
+
+// send queues data for the client, applying the slow consumer policy if the
+// buffer is full. key is the message's coalesce key, if any.
+func (c *Client) send(data []byte, key string) bool {
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+		return false
+	}
+
+	// A full state is on its way, which supersedes this message.
+	if c.resync {
+		c.stats.Dropped++
+		c.mu.Unlock()
+		return false
+	}
+
+	// Held-back messages go first to keep the order.
+	if len(c.overflow) == 0 {
+		select {
+		case c.Send <- data:
+			c.mu.Unlock()
+			return true
+		default:
+		}
+	}
+
+	switch c.policy {
+	case PolicyCoalesce:
+		if c.coalesceLocked(data, key) {
+			c.mu.Unlock()
+			return true
+		}
+		c.startResyncLocked()
+		c.mu.Unlock()
+		return false
+
+	case PolicyDisconnect:
+		c.stats.Dropped++
+		c.mu.Unlock()
+		log.Printf("Client %s: disconnecting slow consumer", c.ID)
+		c.CloseWithReason(CloseSlowConsumer, "slow consumer")
+		return false
+
+	default:
+		c.startResyncLocked()
+		c.mu.Unlock()
+		return false
+	}
+}
+
+// coalesceLocked holds a message back, dropping an older one with the same
+// key. The new message always goes last so seqs stay in order. It reports
+// false if the overflow is full. Callers must hold mu.
+func (c *Client) coalesceLocked(data []byte, key string) bool {
+	if key != "" {
+		for i := range c.overflow {
+			if c.overflow[i].key == key {
+				c.overflow = append(c.overflow[:i], c.overflow[i+1:]...)
+				c.stats.Coalesced++
+				break
+			}
+		}
+	}
+	if len(c.overflow) >= maxOverflow {
+		return false
+	}
+	c.overflow = append(c.overflow, queuedMessage{key: key, data: data})
+	return true
+}
+
+// startResyncLocked drops held-back messages and flags the client for a full
+// resync. Callers must hold mu.
+func (c *Client) startResyncLocked() {
+	c.stats.Dropped += uint64(len(c.overflow)) + 1
+	c.stats.Resyncs++
+	c.overflow = nil
+	c.resync = true
+	log.Printf("Client %s: buffer full, scheduling resync", c.ID)
+}
+
+// Drain moves held-back messages into Send and, once they have all been
+// queued, completes a pending resync by queuing the message built by state.
+// The write pump calls it whenever Send is empty. state runs with the client
+// locked, so no broadcast can slip in between building and queuing it; it
+// must not call back into the hub, and may return nil if there is nothing to
+// resync to. state returns JSON, which is converted to the client's encoding.
+func (c *Client) Drain(state func() []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	for len(c.overflow) > 0 {
+		select {
+		case c.Send <- c.overflow[0].data:
+			c.overflow = c.overflow[1:]
+		default:
+			return
+		}
+	}
+	c.overflow = nil
+
+	if !c.resync {
+		return
+	}
+	c.resync = false
+	if state == nil {
+		return
+	}
+	if data := state(); data != nil {
+		data, err := c.encode(data)
+		if err != nil {
+			log.Printf("Client %s: error encoding resync state: %v", c.ID, err)
+			return
+		}
+		select {
+		case c.Send <- data:
+		default:
+			// Refilled while building the state; try again on the next drain.
+			c.resync = true
+		}
+	}
+}
+
+// Stats returns the client's slow consumer state and counters.
+func (c *Client) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientStats{
+		ID:             c.ID,
+		Policy:         c.policy,
+		Queued:         len(c.Send),
+		Overflow:       len(c.overflow),
+		Resync:         c.resync,
+		ClientCounters: c.stats,
+	}
+}
+
+// ClientStats returns stats for every registered client, those that dropped
+// the most messages first.
+func (h *Hub) ClientStats() []ClientStats {
+	type member struct {
+		client             *Client
+		gameCode, playerID string
+	}
+
+	h.mu.RLock()
+	members := make([]member, 0, len(h.clients))
+	for _, client := range h.clients {
+		members = append(members, member{client, client.GameCode, client.PlayerID})
+	}
+	h.mu.RUnlock()
+
+	// Client locks are taken without the hub lock held
+	stats := make([]ClientStats, len(members))
+	for i, m := range members {
+		stats[i] = m.client.Stats()
+		stats[i].GameCode = m.gameCode
+		stats[i].PlayerID = m.playerID
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Dropped != stats[j].Dropped {
+			return stats[i].Dropped > stats[j].Dropped
+		}
+		return stats[i].ID < stats[j].ID
+	})
+	return stats
+}
@@ -6,6 +6,32 @@ type ClientMessage struct {
 	GameCode string `json:"gameCode,omitempty"`
 	PlayerID string `json:"playerId,omitempty"`
 	Name     string `json:"playerName,omitempty"`
+	// RequestID, if set, is echoed on the reply or error to this message so
+	// the client can tell which request it answers.
+	RequestID string `json:"requestId,omitempty"`
+	// IdempotencyKey, if set on joinGame, rollDice or startGame, makes a
+	// retry with the same key get the first reply back instead of acting
+	// twice. Join keys are shared by everyone joining the game, so they
+	// should be random.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// LastSeq is the seq of the last message seen before reconnecting, sent
+	// with rejoinGame to resume instead of receiving a snapshot.
+	LastSeq *uint64 `json:"lastSeq,omitempty"`
+	// Epoch is the epoch of the welcome or resumed message LastSeq was
+	// counted from. Seqs from another epoch can't be resumed.
+	Epoch string `json:"epoch,omitempty"`
+	// Version is the state version of the players the client holds, sent
+	// with rejoinGame to receive a delta instead of the full player list.
+	Version *uint64 `json:"version,omitempty"`
+	// ProtocolVersion and Features are sent with hello: the protocol the
+	// client speaks and the features it would like.
+	ProtocolVersion int      `json:"protocolVersion,omitempty"`
+	Features        []string `json:"features,omitempty"`
+	// Text is the chat message sent with sendChat. mutePlayer and
+	// unmutePlayer take the player to (un)mute in PlayerID.
+	Text string `json:"text,omitempty"`
+	// Reaction is the ID in Reactions of the reaction sent with react.
+	Reaction string `json:"reaction,omitempty"`
 }
 
 // Client action types
@@ -15,4 +41,46 @@ const (
 	ActionRollDice   = "rollDice"
 	ActionStartGame  = "startGame"
 	ActionPing       = "ping"
+	ActionHello      = "hello"
+
+	ActionSendChat     = "sendChat"
+	ActionMutePlayer   = "mutePlayer"
+	ActionUnmutePlayer = "unmutePlayer"
+	ActionReact        = "react"
 )
+
+// Protocol versions a client can say hello with. Clients that never say
+// hello get the protocol as it was before the handshake, with every feature
+// their transport allows.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Features a client can ask for in hello.
+const (
+	// FeatureBinary is MessagePack in binary frames. It is only agreed on a
+	// WebSocket that negotiated the MessagePack subprotocol.
+	FeatureBinary = "binary"
+	// FeatureDeltas lets the server send players as a delta against the
+	// state version the client says it holds.
+	FeatureDeltas = "deltas"
+	// FeatureSequencing stamps broadcasts with their seq so the client can
+	// resume. Without it nothing is replayed or resent.
+	FeatureSequencing = "sequencing"
+)
+
+// Reactions is the catalogue of reactions and taunts a player can send with
+// react, as emoji by ID.
+var Reactions = map[string]string{
+	"party":   "🎉",
+	"laugh":   "😂",
+	"fire":    "🔥",
+	"clap":    "👏",
+	"wave":    "👋",
+	"cry":     "😭",
+	"tooSlow": "🐌",
+	"snake":   "🐍",
+	"ladder":  "🪜",
+	"dice":    "🎲",
+}
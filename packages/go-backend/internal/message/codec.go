@@ -0,0 +1,60 @@
+package message
+
+import "encoding/json"
+
+// WebSocket subprotocols naming the wire encodings. A client offers the ones
+// it understands in Sec-WebSocket-Protocol; without one it gets JSON.
+const (
+	SubprotocolJSON    = "snakes.json"
+	SubprotocolMsgpack = "snakes.msgpack"
+)
+
+// Codec is a wire encoding for messages.
+type Codec interface {
+	// Name is the subprotocol that selects the codec.
+	Name() string
+	// Binary reports whether encoded messages go in binary frames.
+	Binary() bool
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// FromJSON converts a JSON-encoded message, as passed around the hub.
+	FromJSON(data []byte) ([]byte, error)
+}
+
+var (
+	// JSON is the default encoding.
+	JSON Codec = jsonCodec{}
+	// Msgpack encodes messages as MessagePack maps with the JSON field names.
+	Msgpack Codec = msgpackCodec{}
+)
+
+// Subprotocols lists the subprotocols the server accepts, most preferred
+// first.
+func Subprotocols() []string {
+	return []string{SubprotocolMsgpack, SubprotocolJSON}
+}
+
+// CodecFor returns the codec for a negotiated subprotocol, or JSON if there
+// was none.
+func CodecFor(subprotocol string) Codec {
+	if subprotocol == SubprotocolMsgpack {
+		return Msgpack
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return SubprotocolJSON }
+func (jsonCodec) Binary() bool                               { return false }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) FromJSON(data []byte) ([]byte, error)       { return data, nil }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                               { return SubprotocolMsgpack }
+func (msgpackCodec) Binary() bool                               { return true }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return MarshalMsgpack(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return UnmarshalMsgpack(data, v) }
+func (msgpackCodec) FromJSON(data []byte) ([]byte, error)       { return MsgpackFromJSON(data) }
@@ -0,0 +1,72 @@
+package message
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// benchMessages are the payloads that dominate traffic in a large game: a
+// move goes to every player on every roll, and a snapshot lists them all.
+var benchMessages = []struct {
+	name string
+	msg  interface{}
+}{
+	{"playerMoved", sampleMessages["playerMoved"]},
+	{"gameState300", GameStateMessage{
+		Type: TypeGameState, Game: sampleGame(), Players: samplePlayers(300), Seq: 12345,
+	}},
+}
+
+// BenchmarkEncode compares encoding each message as JSON and as MessagePack,
+// reporting the encoded size.
+func BenchmarkEncode(b *testing.B) {
+	for _, bm := range benchMessages {
+		for _, codec := range []Codec{JSON, Msgpack} {
+			b.Run(bm.name+"/"+codec.Name(), func(b *testing.B) {
+				data, _ := codec.Marshal(bm.msg)
+				b.ReportAllocs()
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					codec.Marshal(bm.msg)
+				}
+				b.ReportMetric(float64(len(data)), "bytes/msg")
+			})
+		}
+	}
+}
+
+// BenchmarkDecode compares decoding each message.
+func BenchmarkDecode(b *testing.B) {
+	for _, bm := range benchMessages {
+		for _, codec := range []Codec{JSON, Msgpack} {
+			b.Run(bm.name+"/"+codec.Name(), func(b *testing.B) {
+				data, _ := codec.Marshal(bm.msg)
+				typ := reflect.TypeOf(bm.msg)
+				b.ReportAllocs()
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					codec.Unmarshal(data, reflect.New(typ).Interface())
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkFromJSON measures converting a broadcast, which the hub does once
+// per broadcast for all MessagePack clients.
+func BenchmarkFromJSON(b *testing.B) {
+	for _, bm := range benchMessages {
+		b.Run(bm.name, func(b *testing.B) {
+			data, _ := json.Marshal(bm.msg)
+			b.ReportAllocs()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				MsgpackFromJSON(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func samplePlayers(n int) []PlayerInfo {
+	players := make([]PlayerInfo, n)
+	for i := range players {
+		players[i] = PlayerInfo{
+			ID:          "player-" + string(rune('a'+i%26)),
+			GameCode:    "ABC123",
+			Name:        "Player",
+			Color:       "#FF6B6B",
+			Position:    i % 101,
+			IsConnected: i%2 == 0,
+			JoinedAt:    "2026-10-18T12:00:00Z",
+		}
+	}
+	return players
+}
+
+func sampleGame() GameInfo {
+	return GameInfo{
+		Code:      "ABC123",
+		Status:    "playing",
+		CreatorID: "player-a",
+		Board: BoardInfo{
+			Size: 100,
+			SnakesAndLadders: []SnakeLadderInfo{
+				{Start: 16, End: 6, Type: "snake"},
+				{Start: 4, End: 14, Type: "ladder"},
+			},
+		},
+		CreatedAt: "2026-10-18T12:00:00Z",
+		UpdatedAt: "2026-10-18T12:05:00Z",
+	}
+}
+
+// sampleMessages has one of each message, with the field values that are
+// easiest to get wrong.
+var sampleMessages = map[string]interface{}{
+	"joinedGame": JoinedGameMessage{
+		Type: TypeJoinedGame, PlayerID: "player-a", Game: sampleGame(), Players: samplePlayers(3), Seq: 70000,
+	},
+	"playerJoined": PlayerJoinedMessage{Type: TypePlayerJoined, Player: samplePlayers(1)[0]},
+	"playerLeft":   PlayerLeftMessage{Type: TypePlayerLeft, PlayerID: "player-a", PlayerName: "Alice"},
+	"playerMoved": PlayerMovedMessage{
+		Type: TypePlayerMoved, PlayerID: "player-a", PlayerName: "Alice",
+		DiceRoll: 6, PreviousPosition: 10, NewPosition: 16,
+		Effect: &MoveEffect{Type: "snake", From: 16, To: 6},
+	},
+	"playerMovedNoEffect": PlayerMovedMessage{
+		Type: TypePlayerMoved, PlayerID: "player-a", PlayerName: "Alice", DiceRoll: 1, NewPosition: 1,
+	},
+	"movesBatch": MovesBatchMessage{
+		Type: TypeMovesBatch, Version: 42,
+		Moves: []PlayerMovedMessage{
+			{Type: TypePlayerMoved, PlayerID: "player-a", PlayerName: "Alice", DiceRoll: 3, NewPosition: 4, Version: 41},
+			{Type: TypePlayerMoved, PlayerID: "player-b", PlayerName: "Bob", DiceRoll: 2, NewPosition: 3, Version: 42},
+		},
+	},
+	"gameStarted": GameStartedMessage{Type: TypeGameStarted, Game: sampleGame(), FirstPlayerID: "player-a"},
+	"gameEnded":   GameEndedMessage{Type: TypeGameEnded, WinnerID: "player-a", WinnerName: "Alice"},
+	"gameState": GameStateMessage{
+		Type: TypeGameState, Game: sampleGame(), Players: samplePlayers(20), Seq: math.MaxUint32 + 1,
+	},
+	"error":            NewErrorMessage(ErrGameNotFound, "Game not found"),
+	"serverRestarting": ServerRestartingMessage{Type: TypeServerRestarting, ReconnectDelayMs: 1000},
+	"gameExpired":      GameExpiredMessage{Type: TypeGameExpired, GameCode: "ABC123", Status: "abandoned"},
+	"resumed":          ResumedMessage{Type: TypeResumed, GameCode: "ABC123", PlayerID: "player-a", LastSeq: 3, Seq: 9},
+	"pong":             NewPongMessage(),
+	"welcome": WelcomeMessage{
+		Type: TypeWelcome, ProtocolVersion: ProtocolVersion, Features: []string{FeatureDeltas, FeatureSequencing},
+	},
+	"hello": ClientMessage{
+		Action: ActionHello, ProtocolVersion: ProtocolVersion, Features: []string{FeatureBinary, FeatureDeltas},
+	},
+	"clientMessage": ClientMessage{
+		Action: ActionRejoinGame, GameCode: "ABC123", PlayerID: "player-a", LastSeq: new(uint64),
+	},
+}
+
+// --- Round-trip tests ---
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSON, Msgpack} {
+		for name, msg := range sampleMessages {
+			t.Run(codec.Name()+"/"+name, func(t *testing.T) {
+				data, err := codec.Marshal(msg)
+				if err != nil {
+					t.Fatalf("Marshal failed: %v", err)
+				}
+
+				decoded := reflect.New(reflect.TypeOf(msg))
+				if err := codec.Unmarshal(data, decoded.Interface()); err != nil {
+					t.Fatalf("Unmarshal failed: %v", err)
+				}
+				if got := decoded.Elem().Interface(); !reflect.DeepEqual(got, msg) {
+					t.Errorf("Round trip changed the message:\nwant %+v\ngot  %+v", msg, got)
+				}
+			})
+		}
+	}
+}
+
+func TestMsgpackFromJSONMatchesMarshal(t *testing.T) {
+	for name, msg := range sampleMessages {
+		t.Run(name, func(t *testing.T) {
+			direct, err := MarshalMsgpack(msg)
+			if err != nil {
+				t.Fatalf("MarshalMsgpack failed: %v", err)
+			}
+			jsonData, _ := json.Marshal(msg)
+			converted, err := MsgpackFromJSON(jsonData)
+			if err != nil {
+				t.Fatalf("MsgpackFromJSON failed: %v", err)
+			}
+			if !bytes.Equal(direct, converted) {
+				t.Errorf("Encodings differ:\ndirect    %x\nconverted %x", direct, converted)
+			}
+		})
+	}
+}
+
+func TestMsgpackSmallerThanJSON(t *testing.T) {
+	for name, msg := range sampleMessages {
+		jsonData, _ := json.Marshal(msg)
+		packed, _ := MarshalMsgpack(msg)
+		if len(packed) >= len(jsonData) {
+			t.Errorf("%s: expected MessagePack (%d bytes) to be smaller than JSON (%d bytes)", name, len(packed), len(jsonData))
+		}
+	}
+}
+
+// --- Encoding tests ---
+
+func TestMsgpackIntegers(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0xcc, 0x80}},
+		{256, []byte{0xcd, 0x01, 0x00}},
+		{70000, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{-1, []byte{0xff}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{-200, []byte{0xd1, 0xff, 0x38}},
+		{math.MinInt64, []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		data, _ := MarshalMsgpack(tt.value)
+		if !bytes.Equal(data, tt.want) {
+			t.Errorf("%d: expected %x, got %x", tt.value, tt.want, data)
+		}
+
+		var got int64
+		if err := UnmarshalMsgpack(data, &got); err != nil || got != tt.value {
+			t.Errorf("%d: decoded %d (%v)", tt.value, got, err)
+		}
+	}
+}
+
+func TestMsgpackFromJSONKeepsSeqFirst(t *testing.T) {
+	data, err := MsgpackFromJSON([]byte(`{"seq":300,"type":"pong"}`))
+	if err != nil {
+		t.Fatalf("MsgpackFromJSON failed: %v", err)
+	}
+
+	want := []byte{0x82, 0xa3, 's', 'e', 'q', 0xcd, 0x01, 0x2c, 0xa4, 't', 'y', 'p', 'e', 0xa4, 'p', 'o', 'n', 'g'}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Expected %x, got %x", want, data)
+	}
+}
+
+func TestMsgpackUnmarshalClientMessage(t *testing.T) {
+	// What a client library would send for a map literal
+	data, _ := MarshalMsgpack(map[string]interface{}{
+		"action":     ActionJoinGame,
+		"gameCode":   "ABC123",
+		"playerName": "Bob",
+		"extra":      []interface{}{1, "two", nil},
+	})
+
+	var msg ClientMessage
+	if err := UnmarshalMsgpack(data, &msg); err != nil {
+		t.Fatalf("UnmarshalMsgpack failed: %v", err)
+	}
+	if msg.Action != ActionJoinGame || msg.GameCode != "ABC123" || msg.Name != "Bob" {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+}
+
+func TestMsgpackUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated string", []byte{0x81, 0xa6, 'a', 'c'}},
+		{"truncated length", []byte{0xdb, 0xff}},
+		{"wrong type", []byte{0x81, 0xa6, 'a', 'c', 't', 'i', 'o', 'n', 0x01}},
+		{"not a map", []byte{0x93, 0x01, 0x02, 0x03}},
+		{"trailing data", []byte{0x80, 0x80}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg ClientMessage
+			if err := UnmarshalMsgpack(tt.data, &msg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// --- Negotiation tests ---
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        Codec
+	}{
+		{"", JSON},
+		{SubprotocolJSON, JSON},
+		{SubprotocolMsgpack, Msgpack},
+		{"something-else", JSON},
+	}
+
+	for _, tt := range tests {
+		if got := CodecFor(tt.subprotocol); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.subprotocol, tt.want.Name(), got.Name())
+		}
+	}
+}
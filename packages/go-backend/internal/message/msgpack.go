@@ -0,0 +1,933 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MessagePack encoding of the message types.
+//
+// Messages are encoded as the same objects they are in JSON: structs become
+// maps keyed by their json field names, honouring omitempty, so a client can
+// decode either format into the same model. Integers use the smallest
+// encoding that holds them, and whole floats are written as integers, as JSON
+// can't tell them apart either.
+
+// ErrMsgpackTruncated is returned when MessagePack data ends mid-value.
+var ErrMsgpackTruncated = errors.New("msgpack: unexpected end of data")
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// MarshalMsgpack returns the MessagePack encoding of v.
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{buf: make([]byte, 0, 128)}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// MsgpackFromJSON converts a JSON document to MessagePack, keeping the order
+// of object members. The result is the same as encoding the value the JSON
+// was produced from.
+func MsgpackFromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	e := &msgpackEncoder{buf: make([]byte, 0, len(data))}
+	if err := e.transcode(dec); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("msgpack: trailing data after JSON value")
+	}
+	return e.buf, nil
+}
+
+// UnmarshalMsgpack decodes MessagePack data into v, which must be a non-nil
+// pointer. Map keys are matched to struct fields the way encoding/json does;
+// unknown keys are ignored.
+func UnmarshalMsgpack(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("msgpack: Unmarshal needs a non-nil pointer")
+	}
+
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("msgpack: trailing data after value")
+	}
+	return nil
+}
+
+// --- Encoding ---
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.writeNil()
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		e.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.writeFloat(v.Float())
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		if v.Type() == rawMessageType {
+			return e.transcode(json.NewDecoder(bytes.NewReader(v.Bytes())))
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeBinary(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v)
+	case reflect.Array:
+		return e.encodeArray(v)
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeArray(v reflect.Value) error {
+	e.writeArrayHeader(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeMap(v reflect.Value) error {
+	if v.IsNil() {
+		e.writeNil()
+		return nil
+	}
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("msgpack: unsupported map key type %s", v.Type().Key())
+	}
+
+	// Sorted like encoding/json, so both encodings agree
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	e.writeMapHeader(len(keys))
+	for _, k := range keys {
+		e.writeString(k.String())
+		if err := e.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeStruct(v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	n := 0
+	for _, f := range fields {
+		if fv, ok := fieldByIndex(v, f.index); ok && !(f.omitEmpty && isEmptyValue(fv)) {
+			n++
+		}
+	}
+
+	e.writeMapHeader(n)
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		e.writeString(f.name)
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transcode reads one JSON value from dec and encodes it.
+func (e *msgpackEncoder) transcode(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("msgpack: invalid JSON: %w", err)
+	}
+
+	switch t := tok.(type) {
+	case nil:
+		e.writeNil()
+	case bool:
+		e.writeBool(t)
+	case string:
+		e.writeString(t)
+	case json.Number:
+		return e.writeNumber(t)
+	case json.Delim:
+		switch t {
+		case '{':
+			return e.transcodeContainer(dec, true)
+		case '[':
+			return e.transcodeContainer(dec, false)
+		}
+		return fmt.Errorf("msgpack: unexpected %q in JSON", rune(t))
+	}
+	return nil
+}
+
+// transcodeContainer encodes the members of a JSON object or array. The
+// header's size isn't known until the end, so room for the largest header is
+// left and the members are moved up once it is written.
+func (e *msgpackEncoder) transcodeContainer(dec *json.Decoder, object bool) error {
+	const reserved = 5
+	start := len(e.buf)
+	e.buf = append(e.buf, make([]byte, reserved)...)
+
+	n := 0
+	for dec.More() {
+		if object {
+			key, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("msgpack: invalid JSON: %w", err)
+			}
+			e.writeString(key.(string))
+		}
+		if err := e.transcode(dec); err != nil {
+			return err
+		}
+		n++
+	}
+	// The closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("msgpack: invalid JSON: %w", err)
+	}
+
+	body := e.buf[start+reserved:]
+	header := &msgpackEncoder{buf: make([]byte, 0, reserved)}
+	if object {
+		header.writeMapHeader(n)
+	} else {
+		header.writeArrayHeader(n)
+	}
+	copy(e.buf[start:], header.buf)
+	copy(e.buf[start+len(header.buf):], body)
+	e.buf = e.buf[:start+len(header.buf)+len(body)]
+	return nil
+}
+
+func (e *msgpackEncoder) writeNumber(n json.Number) error {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			e.writeInt(i)
+			return nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			e.writeUint(u)
+			return nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("msgpack: invalid JSON number %s", s)
+	}
+	e.writeFloat(f)
+	return nil
+}
+
+func (e *msgpackEncoder) writeNil() {
+	e.buf = append(e.buf, 0xc0)
+}
+
+func (e *msgpackEncoder) writeBool(b bool) {
+	if b {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+}
+
+func (e *msgpackEncoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(i))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(i))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(i))
+	}
+}
+
+func (e *msgpackEncoder) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), u)
+	}
+}
+
+func (e *msgpackEncoder) writeFloat(f float64) {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		e.writeInt(int64(f))
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(f))
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xda), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdb), uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) writeBinary(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xc5), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xc6), uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) writeArrayHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xdc), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdd), uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) writeMapHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xde), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdf), uint32(n))
+	}
+}
+
+// --- Decoding ---
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	b, err := d.peek()
+	if err != nil {
+		return err
+	}
+
+	if b == 0xc0 {
+		d.pos++
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: cannot decode into %s", v.Type())
+		}
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch {
+	case b == 0xc2 || b == 0xc3:
+		d.pos++
+		if v.Kind() != reflect.Bool {
+			return typeError("bool", v)
+		}
+		v.SetBool(b == 0xc3)
+		return nil
+	case isMsgpackString(b):
+		s, err := d.readString()
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.String {
+			return typeError("string", v)
+		}
+		v.SetString(s)
+		return nil
+	case b >= 0xc4 && b <= 0xc6:
+		raw, err := d.readBinary()
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return typeError("binary", v)
+		}
+		v.SetBytes(append([]byte(nil), raw...))
+		return nil
+	case isMsgpackArray(b):
+		return d.decodeArray(v)
+	case isMsgpackMap(b):
+		return d.decodeMap(v)
+	}
+
+	x, err := d.decodeAny()
+	if err != nil {
+		return err
+	}
+	return setNumber(v, x)
+}
+
+func (d *msgpackDecoder) decodeArray(v reflect.Value) error {
+	n, err := d.readArrayHeader()
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type() == rawMessageType {
+			return typeError("array", v)
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeError("array", v)
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(v reflect.Value) error {
+	n, err := d.readMapHeader()
+	if err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return typeError("map", v)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		}
+		for i := 0; i < n; i++ {
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			f := fields.lookup(key)
+			if f == nil {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(fieldByIndexAlloc(v, f.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeError("map", v)
+	}
+	return nil
+}
+
+// decodeAny decodes a value into the types encoding/json uses for
+// interface{}, except that integers are int64, or uint64 if too large.
+func (d *msgpackDecoder) decodeAny() (interface{}, error) {
+	b, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		d.pos++
+		return int64(b), nil
+	case b >= 0xe0:
+		d.pos++
+		return int64(int8(b)), nil
+	case isMsgpackString(b):
+		return d.readString()
+	case isMsgpackArray(b):
+		n, err := d.readArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			if out[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case isMsgpackMap(b):
+		n, err := d.readMapHeader()
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if out[key], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	d.pos++
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		d.pos--
+		raw, err := d.readBinary()
+		return append([]byte(nil), raw...), err
+	case 0xca:
+		p, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p))), nil
+	case 0xcb:
+		p, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		p, err := d.read(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		u := readBigEndian(p)
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		p, err := d.read(1 << (b - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		u := readBigEndian(p)
+		// Sign-extend from the encoded width
+		shift := 64 - 8*uint(len(p))
+		return int64(u<<shift) >> shift, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type byte 0x%02x", b)
+}
+
+func (d *msgpackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, ErrMsgpackTruncated
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, ErrMsgpackTruncated
+	}
+	p := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+// readLength reads a header byte and, for the non-fixed forms, a length of
+// the given width.
+func (d *msgpackDecoder) readLength(width int) (int, error) {
+	d.pos++
+	p, err := d.read(width)
+	if err != nil {
+		return 0, err
+	}
+	n := readBigEndian(p)
+	if n > uint64(len(d.data)) {
+		return 0, ErrMsgpackTruncated
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) readString() (string, error) {
+	b, err := d.peek()
+	if err != nil {
+		return "", err
+	}
+
+	var n int
+	switch {
+	case b&0xe0 == 0xa0:
+		d.pos++
+		n = int(b & 0x1f)
+	case b == 0xd9:
+		n, err = d.readLength(1)
+	case b == 0xda:
+		n, err = d.readLength(2)
+	case b == 0xdb:
+		n, err = d.readLength(4)
+	default:
+		return "", fmt.Errorf("msgpack: expected a string, got type byte 0x%02x", b)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	p, err := d.read(n)
+	return string(p), err
+}
+
+func (d *msgpackDecoder) readBinary() ([]byte, error) {
+	b, _ := d.peek()
+	n, err := d.readLength(1 << (b - 0xc4))
+	if err != nil {
+		return nil, err
+	}
+	return d.read(n)
+}
+
+func (d *msgpackDecoder) readArrayHeader() (int, error) {
+	b, _ := d.peek()
+	switch b {
+	case 0xdc:
+		return d.readLength(2)
+	case 0xdd:
+		return d.readLength(4)
+	}
+	d.pos++
+	return int(b & 0x0f), nil
+}
+
+func (d *msgpackDecoder) readMapHeader() (int, error) {
+	b, _ := d.peek()
+	switch b {
+	case 0xde:
+		return d.readLength(2)
+	case 0xdf:
+		return d.readLength(4)
+	}
+	d.pos++
+	return int(b & 0x0f), nil
+}
+
+func isMsgpackString(b byte) bool {
+	return b&0xe0 == 0xa0 || (b >= 0xd9 && b <= 0xdb)
+}
+
+func isMsgpackArray(b byte) bool {
+	return b&0xf0 == 0x90 || b == 0xdc || b == 0xdd
+}
+
+func isMsgpackMap(b byte) bool {
+	return b&0xf0 == 0x80 || b == 0xde || b == 0xdf
+}
+
+func readBigEndian(p []byte) uint64 {
+	var u uint64
+	for _, b := range p {
+		u = u<<8 | uint64(b)
+	}
+	return u
+}
+
+// setNumber stores a decoded number in v, checking it fits.
+func setNumber(v reflect.Value, x interface{}) error {
+	var f float64
+	switch n := x.(type) {
+	case int64:
+		f = float64(n)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(n) {
+				return overflowError(x, v)
+			}
+			v.SetInt(n)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n < 0 || v.OverflowUint(uint64(n)) {
+				return overflowError(x, v)
+			}
+			v.SetUint(uint64(n))
+			return nil
+		}
+	case uint64:
+		f = float64(n)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n > math.MaxInt64 || v.OverflowInt(int64(n)) {
+				return overflowError(x, v)
+			}
+			v.SetInt(int64(n))
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.OverflowUint(n) {
+				return overflowError(x, v)
+			}
+			v.SetUint(n)
+			return nil
+		}
+	case float64:
+		f = n
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return typeError("float", v)
+		}
+	default:
+		return fmt.Errorf("msgpack: cannot decode %T into %s", x, v.Type())
+	}
+
+	if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+		return typeError("number", v)
+	}
+	v.SetFloat(f)
+	return nil
+}
+
+func typeError(what string, v reflect.Value) error {
+	return fmt.Errorf("msgpack: cannot decode %s into %s", what, v.Type())
+}
+
+func overflowError(x interface{}, v reflect.Value) error {
+	return fmt.Errorf("msgpack: %v overflows %s", x, v.Type())
+}
+
+// --- Struct fields ---
+
+// msgpackField is a struct field and the name it is encoded under.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+type msgpackFields []msgpackField
+
+// lookup finds the field for a key, preferring an exact match like
+// encoding/json.
+func (fs msgpackFields) lookup(key string) *msgpackField {
+	for i := range fs {
+		if fs[i].name == key {
+			return &fs[i]
+		}
+	}
+	for i := range fs {
+		if strings.EqualFold(fs[i].name, key) {
+			return &fs[i]
+		}
+	}
+	return nil
+}
+
+var fieldCache sync.Map // reflect.Type -> msgpackFields
+
+// structFields returns the encoded fields of a struct type, following the
+// json tags. Untagged embedded structs have their fields promoted.
+func structFields(t reflect.Type) msgpackFields {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.(msgpackFields)
+	}
+
+	var fields msgpackFields
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, f := range structFields(ft) {
+					f.index = append([]int{i}, f.index...)
+					fields = append(fields, f)
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// fieldByIndex returns a nested field, or false if it is behind a nil
+// embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc returns a nested field for decoding into, allocating
+// nil embedded pointers on the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
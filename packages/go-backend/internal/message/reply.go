@@ -0,0 +1,54 @@
+package message
+
+// Reply is a message sent back to the client whose request it answers. Every
+// reply echoes the request's requestId, so a message can only be sent as a
+// reply if it can carry one.
+type Reply interface {
+	// WithRequestID returns a copy of the reply stamped with a requestId.
+	WithRequestID(id string) Reply
+}
+
+func (m JoinedGameMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m ResumedMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m PlayerMovedMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m GameStartedMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m ChatMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m PlayerMutedMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m ErrorMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m PongMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
+
+func (m WelcomeMessage) WithRequestID(id string) Reply {
+	m.RequestID = id
+	return m
+}
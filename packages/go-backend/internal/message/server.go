@@ -14,6 +14,16 @@ const (
 	TypeGameState    = "gameState"
 	TypeError        = "error"
 	TypePong         = "pong"
+
+	TypeServerRestarting = "serverRestarting"
+	TypeGameExpired      = "gameExpired"
+	TypeResumed          = "resumed"
+	TypeMovesBatch       = "movesBatch"
+	TypeWelcome          = "welcome"
+	TypeChatMessage      = "chatMessage"
+	TypePlayerMuted      = "playerMuted"
+	TypeReaction         = "reaction"
+	TypeSessionReplaced  = "sessionReplaced"
 )
 
 // Error codes
@@ -26,20 +36,51 @@ const (
 	ErrPlayerNotFound     = "PLAYER_NOT_FOUND"
 	ErrInvalidMessage     = "INVALID_MESSAGE"
 	ErrInternalError      = "INTERNAL_ERROR"
+	ErrUnsupportedVersion = "UNSUPPORTED_VERSION"
+	ErrPlayerMuted        = "PLAYER_MUTED"
+	ErrRateLimited        = "RATE_LIMITED"
+	ErrChatRejected       = "CHAT_REJECTED"
 )
 
 // JoinedGameMessage is sent to a player when they successfully join a game.
+// It carries either the full player list or, for a client that rejoined with
+// the state version it holds, a Delta against that version.
 type JoinedGameMessage struct {
 	Type     string        `json:"type"`
 	PlayerID string        `json:"playerId"`
 	Game     GameInfo      `json:"game"`
-	Players  []PlayerInfo  `json:"players"`
+	Players  []PlayerInfo  `json:"players,omitempty"`
+	Delta    *GameDelta    `json:"delta,omitempty"`
+	// Version is the state version of Players or the result of Delta.
+	Version  uint64        `json:"version"`
+	// Seq is the game's seq when the snapshot was taken.
+	Seq      uint64        `json:"seq"`
+	// Chat is the game's recent chat, oldest first.
+	Chat []ChatMessage `json:"chat,omitempty"`
+	// RequestID echoes the requestId of the message this replies to, as on
+	// the other replies. Broadcasts never carry one.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// GameDelta is how the players changed since a state version the client
+// holds. Entries are current values, so they can be applied over changes the
+// client has already seen.
+type GameDelta struct {
+	FromVersion uint64          `json:"fromVersion"`
+	// Added are players who joined since FromVersion.
+	Added       []PlayerInfo    `json:"added,omitempty"`
+	// Positions and Connected are by player ID.
+	Positions   map[string]int  `json:"positions,omitempty"`
+	Connected   map[string]bool `json:"connected,omitempty"`
 }
 
 // PlayerJoinedMessage is broadcast when a new player joins.
 type PlayerJoinedMessage struct {
 	Type   string     `json:"type"`
 	Player PlayerInfo `json:"player"`
+	// Version is the state version after the change, as are the Version
+	// fields of the other broadcasts.
+	Version uint64 `json:"version"`
 }
 
 // PlayerLeftMessage is broadcast when a player disconnects.
@@ -47,6 +88,7 @@ type PlayerLeftMessage struct {
 	Type       string `json:"type"`
 	PlayerID   string `json:"playerId"`
 	PlayerName string `json:"playerName"`
+	Version    uint64 `json:"version"`
 }
 
 // PlayerMovedMessage is broadcast when a player moves.
@@ -59,6 +101,53 @@ type PlayerMovedMessage struct {
 	PreviousPosition int         `json:"previousPosition"`
 	NewPosition      int         `json:"newPosition"`
 	Effect           *MoveEffect `json:"effect"`
+	Version          uint64      `json:"version"`
+	RequestID        string      `json:"requestId,omitempty"`
+}
+
+// CoalesceKey lets a slow client keep only each player's latest move.
+func (m PlayerMovedMessage) CoalesceKey() string {
+	return TypePlayerMoved + ":" + m.PlayerID
+}
+
+// MovesBatchMessage is broadcast in place of the playerMoved messages of a
+// game whose moves are flushed on an interval. It goes to every client, the
+// players who rolled included, so it repeats moves they already got as the
+// replies to their rolls. Clients skip moves whose version they already hold.
+type MovesBatchMessage struct {
+	Type  string               `json:"type"`
+	Moves []PlayerMovedMessage `json:"moves"`
+	// Version is the version of the last move.
+	Version uint64 `json:"version"`
+}
+
+// ChatMessage is broadcast when a player chats, and is the reply to the
+// player who sent it.
+type ChatMessage struct {
+	Type       string `json:"type"`
+	PlayerID   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Text       string `json:"text"`
+	SentAt     string `json:"sentAt"`
+	RequestID  string `json:"requestId,omitempty"`
+}
+
+// PlayerMutedMessage is broadcast when the game's creator mutes or unmutes a
+// player, and is the reply to the creator.
+type PlayerMutedMessage struct {
+	Type      string `json:"type"`
+	PlayerID  string `json:"playerId"`
+	Muted     bool   `json:"muted"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ReactionMessage is broadcast at the end of each window in which players in
+// a game sent a reaction, with how many of them did.
+type ReactionMessage struct {
+	Type     string `json:"type"`
+	Reaction string `json:"reaction"`
+	Emoji    string `json:"emoji"`
+	Count    int    `json:"count"`
 }
 
 // MoveEffect represents a snake or ladder effect.
@@ -73,6 +162,8 @@ type GameStartedMessage struct {
 	Type         string `json:"type"`
 	Game         GameInfo `json:"game"`
 	FirstPlayerID string `json:"firstPlayerId"`
+	Version      uint64   `json:"version"`
+	RequestID    string   `json:"requestId,omitempty"`
 }
 
 // GameEndedMessage is broadcast when the game ends.
@@ -80,26 +171,68 @@ type GameEndedMessage struct {
 	Type       string `json:"type"`
 	WinnerID   string `json:"winnerId"`
 	WinnerName string `json:"winnerName"`
+	Version    uint64 `json:"version"`
 }
 
-// GameStateMessage is sent when a player rejoins to sync state.
+// GameStateMessage is sent when a player rejoins to sync state. Like
+// JoinedGameMessage it has either Players or a Delta.
 type GameStateMessage struct {
 	Type          string       `json:"type"`
 	Game          GameInfo     `json:"game"`
-	Players       []PlayerInfo `json:"players"`
+	Players       []PlayerInfo `json:"players,omitempty"`
+	Delta         *GameDelta   `json:"delta,omitempty"`
 	CurrentTurnID string       `json:"currentTurnId,omitempty"`
+	Version       uint64       `json:"version"`
+	Seq           uint64       `json:"seq,omitempty"`
 }
 
 // ErrorMessage is sent when an error occurs.
 type ErrorMessage struct {
-	Type    string `json:"type"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Type      string `json:"type"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	// RetryAfterMs is how long to wait before trying again, for RATE_LIMITED.
+	RetryAfterMs int `json:"retryAfterMs,omitempty"`
+}
+
+// ServerRestartingMessage is sent to every client before the server shuts down.
+type ServerRestartingMessage struct {
+	Type             string `json:"type"`
+	ReconnectDelayMs int    `json:"reconnectDelayMs"`
+}
+
+// GameExpiredMessage is sent to every client in a game before an idle game is removed.
+type GameExpiredMessage struct {
+	Type     string `json:"type"`
+	GameCode string `json:"gameCode"`
+	Status   string `json:"status"`
+}
+
+// SessionReplacedMessage is sent to a player's older session, e.g. another
+// tab, before it is closed because the player joined again elsewhere.
+type SessionReplacedMessage struct {
+	Type     string `json:"type"`
+	GameCode string `json:"gameCode"`
+	PlayerID string `json:"playerId"`
+}
+
+// ResumedMessage follows the messages replayed to a client that rejoined with
+// lastSeq, marking that it has caught up to Seq in Epoch.
+type ResumedMessage struct {
+	Type     string `json:"type"`
+	GameCode string `json:"gameCode"`
+	PlayerID string `json:"playerId"`
+	LastSeq  uint64 `json:"lastSeq"`
+	Seq      uint64 `json:"seq"`
+	Epoch    string `json:"epoch"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // PongMessage is sent in response to a ping.
 type PongMessage struct {
-	Type string `json:"type"`
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // GameInfo represents game state sent to clients.
@@ -146,6 +279,18 @@ func NewErrorMessage(code, message string) ErrorMessage {
 	}
 }
 
+// WelcomeMessage is the reply to hello.
+type WelcomeMessage struct {
+	Type            string `json:"type"`
+	ProtocolVersion int    `json:"protocolVersion"`
+	// Features are the requested features the server agreed to.
+	Features []string `json:"features"`
+	// Epoch identifies the instance numbering this connection's seqs, for
+	// clients that agreed to sequencing. Send it back with lastSeq.
+	Epoch     string `json:"epoch,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
 // NewPongMessage creates a new pong message.
 func NewPongMessage() PongMessage {
 	return PongMessage{Type: TypePong}